@@ -0,0 +1,94 @@
+package jsonplan
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// Address is an absolute resource instance address, such as
+// `module.net[0].aws_instance.web["a"]`, broken down into its parts.
+type Address struct {
+	// Module is the path of module calls leading to the module containing
+	// the resource, which is empty for a resource in the root module.
+	Module []ModuleStep
+
+	Mode ResourceMode
+	Type string
+	Name string
+
+	// Key is the instance key of the resource: an int for a resource using
+	// count, a string for a resource using for_each, or nil otherwise.
+	Key interface{}
+}
+
+// ModuleStep is one step of the module path of an Address: the name of a
+// module call and, as for Address.Key, the key of the module instance.
+type ModuleStep struct {
+	Name string
+	Key  interface{}
+}
+
+// ParseAddress parses the given absolute resource instance address, in the
+// form used for the Address of resources and resource changes.
+func ParseAddress(s string) (Address, error) {
+	parsed, diags := addrs.ParseAbsResourceInstanceStr(s)
+	if diags.HasErrors() {
+		return Address{}, fmt.Errorf("invalid resource instance address %q: %s", s, diags.Err())
+	}
+
+	var ret Address
+	for _, step := range parsed.Module {
+		ret.Module = append(ret.Module, ModuleStep{
+			Name: step.Name,
+			Key:  instanceKeyValue(step.InstanceKey),
+		})
+	}
+	ret.Mode = marshalResourceMode(parsed.Resource.Resource.Mode)
+	ret.Type = parsed.Resource.Resource.Type
+	ret.Name = parsed.Resource.Resource.Name
+	ret.Key = instanceKeyValue(parsed.Resource.Key)
+	return ret, nil
+}
+
+// String returns the address in its canonical form, which is the form used
+// for the Address of resources and resource changes. Keys of any type other
+// than int and string are ignored.
+func (a Address) String() string {
+	var module addrs.ModuleInstance
+	for _, step := range a.Module {
+		module = module.Child(step.Name, instanceKeyAddr(step.Key))
+	}
+
+	mode := addrs.ManagedResourceMode
+	if a.Mode == DataResourceMode {
+		mode = addrs.DataResourceMode
+	}
+	return addrs.Resource{
+		Mode: mode,
+		Type: a.Type,
+		Name: a.Name,
+	}.Instance(instanceKeyAddr(a.Key)).Absolute(module).String()
+}
+
+func instanceKeyValue(key addrs.InstanceKey) interface{} {
+	switch key := key.(type) {
+	case addrs.IntKey:
+		return int(key)
+	case addrs.StringKey:
+		return string(key)
+	default:
+		return nil
+	}
+}
+
+func instanceKeyAddr(key interface{}) addrs.InstanceKey {
+	switch key := key.(type) {
+	case int:
+		return addrs.IntKey(key)
+	case string:
+		return addrs.StringKey(key)
+	default:
+		return addrs.NoKey
+	}
+}
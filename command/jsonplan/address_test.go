@@ -0,0 +1,98 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := map[string]struct {
+		input      string
+		want       Address
+		wantString string
+	}{
+		"root module": {
+			`aws_instance.web`,
+			Address{Mode: ManagedResourceMode, Type: "aws_instance", Name: "web"},
+			`aws_instance.web`,
+		},
+		"count instance": {
+			`aws_instance.web[2]`,
+			Address{Mode: ManagedResourceMode, Type: "aws_instance", Name: "web", Key: 2},
+			`aws_instance.web[2]`,
+		},
+		"for_each instance": {
+			`aws_instance.web["a b"]`,
+			Address{Mode: ManagedResourceMode, Type: "aws_instance", Name: "web", Key: "a b"},
+			`aws_instance.web["a b"]`,
+		},
+		"data resource": {
+			`data.aws_ami.ubuntu`,
+			Address{Mode: DataResourceMode, Type: "aws_ami", Name: "ubuntu"},
+			`data.aws_ami.ubuntu`,
+		},
+		"nested modules": {
+			`module.a[0].module.b["x"].module.c.aws_instance.web["x"]`,
+			Address{
+				Module: []ModuleStep{
+					{Name: "a", Key: 0},
+					{Name: "b", Key: "x"},
+					{Name: "c"},
+				},
+				Mode: ManagedResourceMode,
+				Type: "aws_instance",
+				Name: "web",
+				Key:  "x",
+			},
+			`module.a[0].module.b["x"].module.c.aws_instance.web["x"]`,
+		},
+		"non-canonical spacing": {
+			`module.a[ 0 ].aws_instance.web[ "x" ]`,
+			Address{
+				Module: []ModuleStep{{Name: "a", Key: 0}},
+				Mode:   ManagedResourceMode,
+				Type:   "aws_instance",
+				Name:   "web",
+				Key:    "x",
+			},
+			`module.a[0].aws_instance.web["x"]`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseAddress(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, test.want)
+			}
+			if s := got.String(); s != test.wantString {
+				t.Errorf("wrong string %q; want %q", s, test.wantString)
+			}
+
+			// The canonical form parses to the same address.
+			again, err := ParseAddress(got.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("round trip changed the address\ngot:  %#v\nwant: %#v", again, got)
+			}
+		})
+	}
+}
+
+func TestParseAddress_invalid(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`not an address`,
+		`module.a`,
+		`aws_instance.web[0`,
+	} {
+		if got, err := ParseAddress(input); err == nil {
+			t.Errorf("%q parsed as %#v; want error", input, got)
+		}
+	}
+}
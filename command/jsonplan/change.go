@@ -0,0 +1,357 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// BeforeValue returns the Before value of a resource change decoded as an
+// object, as by encoding/json. The result is nil if there is no Before value,
+// as for a create, or if it is null.
+//
+// The decoded value is cached for the changes of plans created by this
+// package, and so the result is shared between calls and must not be
+// modified. The same applies to AfterValue, AttributeBefore and
+// AttributeAfter.
+func (c Change) BeforeValue() (map[string]interface{}, error) {
+	return objectValue(c.before())
+}
+
+// AfterValue returns the After value of a resource change decoded as an
+// object, under the same conditions as for BeforeValue. Attributes that won't
+// be known until after apply are absent or null, as described for After.
+func (c Change) AfterValue() (map[string]interface{}, error) {
+	return objectValue(c.after())
+}
+
+// AttributeBefore returns the value at the given path within the Before value,
+// decoded as by encoding/json. Each step of the path is either the name of an
+// attribute or map key, or the decimal index of a list element. The result is
+// false if the Before value can't be decoded or has nothing at the given path.
+func (c Change) AttributeBefore(path ...string) (interface{}, bool) {
+	return lookupPath(c.before(), path)
+}
+
+// AttributeAfter returns the value at the given path within the After value,
+// as for AttributeBefore.
+func (c Change) AttributeAfter(path ...string) (interface{}, bool) {
+	return lookupPath(c.after(), path)
+}
+
+// decodedValues caches the Before and After values of a change, decoded as
+// by encoding/json. It is shared by the copies of a change, any of which may
+// be given different values, and so each decoded value is kept along with the
+// raw value it was decoded from.
+type decodedValues struct {
+	before, after cachedValue
+}
+
+type cachedValue struct {
+	mu sync.Mutex
+	v  decodedValue
+}
+
+type decodedValue struct {
+	raw json.RawMessage
+	val interface{}
+	err error
+}
+
+// get returns the given raw value decoded, decoding it only if it isn't the
+// value already cached.
+func (cv *cachedValue) get(raw json.RawMessage) decodedValue {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if cv.v.raw == nil || !bytes.Equal(cv.v.raw, raw) {
+		cv.v = decodeRawValue(raw)
+	}
+	return cv.v
+}
+
+// before and after return the decoded Before and After values of the change,
+// from its cache if it has one. Changes that were not created by this package
+// have none.
+func (c Change) before() decodedValue {
+	if c.decoded == nil {
+		return decodeRawValue(c.Before)
+	}
+	return c.decoded.before.get(c.Before)
+}
+
+func (c Change) after() decodedValue {
+	if c.decoded == nil {
+		return decodeRawValue(c.After)
+	}
+	return c.decoded.after.get(c.After)
+}
+
+func decodeRawValue(raw json.RawMessage) decodedValue {
+	ret := decodedValue{raw: raw}
+	if len(raw) != 0 {
+		ret.err = json.Unmarshal(raw, &ret.val)
+	}
+	return ret
+}
+
+func objectValue(d decodedValue) (map[string]interface{}, error) {
+	if d.err != nil {
+		return nil, fmt.Errorf("value is not an object: %s", d.err)
+	}
+	if d.val == nil {
+		return nil, nil
+	}
+	ret, ok := d.val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value is not an object")
+	}
+	return ret, nil
+}
+
+func lookupValuePath(raw json.RawMessage, path []string) (interface{}, bool) {
+	return lookupPath(decodeRawValue(raw), path)
+}
+
+func lookupPath(d decodedValue, path []string) (interface{}, bool) {
+	if len(d.raw) == 0 || d.err != nil {
+		return nil, false
+	}
+
+	v := d.val
+	for _, step := range path {
+		switch tv := v.(type) {
+		case map[string]interface{}:
+			next, ok := tv[step]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			idx, err := strconv.Atoi(step)
+			if err != nil || idx < 0 || idx >= len(tv) {
+				return nil, false
+			}
+			v = tv[idx]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// AttributePathChange describes a change to a single primitive value within
+// a resource change, as returned by Change.ChangedPaths.
+type AttributePathChange struct {
+	// Path is the path of the value within the resource, such as
+	// "tags.Name" or "disk[0].size". Map keys that aren't valid identifiers
+	// are written as quoted indexes, as in `tags["Cost Center"]`.
+	Path string `json:"path"`
+
+	// Before and After are the values before and after the change, decoded
+	// as by encoding/json, and are nil where there is no value. Sensitive
+	// values are replaced by RedactedValue.
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+
+	// AfterUnknown is true if the value won't be known until after apply, in
+	// which case After is nil.
+	AfterUnknown bool `json:"after_unknown,omitempty"`
+
+	// FromProviderDefault is true if the value is within an attribute that
+	// is decided by the provider rather than by the configuration, such as
+	// an attribute that merges in tags configured for the whole provider.
+	// It is set only by ResourceChange.ChangedPaths.
+	FromProviderDefault bool `json:"from_provider_default,omitempty"`
+}
+
+// ChangedPaths returns the paths of each primitive value that differs between
+// the Before and After values of the change, in order of path, with nested
+// objects and lists broken down into their attributes and elements. List
+// elements are compared by index, so an element inserted into a list is
+// reported as a change to each later element and the addition of the last.
+//
+// The result is nil if either value can't be decoded.
+func (c Change) ChangedPaths() []AttributePathChange {
+	var vals [5]interface{}
+	for i, raw := range []json.RawMessage{c.Before, c.After, c.AfterUnknown, c.BeforeSensitive, c.AfterSensitive} {
+		if len(raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(raw, &vals[i]); err != nil {
+			return nil
+		}
+	}
+
+	var ret []AttributePathChange
+	diffValuePaths("", vals[0], vals[1], vals[2], vals[3], vals[4], &ret)
+	return ret
+}
+
+func diffValuePaths(path string, before, after, unknown, beforeSensitive, afterSensitive interface{}, ret *[]AttributePathChange) {
+	if !shapeTrue(unknown) {
+		bm, bIsMap := before.(map[string]interface{})
+		am, aIsMap := after.(map[string]interface{})
+		if (bIsMap || before == nil) && (aIsMap || after == nil) && (bIsMap || aIsMap) {
+			names := make(map[string]bool, len(bm)+len(am))
+			for name := range bm {
+				names[name] = true
+			}
+			for name := range am {
+				names[name] = true
+			}
+			if u, ok := unknown.(map[string]interface{}); ok {
+				for name := range u {
+					names[name] = true
+				}
+			}
+			sorted := make([]string, 0, len(names))
+			for name := range names {
+				sorted = append(sorted, name)
+			}
+			sort.Strings(sorted)
+
+			for _, name := range sorted {
+				next := "[" + strconv.Quote(name) + "]"
+				if validIdentifier(name) {
+					next = name
+					if path != "" {
+						next = "." + name
+					}
+				}
+				diffValuePaths(path+next, bm[name], am[name],
+					shapeAttr(unknown, name), shapeAttr(beforeSensitive, name), shapeAttr(afterSensitive, name), ret)
+			}
+			return
+		}
+
+		bl, bIsList := before.([]interface{})
+		al, aIsList := after.([]interface{})
+		if (bIsList || before == nil) && (aIsList || after == nil) && (bIsList || aIsList) {
+			n := len(bl)
+			if len(al) > n {
+				n = len(al)
+			}
+			for i := 0; i < n; i++ {
+				var bv, av interface{}
+				if i < len(bl) {
+					bv = bl[i]
+				}
+				if i < len(al) {
+					av = al[i]
+				}
+				diffValuePaths(fmt.Sprintf("%s[%d]", path, i), bv, av,
+					shapeElem(unknown, i), shapeElem(beforeSensitive, i), shapeElem(afterSensitive, i), ret)
+			}
+			return
+		}
+	}
+
+	if !shapeTrue(unknown) && jsonValuesEqual(before, after) {
+		return
+	}
+	change := AttributePathChange{
+		Path:         path,
+		Before:       before,
+		After:        after,
+		AfterUnknown: shapeTrue(unknown),
+	}
+	if change.AfterUnknown {
+		change.After = nil
+	}
+	if shapeTrue(beforeSensitive) && before != nil {
+		change.Before = RedactedValue
+	}
+	if shapeTrue(afterSensitive) && change.After != nil {
+		change.After = RedactedValue
+	}
+	*ret = append(*ret, change)
+}
+
+// Equal returns true if the change has the same actions as the other and
+// the same values before and after, compared by their decoded values, so that
+// differences in key order and whitespace are ignored. The unknown and
+// sensitive values are compared by what they mark, so a mask that marks
+// nothing is equal to an omitted one, and an attribute marked false is equal
+// to one left out. The before and after diffs are not compared, since they
+// are derived from the values.
+func (c Change) Equal(other Change) bool {
+	if len(c.Actions) != len(other.Actions) {
+		return false
+	}
+	for i := range c.Actions {
+		if c.Actions[i] != other.Actions[i] {
+			return false
+		}
+	}
+
+	for _, pair := range [][2]json.RawMessage{
+		{c.Before, other.Before},
+		{c.After, other.After},
+	} {
+		a, b, ok := decodeValuePair(pair)
+		if !ok || !reflect.DeepEqual(a, b) {
+			return false
+		}
+	}
+	for _, pair := range [][2]json.RawMessage{
+		{c.AfterUnknown, other.AfterUnknown},
+		{c.BeforeSensitive, other.BeforeSensitive},
+		{c.AfterSensitive, other.AfterSensitive},
+	} {
+		a, b, ok := decodeValuePair(pair)
+		if !ok || !reflect.DeepEqual(normalizeMask(a), normalizeMask(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeValuePair(pair [2]json.RawMessage) (interface{}, interface{}, bool) {
+	var a, b interface{}
+	if err := decodeValue(pair[0], &a); err != nil {
+		return nil, nil, false
+	}
+	if err := decodeValue(pair[1], &b); err != nil {
+		return nil, nil, false
+	}
+	return a, b, true
+}
+
+// normalizeMask returns the given unknown or sensitive value mask with the
+// attributes that mark nothing removed, or nil if it marks nothing at all.
+// List elements are kept, since their positions are significant.
+func normalizeMask(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		if !v {
+			return nil
+		}
+		return true
+	case []interface{}:
+		if !containsUnknown(v) {
+			return nil
+		}
+		ret := make([]interface{}, len(v))
+		for i, ev := range v {
+			ret[i] = normalizeMask(ev)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{})
+		for k, ev := range v {
+			if nv := normalizeMask(ev); nv != nil {
+				ret[k] = nv
+			}
+		}
+		if len(ret) == 0 {
+			return nil
+		}
+		return ret
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,279 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangeValues(t *testing.T) {
+	c := Change{
+		Actions: []string{"update"},
+		Before:  []byte(`{"id":"i-abc","tags":{"env":"prod"},"disk":[{"size":10},{"size":20}]}`),
+		After:   []byte(`{"id":"i-abc","tags":{"env":"staging"},"disk":[{"size":10}]}`),
+	}
+
+	before, err := c.BeforeValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := before["id"], "i-abc"; got != want {
+		t.Errorf("wrong before id %#v; want %#v", got, want)
+	}
+	after, err := c.AfterValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := after["tags"], map[string]interface{}{"env": "staging"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong after tags %#v; want %#v", got, want)
+	}
+
+	tests := map[string]struct {
+		path      []string
+		want      interface{}
+		wantFound bool
+	}{
+		"map key": {
+			[]string{"tags", "env"},
+			"prod",
+			true,
+		},
+		"list element": {
+			[]string{"disk", "1", "size"},
+			float64(20),
+			true,
+		},
+		"whole object": {
+			nil,
+			map[string]interface{}{
+				"id":   "i-abc",
+				"tags": map[string]interface{}{"env": "prod"},
+				"disk": []interface{}{
+					map[string]interface{}{"size": float64(10)},
+					map[string]interface{}{"size": float64(20)},
+				},
+			},
+			true,
+		},
+		"missing attribute": {
+			[]string{"tags", "owner"},
+			nil,
+			false,
+		},
+		"index out of range": {
+			[]string{"disk", "2", "size"},
+			nil,
+			false,
+		},
+		"not an index": {
+			[]string{"disk", "first"},
+			nil,
+			false,
+		},
+		"through a primitive": {
+			[]string{"id", "length"},
+			nil,
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := c.AttributeBefore(test.path...)
+			if ok != test.wantFound {
+				t.Fatalf("wrong result %t; want %t", ok, test.wantFound)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wrong value %#v; want %#v", got, test.want)
+			}
+		})
+	}
+
+	if got, ok := c.AttributeAfter("disk", "1"); ok {
+		t.Errorf("unexpected after value %#v", got)
+	}
+}
+
+func TestChangeValues_create(t *testing.T) {
+	c := Change{
+		Actions: []string{"create"},
+		After:   []byte(`{"ami":"ami-123"}`),
+	}
+
+	before, err := c.BeforeValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != nil {
+		t.Errorf("unexpected before value %#v", before)
+	}
+	if got, ok := c.AttributeBefore("ami"); ok {
+		t.Errorf("unexpected before attribute %#v", got)
+	}
+	if got, ok := c.AttributeAfter("ami"); !ok || got != "ami-123" {
+		t.Errorf("wrong after attribute %#v (%t); want \"ami-123\"", got, ok)
+	}
+}
+
+func TestChangeValues_notObject(t *testing.T) {
+	c := Change{
+		Actions: []string{"create"},
+		After:   []byte(`"10.0.0.1"`),
+	}
+	if _, err := c.AfterValue(); err == nil {
+		t.Error("succeeded; want error")
+	}
+}
+
+func TestChangeValues_cached(t *testing.T) {
+	p, err := Parse([]byte(`{
+		"format_version": "0.2",
+		"resource_changes": [
+			{
+				"address": "test_thing.a",
+				"change": {
+					"actions": ["update"],
+					"before": {"ami": "ami-123"},
+					"after": {"ami": "ami-456"}
+				}
+			}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p.ResourceChanges[0].Change
+
+	first, err := c.AfterValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.AfterValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.ValueOf(first).Pointer() != reflect.ValueOf(second).Pointer() {
+		t.Error("after value was decoded again")
+	}
+
+	// A copy of the change that is given a different value must not see the
+	// value cached for the original, nor replace it.
+	copied := c
+	copied.After = []byte(`{"ami":"ami-789"}`)
+	if got, _ := copied.AttributeAfter("ami"); got != "ami-789" {
+		t.Errorf("wrong after ami of the copy %#v; want \"ami-789\"", got)
+	}
+	if got, _ := c.AttributeAfter("ami"); got != "ami-456" {
+		t.Errorf("wrong after ami %#v; want \"ami-456\"", got)
+	}
+}
+
+func TestChangeChangedPaths(t *testing.T) {
+	c := Change{
+		Actions:         []string{"update"},
+		Before:          []byte(`{"id":"i-abc","tags":{"Name":"old","Cost Center":"a"},"disk":[{"size":10}],"password":"hunter2"}`),
+		After:           []byte(`{"id":"i-abc","tags":{"Name":"new","Cost Center":"a"},"disk":[{"size":10},{"size":20}],"password":"hunter3","arn":null}`),
+		AfterUnknown:    []byte(`{"arn":true}`),
+		BeforeSensitive: []byte(`{"password":true}`),
+		AfterSensitive:  []byte(`{"password":true}`),
+	}
+
+	got := c.ChangedPaths()
+	want := []AttributePathChange{
+		{Path: "arn", AfterUnknown: true},
+		{Path: "disk[1].size", After: float64(20)},
+		{Path: "password", Before: RedactedValue, After: RedactedValue},
+		{Path: "tags.Name", Before: "old", After: "new"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestChangeChangedPaths_create(t *testing.T) {
+	c := Change{
+		Actions: []string{"create"},
+		After:   []byte(`{"ami":"ami-123","tags":{"Cost Center":"a"},"ports":[]}`),
+	}
+
+	got := c.ChangedPaths()
+	want := []AttributePathChange{
+		{Path: "ami", After: "ami-123"},
+		{Path: `tags["Cost Center"]`, After: "a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestChangeEqual(t *testing.T) {
+	base := Change{
+		Actions:      []string{"update"},
+		Before:       []byte(`{"id":"i-abc","ami":"ami-123","tags":{"env":"prod","team":"web"}}`),
+		After:        []byte(`{"ami":"ami-456","tags":{"env":"prod","team":"web"}}`),
+		AfterUnknown: []byte(`{"id":true}`),
+	}
+
+	tests := map[string]struct {
+		other Change
+		want  bool
+	}{
+		"reordered": {
+			Change{
+				Actions: []string{"update"},
+				Before:  []byte(`{"tags":{"team":"web","env":"prod"},"ami":"ami-123","id":"i-abc"}`),
+				After: []byte(`{
+  "tags": {"team": "web", "env": "prod"},
+  "ami": "ami-456"
+}`),
+				AfterUnknown: []byte(`{"ami":false,"id":true,"tags":{}}`),
+			},
+			true,
+		},
+		"different actions": {
+			Change{
+				Actions:      []string{"delete", "create"},
+				Before:       base.Before,
+				After:        base.After,
+				AfterUnknown: base.AfterUnknown,
+			},
+			false,
+		},
+		"different value": {
+			Change{
+				Actions:      base.Actions,
+				Before:       base.Before,
+				After:        []byte(`{"ami":"ami-789","tags":{"env":"prod","team":"web"}}`),
+				AfterUnknown: base.AfterUnknown,
+			},
+			false,
+		},
+		"different unknowns": {
+			Change{
+				Actions:      base.Actions,
+				Before:       base.Before,
+				After:        base.After,
+				AfterUnknown: []byte(`{"id":true,"ami":true}`),
+			},
+			false,
+		},
+		"missing unknowns": {
+			Change{
+				Actions: base.Actions,
+				Before:  base.Before,
+				After:   base.After,
+			},
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := base.Equal(test.other); got != test.want {
+				t.Errorf("wrong result %t; want %t", got, test.want)
+			}
+			if got := test.other.Equal(base); got != test.want {
+				t.Errorf("wrong result in reverse %t; want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,626 @@
+package jsonplan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl2/ext/typeexpr"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/registry/regsrc"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Config represents the complete configuration source
+type Config struct {
+	ProviderConfigs []ProviderConfig `json:"provider_config,omitempty"`
+	RootModule      ConfigRootModule `json:"root_module,omitempty"`
+}
+
+// ProviderConfig describes all of the provider configurations throughout the
+// configuration tree, flattened into a single map for convenience since
+// provider configurations are the one concept in Terraform that can span
+// across module boundaries.
+type ProviderConfig struct {
+	Name          string      `json:"name,omitempty"`
+	Alias         string      `json:"alias,omitempty"`
+	ModuleAddress string      `json:"module_address,omitempty"`
+	Expressions   Expressions `json:"expressions,omitempty"`
+
+	// VersionConstraint combines the version constraints for the provider
+	// given in the module's required_providers block and in the "version"
+	// argument of the provider block itself. Omitted if there are none.
+	VersionConstraint string `json:"version_constraint,omitempty"`
+
+	// ResolvedVersion is the version of the provider plugin selected for
+	// the configuration, as given in MarshallOptions.ProviderVersions.
+	// Omitted if the version is not known.
+	ResolvedVersion string `json:"resolved_version,omitempty"`
+}
+
+// Key returns the string that identifies the provider configuration,
+// consisting of the module address, if any, followed by a colon, and then the
+// provider name and alias separated by a period, such as "module.net:aws.west".
+// Resources refer to their provider configurations by this key.
+func (c ProviderConfig) Key() string {
+	return providerConfigKey(c.ModuleAddress, c.Name, c.Alias)
+}
+
+func providerConfigKey(moduleAddress, name, alias string) string {
+	ret := name
+	if alias != "" {
+		ret += "." + alias
+	}
+	if moduleAddress != "" {
+		ret = moduleAddress + ":" + ret
+	}
+	return ret
+}
+
+// ConfigRootModule is the representation of the root module of the
+// configuration, which is described in the same way as any other module.
+type ConfigRootModule = ConfigModule
+
+// ConfigModule is the representation of a module in configuration: either the
+// root module or a module called by another. Addresses and references within
+// a module are relative to that module.
+type ConfigModule struct {
+	Outputs     map[string]ConfigOutput `json:"outputs,omitempty"`
+	Resources   []ConfigResource        `json:"resources,omitempty"`
+	ModuleCalls []ModuleCall            `json:"module_calls,omitempty"`
+
+	// Variables describes the input variables declared by the module, sorted
+	// by name.
+	Variables []ConfigVariable `json:"variables,omitempty"`
+
+	// Locals describes the expressions of the module's local values, keyed
+	// by name.
+	Locals Expressions `json:"locals,omitempty"`
+
+	// RequiredProviders gives the version constraints of the providers
+	// listed in the module's "required_providers" block, keyed by provider
+	// name. Constraints given for the same provider in several files are
+	// combined.
+	RequiredProviders map[string]string `json:"required_providers,omitempty"`
+}
+
+// ConfigVariable is the representation of a "variable" block in
+// configuration.
+type ConfigVariable struct {
+	Name string `json:"name"`
+
+	// Type is the type constraint of the variable in the same syntax as the
+	// "type" argument, such as "list(string)". It is omitted if the variable
+	// accepts values of any type.
+	Type string `json:"type,omitempty"`
+
+	// Default is the default value of the variable, mapped as for the
+	// individual values in the common value mapping. It is omitted if the
+	// variable is required, and also if the variable is sensitive, so that
+	// its value isn't revealed.
+	Default json.RawMessage `json:"default,omitempty"`
+
+	Sensitive   bool   `json:"sensitive,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ConfigResource is the representation of a resource block in configuration.
+type ConfigResource struct {
+	// Address is the resource address relative to the module it is declared
+	// in.
+	Address string `json:"address,omitempty"`
+
+	// Mode can be "managed" or "data"
+	Mode ResourceMode `json:"mode,omitempty"`
+
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// ProviderName is the type of the provider that will manage this
+	// resource, as for Resource.
+	ProviderName string `json:"provider_name,omitempty"`
+
+	// Expressions describes the resource-type-specific content of the
+	// configuration block.
+	Expressions Expressions `json:"expressions,omitempty"`
+
+	// CountExpression and ForEachExpression describe the expressions given
+	// for the "count" and "for_each" meta-arguments. Each is omitted if the
+	// corresponding argument is not set.
+	CountExpression   *Expression `json:"count_expression,omitempty"`
+	ForEachExpression *Expression `json:"for_each_expression,omitempty"`
+
+	// DependsOn lists the absolute addresses of the objects given in the
+	// "depends_on" meta-argument, such as "aws_iam_role.this" or
+	// "module.net.aws_vpc.main", sorted. Omitted if the argument is not set.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// ModuleCall is the representation of a "module" block in configuration.
+type ModuleCall struct {
+	// Name is the label of the module block. It is omitted by versions of
+	// Terraform that predate it.
+	Name string `json:"name,omitempty"`
+
+	// Source is the module source address exactly as written in
+	// configuration, while ResolvedSource is the location it refers to. For
+	// a registry module this is the fully-qualified registry address,
+	// including the registry hostname. For other modules the two are
+	// identical.
+	Source         string `json:"source,omitempty"`
+	ResolvedSource string `json:"resolved_source,omitempty"`
+
+	// VersionConstraint is the version constraint given in configuration,
+	// and ResolvedVersion is the version that was selected for installation.
+	// Both are omitted for modules installed from sources that don't support
+	// versions, such as local paths.
+	VersionConstraint string `json:"version_constraint,omitempty"`
+	ResolvedVersion   string `json:"resolved_version,omitempty"`
+
+	// Expressions describes the values given for the input variables of the
+	// called module, keyed by variable name. Arguments that don't correspond
+	// to a variable declared by the module are omitted.
+	Expressions Expressions `json:"expressions,omitempty"`
+
+	CountExpression   *Expression `json:"count_expression,omitempty"`
+	ForEachExpression *Expression `json:"for_each_expression,omitempty"`
+
+	// CountValue and ForEachKeys are the number of instances given by the
+	// "count" argument, and the sorted instance keys given by the "for_each"
+	// argument, respectively. Each is included only if the argument refers
+	// to nothing other than input variables and local values whose values
+	// are known from the plan alone: those of the root module's variables
+	// recorded in the plan, the defaults of variables that aren't set, and
+	// the arguments of module calls that are known in the same way.
+	CountValue  *int     `json:"count_value,omitempty"`
+	ForEachKeys []string `json:"for_each_keys,omitempty"`
+
+	// DependsOn lists the addresses of the objects given in the "depends_on"
+	// argument, which the whole of the called module waits for. As for
+	// resources these are absolute addresses, and they are sorted. Omitted if
+	// the argument is not set.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Module describes the configuration of the called module, including any
+	// module calls of its own. Omitted if the module is not installed.
+	Module *ConfigModule `json:"module,omitempty"`
+}
+
+// ConfigOutput defines an output as defined in configuration.
+type ConfigOutput struct {
+	Sensitive  bool       `json:"sensitive,omitempty"`
+	Expression Expression `json:"expression,omitempty"`
+
+	Description string `json:"description,omitempty"`
+
+	// DependsOn lists the addresses of the objects given in the "depends_on"
+	// argument, as for ConfigResource. Omitted if the argument is not set.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// RequiredProviders returns the sorted, fully-qualified source addresses of the
+// providers that the configuration of the plan requires, such as
+// "registry.terraform.io/terraform-providers/aws": those listed in the
+// "required_providers" block of any module, along with those that have a
+// provider configuration in any module or manage any configured resource.
+//
+// The configuration can't give a source address for a provider, which is
+// always installed from the public registry in the namespace of the providers
+// distributed by HashiCorp, so every address has the same hostname and
+// namespace. The result is empty if the configuration is not available.
+func (p *Plan) RequiredProviders() []string {
+	names := make(map[string]bool)
+	for _, pc := range p.Config.ProviderConfigs {
+		names[pc.Name] = true
+	}
+	var addModule func(m *ConfigModule)
+	addModule = func(m *ConfigModule) {
+		for name := range m.RequiredProviders {
+			names[name] = true
+		}
+		for _, r := range m.Resources {
+			names[r.ProviderName] = true
+		}
+		for _, mc := range m.ModuleCalls {
+			if mc.Module != nil {
+				addModule(mc.Module)
+			}
+		}
+	}
+	addModule(&p.Config.RootModule)
+
+	var ret []string
+	for name := range names {
+		if name == "" {
+			continue
+		}
+		ret = append(ret, regsrc.PublicRegistryHost.Normalized()+"/"+regsrc.DefaultProviderNamespace+"/"+name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// marshalConfig populates the configuration section of the plan from the
+// given configuration, which may be nil. The schemas are used to find the
+// expressions within provider and resource configuration blocks, and the
+// given source files, keyed by filename, to find the source text of each
+// expression.
+func (p *Plan) marshalConfig(config *configs.Config, sources map[string][]byte, schemas *terraform.Schemas) {
+	if config == nil {
+		// Nothing to do!
+		return
+	}
+
+	p.Config.ProviderConfigs = marshalProviderConfigs(config, schemas)
+	p.Config.RootModule = marshalConfigModule(config, schemas)
+	p.Config.setRawExpressions(sources)
+}
+
+// setRawExpressions sets the Raw field of each of the expressions in the
+// configuration, as described for Expression.
+func (c *Config) setRawExpressions(sources map[string][]byte) {
+	for _, pc := range c.ProviderConfigs {
+		pc.Expressions.setRaw(sources)
+	}
+	c.RootModule.setRawExpressions(sources)
+}
+
+// setRawExpressions sets the Raw field of each of the expressions in the
+// module and in the modules it calls.
+func (m *ConfigModule) setRawExpressions(sources map[string][]byte) {
+	for _, r := range m.Resources {
+		r.Expressions.setRaw(sources)
+		r.CountExpression.setRaw(sources)
+		r.ForEachExpression.setRaw(sources)
+	}
+	m.Locals.setRaw(sources)
+	for name, o := range m.Outputs {
+		o.Expression.setRaw(sources)
+		m.Outputs[name] = o
+	}
+	for _, mc := range m.ModuleCalls {
+		mc.Expressions.setRaw(sources)
+		mc.CountExpression.setRaw(sources)
+		mc.ForEachExpression.setRaw(sources)
+		if mc.Module != nil {
+			mc.Module.setRawExpressions(sources)
+		}
+	}
+}
+
+// loadConfig loads the configuration tree from the given snapshot, returning
+// nil if there is no configuration to load. It also returns the source of
+// each of the configuration files, keyed by the filenames used in the source
+// ranges of the configuration.
+func loadConfig(snap *configload.Snapshot) (*configs.Config, map[string][]byte, error) {
+	if snap == nil || snap.Modules[""] == nil {
+		return nil, nil, nil
+	}
+
+	loader := configload.NewLoaderFromSnapshot(snap)
+	config, diags := loader.LoadConfig(snap.Modules[""].Dir)
+	if diags.HasErrors() {
+		return nil, nil, fmt.Errorf("failed to load configuration: %s", diags.Error())
+	}
+	return config, loader.Sources(), nil
+}
+
+// configHash returns the hex-encoded SHA-256 hash of the configuration in the
+// given snapshot, or the empty string if there is no configuration.
+//
+// The hash covers the source address, version and files of each module, and
+// is independent of the order in which they appear in the snapshot and of
+// the directories they were installed in. Native syntax files are formatted
+// before hashing, so that changes that only affect their layout don't change
+// the hash.
+func configHash(snap *configload.Snapshot) string {
+	if snap == nil || snap.Modules[""] == nil {
+		return ""
+	}
+
+	h := sha256.New()
+	// Each value is written with its length, so that the boundaries between
+	// values are unambiguous.
+	write := func(b []byte) {
+		fmt.Fprintf(h, "%d:", len(b))
+		h.Write(b)
+	}
+
+	keys := make([]string, 0, len(snap.Modules))
+	for key := range snap.Modules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		mod := snap.Modules[key]
+		write([]byte(key))
+		write([]byte(mod.SourceAddr))
+		if mod.Version != nil {
+			write([]byte(mod.Version.String()))
+		} else {
+			write(nil)
+		}
+
+		names := make([]string, 0, len(mod.Files))
+		for name := range mod.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(h, "%d:", len(names))
+		for _, name := range names {
+			src := mod.Files[name]
+			if strings.HasSuffix(name, ".tf") {
+				src = hclwrite.Format(src)
+			}
+			write([]byte(name))
+			write(src)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// marshalProviderConfigs returns the provider configurations from every
+// module in the given configuration tree, sorted by module address and then
+// by provider name and alias.
+func marshalProviderConfigs(config *configs.Config, schemas *terraform.Schemas) []ProviderConfig {
+	var ret []ProviderConfig
+
+	config.DeepEach(func(c *configs.Config) {
+		for _, pc := range c.Module.ProviderConfigs {
+			var schema *configschema.Block
+			if schemas != nil {
+				schema = schemas.ProviderConfig(pc.Name)
+			}
+			var constraints version.Constraints
+			for _, req := range c.Module.ProviderRequirements[pc.Name] {
+				constraints = append(constraints, req.Required...)
+			}
+			constraints = append(constraints, pc.Version.Required...)
+
+			p := ProviderConfig{
+				Name:          pc.Name,
+				Alias:         pc.Alias,
+				ModuleAddress: moduleAddressString(c.Path),
+				Expressions:   marshalExpressions(pc.Config, schema),
+			}
+			if len(constraints) != 0 {
+				p.VersionConstraint = constraints.String()
+			}
+			ret = append(ret, p)
+		}
+	})
+
+	sortProviderConfigs(ret)
+	return ret
+}
+
+// sortProviderConfigs sorts the given provider configurations by module
+// address and then by provider name and alias.
+func sortProviderConfigs(pcs []ProviderConfig) {
+	sort.Slice(pcs, func(i, j int) bool {
+		a, b := pcs[i], pcs[j]
+		switch {
+		case a.ModuleAddress != b.ModuleAddress:
+			return a.ModuleAddress < b.ModuleAddress
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		default:
+			return a.Alias < b.Alias
+		}
+	})
+}
+
+// marshalConfigModule returns the representation of the module of the given
+// configuration, including the modules it calls, recursively.
+func marshalConfigModule(config *configs.Config, schemas *terraform.Schemas) ConfigModule {
+	var ret ConfigModule
+	m := config.Module
+
+	ret.Resources = append(
+		marshalConfigResources(config.Path, m.ManagedResources, schemas),
+		marshalConfigResources(config.Path, m.DataResources, schemas)...,
+	)
+
+	ret.Variables = marshalConfigVariables(m.Variables)
+
+	if len(m.Outputs) != 0 {
+		ret.Outputs = make(map[string]ConfigOutput, len(m.Outputs))
+		for name, o := range m.Outputs {
+			ret.Outputs[name] = ConfigOutput{
+				Sensitive:   o.Sensitive,
+				Expression:  marshalExpression(o.Expr),
+				Description: o.Description,
+				DependsOn:   marshalDependsOn(config.Path, o.DependsOn),
+			}
+		}
+	}
+
+	if len(m.Locals) != 0 {
+		ret.Locals = make(Expressions, len(m.Locals))
+		for name, l := range m.Locals {
+			ret.Locals[name] = marshalExpression(l.Expr)
+		}
+	}
+
+	if len(m.ProviderRequirements) != 0 {
+		ret.RequiredProviders = make(map[string]string, len(m.ProviderRequirements))
+		for name, reqs := range m.ProviderRequirements {
+			var constraints version.Constraints
+			for _, req := range reqs {
+				constraints = append(constraints, req.Required...)
+			}
+			ret.RequiredProviders[name] = constraints.String()
+		}
+	}
+
+	for _, name := range sortedModuleCallNames(m) {
+		mc := m.ModuleCalls[name]
+		call := ModuleCall{
+			Name:              name,
+			Source:            mc.SourceAddr,
+			ResolvedSource:    resolveModuleSource(mc.SourceAddr),
+			Expressions:       marshalAttributeExpressions(mc.Config),
+			CountExpression:   marshalOptionalExpression(mc.Count),
+			ForEachExpression: marshalOptionalExpression(mc.ForEach),
+			DependsOn:         marshalDependsOn(config.Path, mc.DependsOn),
+		}
+		if len(mc.Version.Required) != 0 {
+			call.VersionConstraint = mc.Version.Required.String()
+		}
+		if child := config.Children[name]; child != nil {
+			if child.Version != nil {
+				call.ResolvedVersion = child.Version.String()
+			}
+
+			// Any other arguments would be rejected during validation, so we
+			// leave them out rather than describe them as inputs.
+			for arg := range call.Expressions {
+				if _, ok := child.Module.Variables[arg]; !ok {
+					delete(call.Expressions, arg)
+				}
+			}
+			if len(call.Expressions) == 0 {
+				call.Expressions = nil
+			}
+
+			mod := marshalConfigModule(child, schemas)
+			call.Module = &mod
+		}
+		ret.ModuleCalls = append(ret.ModuleCalls, call)
+	}
+
+	return ret
+}
+
+// marshalConfigVariables returns the representation of the given variables,
+// sorted by name.
+func marshalConfigVariables(vars map[string]*configs.Variable) []ConfigVariable {
+	var ret []ConfigVariable
+	for _, v := range vars {
+		cv := ConfigVariable{
+			Name:        v.Name,
+			Sensitive:   v.Sensitive,
+			Description: v.Description,
+		}
+		if v.Type != cty.DynamicPseudoType {
+			cv.Type = typeexpr.TypeString(v.Type)
+		}
+		// A default value is always a known constant, so it can always be
+		// marshaled.
+		if v.Default != cty.NilVal && !v.Sensitive {
+			if raw, err := ctyjson.Marshal(v.Default, v.Default.Type()); err == nil {
+				cv.Default = json.RawMessage(raw)
+			}
+		}
+		ret = append(ret, cv)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// marshalDependsOn returns the sorted absolute addresses of the objects
+// referred to by the given "depends_on" traversals, which appear in the module
+// with the given static path.
+func marshalDependsOn(path addrs.Module, traversals []hcl.Traversal) []string {
+	prefix := moduleAddressString(path)
+	if prefix != "" {
+		prefix += "."
+	}
+
+	var ret []string
+	for _, traversal := range traversals {
+		// Any errors here would also have been reported when the
+		// configuration was loaded.
+		ref, diags := addrs.ParseRef(traversal)
+		if diags.HasErrors() {
+			continue
+		}
+		ret = append(ret, prefix+ref.Subject.String())
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// resolveModuleSource returns the resolved form of the given module source
+// address, as described for ModuleCall.
+func resolveModuleSource(addr string) string {
+	for _, prefix := range []string{"./", "../", ".\\", "..\\"} {
+		if strings.HasPrefix(addr, prefix) {
+			return addr
+		}
+	}
+
+	mod, err := regsrc.ParseModuleSource(addr)
+	if err != nil {
+		// Anything else is a go-getter address, which is already explicit
+		// about its location.
+		return addr
+	}
+	if mod.Host().Equal(regsrc.PublicRegistryHost) {
+		// Normalized leaves out the hostname of the public registry, so we
+		// add it back to make the result unambiguous.
+		return regsrc.PublicRegistryHost.Normalized() + "/" + mod.Normalized()
+	}
+	return mod.Normalized()
+}
+
+// marshalConfigResources returns the representation of the given resources of
+// the module with the given static path, sorted by address. A resource whose
+// schema is not available is included without its expressions.
+func marshalConfigResources(path addrs.Module, resources map[string]*configs.Resource, schemas *terraform.Schemas) []ConfigResource {
+	var ret []ConfigResource
+	for _, r := range resources {
+		addr := r.Addr()
+		providerName := r.ProviderConfigAddr().Type
+		ret = append(ret, ConfigResource{
+			Address:      addr.String(),
+			Mode:         marshalResourceMode(addr.Mode),
+			Type:         addr.Type,
+			Name:         addr.Name,
+			ProviderName: providerName,
+			Expressions:  marshalExpressions(r.Config, schemaForResource(schemas, providerName, addr)),
+
+			CountExpression:   marshalOptionalExpression(r.Count),
+			ForEachExpression: marshalOptionalExpression(r.ForEach),
+			DependsOn:         marshalDependsOn(path, r.DependsOn),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Address < ret[j].Address
+	})
+	return ret
+}
+
+// moduleAddressString returns the given static module path in the same syntax
+// as a module instance address without any instance keys, such as
+// "module.a.module.b", so that it can be compared with the module addresses
+// elsewhere in the plan.
+func moduleAddressString(path addrs.Module) string {
+	var buf bytes.Buffer
+	for i, name := range path {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		buf.WriteString("module.")
+		buf.WriteString(name)
+	}
+	return buf.String()
+}
@@ -0,0 +1,1199 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMarshall_configReferences(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "region" {}
+
+provider "test" {
+  region = var.region
+}
+
+resource "test_thing" "a" {
+  ami = "ami-123"
+}
+
+resource "test_thing" "b" {
+  ami = test_thing.a.id
+}
+
+resource "test_thing" "c" {
+  ami = module.net.subnet_id
+}
+
+module "net" {
+  source = "./net"
+  vpc    = test_thing.b.id
+}
+`,
+		"net": `
+variable "vpc" {}
+
+provider "test" {
+  alias  = "net"
+  region = "us-east-1"
+}
+
+output "subnet_id" {
+  value = var.vpc
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Source locations are covered by TestMarshallExpression_source.
+	for i := range got.Config.ProviderConfigs {
+		got.Config.ProviderConfigs[i].Expressions = expressionsWithoutSources(got.Config.ProviderConfigs[i].Expressions)
+	}
+	for i := range got.Config.RootModule.Resources {
+		got.Config.RootModule.Resources[i].Expressions = expressionsWithoutSources(got.Config.RootModule.Resources[i].Expressions)
+	}
+	for i := range got.Config.RootModule.ModuleCalls {
+		got.Config.RootModule.ModuleCalls[i].Expressions = expressionsWithoutSources(got.Config.RootModule.ModuleCalls[i].Expressions)
+
+		// The called modules are covered by TestMarshall_configModules.
+		if got.Config.RootModule.ModuleCalls[i].Module == nil {
+			t.Errorf("no configuration for module call %d", i)
+		}
+		got.Config.RootModule.ModuleCalls[i].Module = nil
+	}
+
+	wantProviders := []ProviderConfig{
+		{
+			Name: "test",
+			Expressions: Expressions{
+				"region": {References: []string{"var.region"}, Raw: "var.region"},
+			},
+		},
+		{
+			Name:          "test",
+			Alias:         "net",
+			ModuleAddress: "module.net",
+			Expressions: Expressions{
+				"region": {ConstantValue: json.RawMessage(`"us-east-1"`)},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got.Config.ProviderConfigs, wantProviders) {
+		t.Errorf("wrong provider configs\ngot:  %#v\nwant: %#v", got.Config.ProviderConfigs, wantProviders)
+	}
+
+	wantResources := []ConfigResource{
+		{
+			Address:      "test_thing.a",
+			Mode:         ManagedResourceMode,
+			Type:         "test_thing",
+			Name:         "a",
+			ProviderName: "test",
+			Expressions: Expressions{
+				"ami": {ConstantValue: json.RawMessage(`"ami-123"`)},
+			},
+		},
+		{
+			Address:      "test_thing.b",
+			Mode:         ManagedResourceMode,
+			Type:         "test_thing",
+			Name:         "b",
+			ProviderName: "test",
+			Expressions: Expressions{
+				"ami": {References: []string{"test_thing.a.id", "test_thing.a"}, Raw: "test_thing.a.id"},
+			},
+		},
+		{
+			Address:      "test_thing.c",
+			Mode:         ManagedResourceMode,
+			Type:         "test_thing",
+			Name:         "c",
+			ProviderName: "test",
+			Expressions: Expressions{
+				"ami": {References: []string{"module.net.subnet_id", "module.net"}, Raw: "module.net.subnet_id"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got.Config.RootModule.Resources, wantResources) {
+		t.Errorf("wrong resources\ngot:  %#v\nwant: %#v", got.Config.RootModule.Resources, wantResources)
+	}
+
+	wantCalls := []ModuleCall{
+		{
+			Name:           "net",
+			Source:         "./net",
+			ResolvedSource: "./net",
+			Expressions: Expressions{
+				"vpc": {References: []string{"test_thing.b.id", "test_thing.b"}, Raw: "test_thing.b.id"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got.Config.RootModule.ModuleCalls, wantCalls) {
+		t.Errorf("wrong module calls\ngot:  %#v\nwant: %#v", got.Config.RootModule.ModuleCalls, wantCalls)
+	}
+}
+
+func TestMarshall_configModules(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+module "net" {
+  source = "./net"
+  cidr   = "10.0.0.0/16"
+}
+`,
+		"net": `
+variable "cidr" {}
+
+resource "test_thing" "vpc" {
+  ami = var.cidr
+}
+
+module "subnet" {
+  source = "./subnet"
+  vpc_id = test_thing.vpc.id
+}
+
+output "subnet_id" {
+  value = module.subnet.id
+}
+`,
+		"net.subnet": `
+variable "vpc_id" {}
+
+resource "test_thing" "subnet" {
+  ami = var.vpc_id
+}
+
+output "id" {
+  value = test_thing.subnet.id
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := got.Config.RootModule.ModuleCalls; len(calls) != 1 || calls[0].Module == nil {
+		t.Fatalf("wrong module calls %#v", calls)
+	}
+	net := got.Config.RootModule.ModuleCalls[0].Module
+	if len(net.Resources) != 1 || net.Resources[0].Address != "test_thing.vpc" {
+		t.Errorf("wrong resources in module.net %#v", net.Resources)
+	}
+	if len(net.Variables) != 1 || net.Variables[0].Name != "cidr" {
+		t.Errorf("wrong variables in module.net %#v", net.Variables)
+	}
+	if want := []string{"module.subnet.id", "module.subnet"}; !reflect.DeepEqual(net.Outputs["subnet_id"].Expression.References, want) {
+		t.Errorf("wrong output references in module.net %#v; want %#v", net.Outputs["subnet_id"].Expression.References, want)
+	}
+
+	if len(net.ModuleCalls) != 1 || net.ModuleCalls[0].Module == nil {
+		t.Fatalf("wrong module calls in module.net %#v", net.ModuleCalls)
+	}
+	subnet := net.ModuleCalls[0].Module
+	if len(subnet.Resources) != 1 {
+		t.Fatalf("wrong number of resources in module.net.module.subnet %d; want 1", len(subnet.Resources))
+	}
+	r := subnet.Resources[0]
+	if r.Address != "test_thing.subnet" {
+		t.Errorf("wrong resource address %q", r.Address)
+	}
+	if want := "var.vpc_id"; r.Expressions["ami"].Raw != want {
+		t.Errorf("wrong raw expression %q; want %q", r.Expressions["ami"].Raw, want)
+	}
+	if _, ok := subnet.Outputs["id"]; !ok {
+		t.Error("no configuration for output id in module.net.module.subnet")
+	}
+}
+
+func TestPlanRequiredProviders(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+terraform {
+  required_providers {
+    test = "~> 1.0"
+  }
+}
+
+provider "test" {
+  region = "us-east-1"
+}
+
+resource "test_thing" "web" {
+}
+
+module "dns" {
+  source = "./dns"
+}
+`,
+		"dns": `
+terraform {
+  required_providers {
+    dns = ">= 2.0"
+  }
+}
+
+resource "cloudflare_record" "www" {
+}
+
+resource "test_thing" "zone" {
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := got.Config.RootModule.RequiredProviders, map[string]string{"test": "~> 1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong required providers\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	// The dns provider is only listed in required_providers, without being
+	// configured or used by any resource.
+	want := []string{
+		"registry.terraform.io/terraform-providers/cloudflare",
+		"registry.terraform.io/terraform-providers/dns",
+		"registry.terraform.io/terraform-providers/test",
+	}
+	if got := got.RequiredProviders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong providers\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestMarshallExpressions_nestedBlocks(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "size" {}
+
+resource "test_instance" "a" {
+  disk {
+    size = var.size
+  }
+  disk {
+    size = 10
+  }
+}
+`,
+	})
+
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_instance": {
+						BlockTypes: map[string]*configschema.NestedBlock{
+							"disk": {
+								Nesting: configschema.NestingList,
+								Block: configschema.Block{
+									Attributes: map[string]*configschema.Attribute{
+										"size": {Type: cty.Number, Optional: true},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(snap, nil, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Expressions{
+		"disk": {
+			Blocks: []Expressions{
+				{"size": {References: []string{"var.size"}, Raw: "var.size"}},
+				{"size": {ConstantValue: json.RawMessage(`10`)}},
+			},
+		},
+	}
+	if len(got.Config.RootModule.Resources) != 1 {
+		t.Fatalf("wrong number of resources %d; want 1", len(got.Config.RootModule.Resources))
+	}
+	if got := expressionsWithoutSources(got.Config.RootModule.Resources[0].Expressions); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong expressions\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestMarshallExpression_source(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `resource "test_thing" "a" {
+  ami = join("-", [
+  "ami", "123"])
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Config.RootModule.Resources) != 1 {
+		t.Fatalf("wrong number of resources %d; want 1", len(got.Config.RootModule.Resources))
+	}
+
+	want := Source{
+		FileName: "main.tf",
+		Start:    Pos{Line: 2, Column: 9, Byte: 36},
+		End:      Pos{Line: 3, Column: 17, Byte: 64},
+	}
+	if got := got.Config.RootModule.Resources[0].Expressions["ami"].Source; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong source\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestMarshallExpression_raw(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "env" {}
+
+resource "test_thing" "web" {
+  count = length(
+    var.env)
+  ami   = "${var.env}-web"
+}
+
+resource "test_thing" "db" {
+  ami = "ami-123"
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources := make(map[string]ConfigResource)
+	for _, r := range got.Config.RootModule.Resources {
+		resources[r.Address] = r
+	}
+
+	web := resources["test_thing.web"]
+	if got, want := web.Expressions["ami"].Raw, `"${var.env}-web"`; got != want {
+		t.Errorf("wrong raw expression for ami %s; want %s", got, want)
+	}
+	if got, want := web.CountExpression.Raw, "length(\n    var.env)"; got != want {
+		t.Errorf("wrong raw expression for count %q; want %q", got, want)
+	}
+
+	// A constant is already given by its value.
+	db := resources["test_thing.db"]
+	if got := db.Expressions["ami"].Raw; got != "" {
+		t.Errorf("unexpected raw expression for constant %s", got)
+	}
+}
+
+func TestMarshall_configRepetition(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "n" {}
+
+resource "test_thing" "counted" {
+  count = var.n
+}
+
+resource "test_thing" "each" {
+  for_each = toset(["a", "b"])
+}
+
+resource "test_thing" "single" {
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources := make(map[string]ConfigResource)
+	for _, r := range got.Config.RootModule.Resources {
+		resources[r.Address] = r
+	}
+
+	counted := resources["test_thing.counted"]
+	if counted.CountExpression == nil {
+		t.Fatal("test_thing.counted has no count expression")
+	}
+	if got, want := counted.CountExpression.References, []string{"var.n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong count references %#v; want %#v", got, want)
+	}
+	if counted.ForEachExpression != nil {
+		t.Errorf("test_thing.counted has unexpected for_each expression %#v", counted.ForEachExpression)
+	}
+
+	each := resources["test_thing.each"]
+	if each.ForEachExpression == nil {
+		t.Fatal("test_thing.each has no for_each expression")
+	}
+	if got, want := each.ForEachExpression.Source.Start, (Pos{Line: 9, Column: 14, Byte: 115}); got != want {
+		t.Errorf("wrong for_each start position %#v; want %#v", got, want)
+	}
+	if each.CountExpression != nil {
+		t.Errorf("test_thing.each has unexpected count expression %#v", each.CountExpression)
+	}
+
+	single := resources["test_thing.single"]
+	if single.CountExpression != nil || single.ForEachExpression != nil {
+		t.Errorf("test_thing.single has unexpected repetition expressions")
+	}
+	raw, err := json.Marshal(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"count_expression", "for_each_expression"} {
+		if _, ok := fields[name]; ok {
+			t.Errorf("test_thing.single json has unexpected %q", name)
+		}
+	}
+}
+
+func TestMarshall_moduleSources(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+module "net" {
+  source = "./net"
+}
+
+module "consul" {
+  source = "hashicorp/consul/aws"
+}
+
+module "vpc" {
+  source = "app.terraform.io/Example/vpc/aws//modules/subnets"
+}
+`,
+		"net":    ``,
+		"consul": ``,
+		"vpc":    ``,
+	})
+	snap.Modules["consul"].SourceAddr = "hashicorp/consul/aws"
+	snap.Modules["vpc"].SourceAddr = "app.terraform.io/Example/vpc/aws//modules/subnets"
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type sources struct {
+		Source, ResolvedSource string
+	}
+	var gotSources []sources
+	for _, mc := range got.Config.RootModule.ModuleCalls {
+		gotSources = append(gotSources, sources{mc.Source, mc.ResolvedSource})
+	}
+	// Module calls are sorted by name.
+	wantSources := []sources{
+		{"hashicorp/consul/aws", "registry.terraform.io/hashicorp/consul/aws"},
+		{"./net", "./net"},
+		{"app.terraform.io/Example/vpc/aws//modules/subnets", "app.terraform.io/example/vpc/aws//modules/subnets"},
+	}
+	if !reflect.DeepEqual(gotSources, wantSources) {
+		t.Errorf("wrong sources\ngot:  %#v\nwant: %#v", gotSources, wantSources)
+	}
+}
+
+func TestMarshall_dependsOn(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "aws_iam_role" "this" {
+}
+
+resource "aws_instance" "web" {
+  depends_on = [module.net, aws_iam_role.this]
+}
+
+module "net" {
+  source = "./net"
+}
+`,
+		"net": `
+resource "aws_vpc" "main" {
+}
+
+resource "aws_subnet" "a" {
+  depends_on = [module.subnet, aws_vpc.main]
+}
+
+module "subnet" {
+  source = "./subnet"
+}
+`,
+		"net.subnet": ``,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps := make(map[string][]string)
+	for _, r := range got.Config.RootModule.Resources {
+		deps[r.Address] = r.DependsOn
+	}
+	want := map[string][]string{
+		"aws_iam_role.this": nil,
+		"aws_instance.web":  {"aws_iam_role.this", "module.net"},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("wrong dependencies\ngot:  %#v\nwant: %#v", deps, want)
+	}
+
+	// The dependencies of resources in child modules are given by their
+	// absolute addresses.
+	deps = make(map[string][]string)
+	for _, r := range got.Config.RootModule.ModuleCalls[0].Module.Resources {
+		deps[r.Address] = r.DependsOn
+	}
+	want = map[string][]string{
+		"aws_subnet.a": {"module.net.aws_vpc.main", "module.net.module.subnet"},
+		"aws_vpc.main": nil,
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("wrong dependencies in module.net\ngot:  %#v\nwant: %#v", deps, want)
+	}
+}
+
+func TestMarshall_configVariables(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "zones" {
+  type        = list(string)
+  default     = ["a", "b"]
+  description = "The availability zones."
+}
+
+variable "password" {
+  sensitive = true
+}
+
+variable "api_key" {
+  default   = "hunter2"
+  sensitive = true
+}
+`,
+	})
+
+	src, err := Marshall(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(src, []byte("hunter2")) {
+		t.Errorf("plan json reveals the default of a sensitive variable:\n%s", src)
+	}
+	got, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := got.Config.RootModule.Variables
+	if len(vars) != 3 {
+		t.Fatalf("wrong number of variables %d; want 3", len(vars))
+	}
+	for i, want := range []ConfigVariable{
+		{Name: "api_key", Sensitive: true},
+		{Name: "password", Sensitive: true},
+	} {
+		if !reflect.DeepEqual(vars[i], want) {
+			t.Errorf("wrong variable\ngot:  %#v\nwant: %#v", vars[i], want)
+		}
+	}
+
+	zones := vars[2]
+	if zones.Name != "zones" || zones.Type != "list(string)" || zones.Description != "The availability zones." || zones.Sensitive {
+		t.Errorf("wrong variable %#v", zones)
+	}
+	assertJSONEqual(t, zones.Default, []byte(`["a","b"]`))
+}
+
+func TestMarshall_configLocals(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "env" {}
+
+locals {
+  prefix = "${var.env}-web"
+  region = "us-east-1"
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locals := got.Config.RootModule.Locals
+	if len(locals) != 2 {
+		t.Fatalf("wrong number of locals %d; want 2", len(locals))
+	}
+	prefix := locals["prefix"]
+	if want := []string{"var.env"}; !reflect.DeepEqual(prefix.References, want) {
+		t.Errorf("wrong references %#v; want %#v", prefix.References, want)
+	}
+	if want := `"${var.env}-web"`; prefix.Raw != want {
+		t.Errorf("wrong raw expression %q; want %q", prefix.Raw, want)
+	}
+	assertJSONEqual(t, locals["region"].ConstantValue, []byte(`"us-east-1"`))
+}
+
+func TestMarshall_configOutputs(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_thing" "web" {
+}
+
+output "web_id" {
+  value       = test_thing.web.id
+  description = "The ID of the web server."
+  depends_on  = [test_thing.web]
+}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, ok := got.Config.RootModule.Outputs["web_id"]
+	if !ok {
+		t.Fatal("no configuration for output web_id")
+	}
+	if want := "The ID of the web server."; o.Description != want {
+		t.Errorf("wrong description %q; want %q", o.Description, want)
+	}
+	if want := []string{"test_thing.web"}; !reflect.DeepEqual(o.DependsOn, want) {
+		t.Errorf("wrong dependencies %#v; want %#v", o.DependsOn, want)
+	}
+	if want := []string{"test_thing.web.id", "test_thing.web"}; !reflect.DeepEqual(o.Expression.References, want) {
+		t.Errorf("wrong references %#v; want %#v", o.Expression.References, want)
+	}
+	if want := "test_thing.web.id"; o.Expression.Raw != want {
+		t.Errorf("wrong raw expression %q; want %q", o.Expression.Raw, want)
+	}
+}
+
+func TestMarshall_configOutputsJSON(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+output "region" {
+  value = "us-east-1"
+}
+`,
+	})
+
+	src, err := Marshall(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Configuration struct {
+			RootModule struct {
+				Outputs map[string]map[string]json.RawMessage `json:"outputs"`
+			} `json:"root_module"`
+		} `json:"configuration"`
+	}
+	if err := json.Unmarshal(src, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	o, ok := doc.Configuration.RootModule.Outputs["region"]
+	if !ok {
+		t.Fatalf("no configuration for output region in %s", src)
+	}
+	if _, ok := o["value"]; ok {
+		t.Errorf("output configuration has a resolved value: %s", o["value"])
+	}
+	assertJSONEqual(t, o["expression"], []byte(`{"constant_value":"us-east-1","source":{"filename":"main.tf","start":{"line":3,"column":11,"byte":29},"end":{"line":3,"column":22,"byte":40}}}`))
+}
+
+func TestMarshall_moduleCallDependsOn(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "aws_vpc" "main" {
+}
+
+resource "aws_iam_role" "this" {
+}
+
+module "x" {
+  source     = "./x"
+  depends_on = [aws_vpc.main, aws_iam_role.this]
+}
+
+module "y" {
+  source = "./y"
+}
+`,
+		"x": ``,
+		"y": `
+resource "aws_vpc" "main" {
+}
+
+module "z" {
+  source     = "./z"
+  depends_on = [aws_vpc.main]
+}
+`,
+		"y.z": ``,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := got.Config.RootModule.ModuleCalls
+	if len(calls) != 2 {
+		t.Fatalf("wrong number of module calls %d; want 2", len(calls))
+	}
+	if got, want := calls[0].DependsOn, []string{"aws_iam_role.this", "aws_vpc.main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong dependencies for module.x\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got := calls[1].DependsOn; got != nil {
+		t.Errorf("unexpected dependencies for module.y: %#v", got)
+	}
+
+	// The dependencies of nested module calls are given by their absolute
+	// addresses.
+	nested := calls[1].Module.ModuleCalls
+	if len(nested) != 1 {
+		t.Fatalf("wrong number of module calls in module.y %d; want 1", len(nested))
+	}
+	if got, want := nested[0].DependsOn, []string{"module.y.aws_vpc.main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong dependencies for module.y.module.z\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestMarshall_moduleCallValues(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "zones" {
+}
+
+module "counted" {
+  source = "./counted"
+  count  = 3
+}
+
+module "each" {
+  source   = "./each"
+  for_each = var.zones
+}
+
+module "unknown" {
+  source = "./unknown"
+  count  = length(test_thing.a.id)
+}
+
+locals {
+  zone_names = keys(var.zones)
+  instances  = length(local.zone_names)
+}
+
+module "local" {
+  source = "./local"
+  count  = local.instances
+}
+
+module "nested" {
+  source = "./nested"
+  zones  = var.zones
+}
+`,
+		"counted": ``,
+		"each":    ``,
+		"unknown": ``,
+		"local":   ``,
+		"nested": `
+variable "zones" {
+}
+
+variable "size" {
+  default = 2
+}
+
+module "inner" {
+  source   = "./inner"
+  for_each = var.zones
+}
+
+module "sized" {
+  source = "./sized"
+  count  = var.size
+}
+`,
+		"nested.inner": ``,
+		"nested.sized": ``,
+	})
+	zones, err := plans.NewDynamicValue(cty.MapVal(map[string]cty.Value{
+		"us-east-1b": cty.StringVal("10.0.2.0/24"),
+		"us-east-1a": cty.StringVal("10.0.1.0/24"),
+	}), cty.DynamicPseudoType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		VariableValues: map[string]plans.DynamicValue{
+			"zones": zones,
+		},
+		Changes: plans.NewChanges(),
+	}
+
+	got, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := got.Config.RootModule.ModuleCalls
+	if len(calls) != 5 {
+		t.Fatalf("wrong number of module calls %d; want 5", len(calls))
+	}
+	counted, each, local, nested, unknown := calls[0], calls[1], calls[2], calls[3], calls[4]
+	if counted.CountValue == nil || *counted.CountValue != 3 {
+		t.Errorf("wrong count value %v; want 3", counted.CountValue)
+	}
+	if want := []string{"us-east-1a", "us-east-1b"}; !reflect.DeepEqual(each.ForEachKeys, want) {
+		t.Errorf("wrong for_each keys %#v; want %#v", each.ForEachKeys, want)
+	}
+	if each.CountValue != nil {
+		t.Errorf("unexpected count value %d", *each.CountValue)
+	}
+	if unknown.CountValue != nil {
+		t.Errorf("unexpected count value %d for a count that refers to a resource", *unknown.CountValue)
+	}
+	if local.CountValue == nil || *local.CountValue != 2 {
+		t.Errorf("wrong count value %v from a local value; want 2", local.CountValue)
+	}
+
+	// The values of nested module calls are found from the arguments of the
+	// calls and the defaults of the variables.
+	inner, sized := nested.Module.ModuleCalls[0], nested.Module.ModuleCalls[1]
+	if want := []string{"us-east-1a", "us-east-1b"}; !reflect.DeepEqual(inner.ForEachKeys, want) {
+		t.Errorf("wrong for_each keys %#v for module.nested.module.inner; want %#v", inner.ForEachKeys, want)
+	}
+	if sized.CountValue == nil || *sized.CountValue != 2 {
+		t.Errorf("wrong count value %v for module.nested.module.sized; want 2", sized.CountValue)
+	}
+
+	// This version of the language has no function to convert to a set, so
+	// a set of keys can only come from a variable's value.
+	set := cty.SetVal([]cty.Value{cty.StringVal("b"), cty.StringVal("a")})
+	if got, want := forEachKeys(set), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong keys for set %#v; want %#v", got, want)
+	}
+}
+
+func TestMarshall_moduleCallInputs(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "cidr" {}
+
+module "net" {
+  source = "./net"
+  count  = 1
+  cidr   = var.cidr
+  name   = "prod"
+  bogus  = "ignored"
+}
+`,
+		"net": `
+variable "cidr" {}
+variable "name" {}
+`,
+	})
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Config.RootModule.ModuleCalls) != 1 {
+		t.Fatalf("wrong number of module calls %d; want 1", len(got.Config.RootModule.ModuleCalls))
+	}
+
+	want := Expressions{
+		"cidr": {References: []string{"var.cidr"}, Raw: "var.cidr"},
+		"name": {ConstantValue: json.RawMessage(`"prod"`)},
+	}
+	if got := expressionsWithoutSources(got.Config.RootModule.ModuleCalls[0].Expressions); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong expressions\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestMarshall_moduleVersions(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+module "consul" {
+  source  = "hashicorp/consul/aws"
+  version = "~> 2.0"
+}
+
+module "net" {
+  source = "./net"
+}
+`,
+		"consul": ``,
+		"net":    ``,
+	})
+	snap.Modules["consul"].SourceAddr = "hashicorp/consul/aws"
+	snap.Modules["consul"].Version = version.Must(version.NewVersion("2.1.3"))
+
+	got, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Config.RootModule.ModuleCalls) != 2 {
+		t.Fatalf("wrong number of module calls %d; want 2", len(got.Config.RootModule.ModuleCalls))
+	}
+
+	consul := got.Config.RootModule.ModuleCalls[0]
+	if got, want := consul.VersionConstraint, "~> 2.0"; got != want {
+		t.Errorf("wrong version constraint %q; want %q", got, want)
+	}
+	if got, want := consul.ResolvedVersion, "2.1.3"; got != want {
+		t.Errorf("wrong resolved version %q; want %q", got, want)
+	}
+
+	raw, err := json.Marshal(got.Config.RootModule.ModuleCalls[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"version_constraint", "resolved_version"} {
+		if _, ok := fields[name]; ok {
+			t.Errorf("local module call json has unexpected %q", name)
+		}
+	}
+}
+
+func TestMarshall_providerVersions(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+terraform {
+  required_providers {
+    test = "~> 1.2"
+  }
+}
+
+provider "test" {
+  version = "< 1.5"
+}
+
+provider "test" {
+  alias = "other"
+}
+`,
+	})
+
+	tests := map[string]struct {
+		opts         MarshallOptions
+		wantResolved string
+	}{
+		"no versions": {
+			MarshallOptions{},
+			"",
+		},
+		"pinned version": {
+			MarshallOptions{
+				ProviderVersions: map[string]string{"test": "1.2.3"},
+			},
+			"1.2.3",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			src, err := MarshallWithOptions(snap, nil, nil, testSchemas(), test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Config.ProviderConfigs) != 2 {
+				t.Fatalf("wrong number of provider configs %d; want 2", len(got.Config.ProviderConfigs))
+			}
+
+			wantConstraints := map[string]string{
+				"":      "~> 1.2,< 1.5",
+				"other": "~> 1.2",
+			}
+			for _, pc := range got.Config.ProviderConfigs {
+				if got, want := pc.VersionConstraint, wantConstraints[pc.Alias]; got != want {
+					t.Errorf("wrong version constraint for %q %q; want %q", pc.Alias, got, want)
+				}
+				if got, want := pc.ResolvedVersion, test.wantResolved; got != want {
+					t.Errorf("wrong resolved version for %q %q; want %q", pc.Alias, got, want)
+				}
+			}
+
+			if test.wantResolved == "" && bytes.Contains(src, []byte(`"resolved_version"`)) {
+				t.Errorf("json has unexpected resolved_version:\n%s", src)
+			}
+		})
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	snapshot := func(files ...string) *configload.Snapshot {
+		// The files are given as pairs of names and their contents.
+		mod := &configload.SnapshotModule{
+			Dir:   ".",
+			Files: make(map[string][]byte),
+		}
+		for i := 0; i < len(files); i += 2 {
+			mod.Files[files[i]] = []byte(files[i+1])
+		}
+		return &configload.Snapshot{
+			Modules: map[string]*configload.SnapshotModule{"": mod},
+		}
+	}
+
+	base := configHash(snapshot(
+		"main.tf", "resource \"test_thing\" \"a\" {\n  ami = \"ami-123\"\n}\n",
+		"outputs.tf", "output \"id\" {\n  value = test_thing.a.id\n}\n",
+	))
+	if len(base) != 64 {
+		t.Fatalf("wrong hash %q; want 64 hex digits", base)
+	}
+
+	tests := map[string]struct {
+		snap *configload.Snapshot
+		same bool
+	}{
+		"same files in a different order": {
+			snapshot(
+				"outputs.tf", "output \"id\" {\n  value = test_thing.a.id\n}\n",
+				"main.tf", "resource \"test_thing\" \"a\" {\n  ami = \"ami-123\"\n}\n",
+			),
+			true,
+		},
+		"reformatted": {
+			snapshot(
+				"main.tf", "resource \"test_thing\" \"a\" {\n      ami=\"ami-123\"\n}\n",
+				"outputs.tf", "output \"id\" {\n\tvalue    =   test_thing.a.id\n}\n",
+			),
+			true,
+		},
+		"changed value": {
+			snapshot(
+				"main.tf", "resource \"test_thing\" \"a\" {\n  ami = \"ami-456\"\n}\n",
+				"outputs.tf", "output \"id\" {\n  value = test_thing.a.id\n}\n",
+			),
+			false,
+		},
+		"content moved between files": {
+			snapshot(
+				"main.tf", "resource \"test_thing\" \"a\" {\n  ami = \"ami-123\"\n}\noutput \"id\" {\n  value = test_thing.a.id\n}\n",
+				"outputs.tf", "",
+			),
+			false,
+		},
+		"renamed file": {
+			snapshot(
+				"main.tf", "resource \"test_thing\" \"a\" {\n  ami = \"ami-123\"\n}\n",
+				"output.tf", "output \"id\" {\n  value = test_thing.a.id\n}\n",
+			),
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := configHash(test.snap)
+			if same := got == base; same != test.same {
+				t.Errorf("hash %q compared with %q: same is %t; want %t", got, base, same, test.same)
+			}
+		})
+	}
+}
+
+func TestConfigHash_modules(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"":    "module \"net\" {\n  source = \"./net\"\n}\n",
+		"net": "variable \"cidr\" {}\n",
+	})
+	base := configHash(snap)
+
+	// The installation directory doesn't matter.
+	snap.Modules["net"].Dir = "elsewhere/net"
+	if got := configHash(snap); got != base {
+		t.Errorf("hash changed to %q when module directory changed; want %q", got, base)
+	}
+
+	snap.Modules["net"].Version = version.Must(version.NewVersion("1.0.0"))
+	if got := configHash(snap); got == base {
+		t.Errorf("hash did not change when module version changed")
+	}
+
+	if got := configHash(nil); got != "" {
+		t.Errorf("wrong hash for no configuration %q; want empty", got)
+	}
+
+	p, err := MarshallToPlan(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.ConfigHash, configHash(snap); got != want {
+		t.Errorf("wrong plan config hash %q; want %q", got, want)
+	}
+}
+
+// testSnapshot returns a configuration snapshot containing a module for each
+// of the given module paths, each with a single main.tf file of the given
+// source. The root module has the empty path, and each child module path must
+// also be the source address of its module block, relative to the root.
+func testSnapshot(modules map[string]string) *configload.Snapshot {
+	snap := &configload.Snapshot{
+		Modules: make(map[string]*configload.SnapshotModule),
+	}
+	for path, src := range modules {
+		dir := path
+		sourceAddr := "./" + path
+		if path == "" {
+			dir = "."
+			sourceAddr = ""
+		}
+		snap.Modules[path] = &configload.SnapshotModule{
+			Dir:        dir,
+			SourceAddr: sourceAddr,
+			Files: map[string][]byte{
+				"main.tf": []byte(src),
+			},
+		}
+	}
+	return snap
+}
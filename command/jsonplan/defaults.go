@@ -0,0 +1,97 @@
+package jsonplan
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl2/hcldec"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// markProviderDefaults sets the ProviderDefaultAttributes of each update and
+// replacement among the plan's resource changes, as described for
+// MarshallOptions.ProviderDefaults.
+func (p *Plan) markProviderDefaults(config *configs.Config, schemas *terraform.Schemas) {
+	if config == nil {
+		return
+	}
+	for i := range p.ResourceChanges {
+		rc := &p.ResourceChanges[i]
+		if c := rc.Change; !c.IsReplace() && (len(c.Actions) != 1 || c.Actions[0] != "update") {
+			continue
+		}
+
+		addr, diags := addrs.ParseAbsResourceInstanceStr(rc.Address)
+		if diags.HasErrors() {
+			continue
+		}
+		rc.ProviderDefaultAttributes = providerDefaultAttributes(addr, config, schemas)
+	}
+}
+
+// providerDefaultAttributes returns the sorted names of the top-level
+// attributes of the given resource instance whose values are decided by the
+// provider alone: those that the schema describes as both optional and
+// computed and that the configuration doesn't set. Attributes that are only
+// computed, such as an id, are left out, since they change whenever the
+// object is replaced whatever the provider's defaults.
+func providerDefaultAttributes(addr addrs.AbsResourceInstance, config *configs.Config, schemas *terraform.Schemas) []string {
+	modCfg := config.DescendentForInstance(addr.Module)
+	if modCfg == nil {
+		return nil
+	}
+	rc := modCfg.Module.ResourceByAddr(addr.Resource.Resource)
+	if rc == nil || rc.Config == nil {
+		return nil
+	}
+	schema := schemaForResource(schemas, rc.ProviderConfigAddr().Type, addr.Resource.Resource)
+	if schema == nil {
+		return nil
+	}
+
+	// As in configSensitiveAttrs, we use the schema's implied body schema to
+	// find the attributes that are set.
+	content, _, _ := rc.Config.PartialContent(hcldec.ImpliedSchema(schema.DecoderSpec()))
+	if content == nil {
+		return nil
+	}
+
+	var ret []string
+	for name, attr := range schema.Attributes {
+		if !attr.Optional || !attr.Computed {
+			continue
+		}
+		if _, set := content.Attributes[name]; set {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ChangedPaths returns the changed paths of the resource change, as for
+// Change.ChangedPaths, with FromProviderDefault set for each path within
+// one of the change's ProviderDefaultAttributes.
+func (rc ResourceChange) ChangedPaths() []AttributePathChange {
+	ret := rc.Change.ChangedPaths()
+	if len(rc.ProviderDefaultAttributes) == 0 {
+		return ret
+	}
+
+	defaults := make(map[string]bool, len(rc.ProviderDefaultAttributes))
+	for _, name := range rc.ProviderDefaultAttributes {
+		defaults[name] = true
+	}
+	for i := range ret {
+		name := ret[i].Path
+		if end := strings.IndexAny(name, ".["); end >= 0 {
+			name = name[:end]
+		}
+		ret[i].FromProviderDefault = defaults[name]
+	}
+	return ret
+}
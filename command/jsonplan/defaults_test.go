@@ -0,0 +1,183 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshallWithOptions_providerDefaults(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":       {Type: cty.String, Computed: true},
+			"tags":     {Type: cty.Map(cty.String), Optional: true},
+			"tags_all": {Type: cty.Map(cty.String), Optional: true, Computed: true},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_bucket"] = schema
+	ty := schema.ImpliedType()
+
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_bucket" "logs" {
+  tags = {
+    Name = "logs"
+  }
+}
+`,
+	})
+
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":   cty.StringVal("logs"),
+		"tags": cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("logs")}),
+		"tags_all": cty.MapVal(map[string]cty.Value{
+			"Name": cty.StringVal("logs"),
+		}),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":   cty.StringVal("logs"),
+		"tags": cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("logs")}),
+		"tags_all": cty.MapVal(map[string]cty.Value{
+			"Name":  cty.StringVal("logs"),
+			"Owner": cty.StringVal("platform"),
+		}),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_bucket",
+			Name: "logs",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Update,
+			Before: before,
+			After:  after,
+		},
+	}
+	update, err := rc.Encode(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{update},
+		},
+	}
+
+	src, err := MarshallWithOptions(snap, plan, nil, schemas, MarshallOptions{ProviderDefaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.ResourceChanges[0]
+	if want := []string{"tags_all"}; !reflect.DeepEqual(got.ProviderDefaultAttributes, want) {
+		t.Errorf("wrong provider default attributes %#v; want %#v", got.ProviderDefaultAttributes, want)
+	}
+
+	paths := got.ChangedPaths()
+	want := []AttributePathChange{
+		{Path: "tags_all.Owner", After: "platform", FromProviderDefault: true},
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("wrong changed paths\ngot:  %#v\nwant: %#v", paths, want)
+	}
+
+	// The attributes are only listed when asked for.
+	p, err = MarshallToPlan(snap, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.ResourceChanges[0].ProviderDefaultAttributes; got != nil {
+		t.Errorf("unexpected provider default attributes %#v", got)
+	}
+}
+
+func TestMarshallWithOptions_providerDefaultsReplace(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":       {Type: cty.String, Computed: true},
+			"name":     {Type: cty.String, Required: true},
+			"tags_all": {Type: cty.Map(cty.String), Optional: true, Computed: true},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_bucket"] = schema
+	ty := schema.ImpliedType()
+
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_bucket" "logs" {
+  name = "logs-2"
+}
+`,
+	})
+
+	// The id changes whenever the object is replaced, and so isn't a
+	// provider default even though the configuration doesn't set it.
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":       cty.StringVal("logs"),
+		"name":     cty.StringVal("logs"),
+		"tags_all": cty.NullVal(cty.Map(cty.String)),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":       cty.StringVal("logs-2"),
+		"name":     cty.StringVal("logs-2"),
+		"tags_all": cty.NullVal(cty.Map(cty.String)),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_bucket",
+			Name: "logs",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.DeleteThenCreate,
+			Before: before,
+			After:  after,
+		},
+	}
+	replace, err := rc.Encode(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{replace},
+		},
+	}
+
+	src, err := MarshallWithOptions(snap, plan, nil, schemas, MarshallOptions{ProviderDefaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.ResourceChanges[0]
+	if want := []string{"tags_all"}; !reflect.DeepEqual(got.ProviderDefaultAttributes, want) {
+		t.Errorf("wrong provider default attributes %#v; want %#v", got.ProviderDefaultAttributes, want)
+	}
+	for _, path := range got.ChangedPaths() {
+		if path.FromProviderDefault {
+			t.Errorf("change to %s wrongly marked as from a provider default", path.Path)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package jsonplan
+
+import (
+	"sort"
+	"strings"
+)
+
+// Dependencies returns the addresses of all of the resources in the root
+// module configuration that the resource with the given address depends on,
+// either directly or indirectly, through the references in its expressions,
+// including those made through local values, or its "depends_on" argument.
+// The result is sorted and never includes the given address itself.
+//
+// Since this relies on the references recorded in the configuration, the
+// result is empty unless the plan includes the configuration.
+func (p *Plan) Dependencies(address string) []string {
+	return reachable(p.configDependencies(), address)
+}
+
+// Dependents returns the addresses of all of the resources in the root module
+// configuration that depend on the resource with the given address, either
+// directly or indirectly. These are the resources that might be affected if
+// the given resource were removed. The result is as described for
+// Dependencies.
+func (p *Plan) Dependents(address string) []string {
+	deps := p.configDependencies()
+
+	dependents := make(map[string][]string)
+	for addr, targets := range deps {
+		for _, target := range targets {
+			dependents[target] = append(dependents[target], addr)
+		}
+	}
+	return reachable(dependents, address)
+}
+
+// configDependencies returns the direct dependencies of each resource in the
+// root module configuration, keyed by resource address.
+func (p *Plan) configDependencies() map[string][]string {
+	resources := make(map[string]bool, len(p.Config.RootModule.Resources))
+	for _, r := range p.Config.RootModule.Resources {
+		resources[r.Address] = true
+	}
+
+	ret := make(map[string][]string, len(resources))
+	for _, r := range p.Config.RootModule.Resources {
+		var refs []string
+		refs = appendExpressionsReferences(refs, r.Expressions)
+		if r.CountExpression != nil {
+			refs = appendExpressionReferences(refs, *r.CountExpression)
+		}
+		if r.ForEachExpression != nil {
+			refs = appendExpressionReferences(refs, *r.ForEachExpression)
+		}
+		refs = appendLocalReferences(refs, p.Config.RootModule.Locals)
+		refs = append(refs, r.DependsOn...)
+
+		// The references of an expression include the address of each
+		// referenced resource alongside any more specific references to its
+		// attributes, so we need only look for exact matches.
+		for _, ref := range refs {
+			if resources[ref] && ref != r.Address {
+				ret[r.Address] = append(ret[r.Address], ref)
+			}
+		}
+	}
+	return ret
+}
+
+// appendLocalReferences appends to refs the references of each local value
+// of the module, whose expressions are given, that is referred to in refs,
+// including those of the local values that these refer to in turn.
+func appendLocalReferences(refs []string, locals Expressions) []string {
+	visited := make(map[string]bool)
+	for i := 0; i < len(refs); i++ {
+		if !strings.HasPrefix(refs[i], "local.") || visited[refs[i]] {
+			continue
+		}
+		visited[refs[i]] = true
+		if expr, ok := locals[strings.TrimPrefix(refs[i], "local.")]; ok {
+			refs = appendExpressionReferences(refs, expr)
+		}
+	}
+	return refs
+}
+
+func appendExpressionsReferences(refs []string, exprs Expressions) []string {
+	for _, expr := range exprs {
+		refs = appendExpressionReferences(refs, expr)
+	}
+	return refs
+}
+
+func appendExpressionReferences(refs []string, expr Expression) []string {
+	refs = append(refs, expr.References...)
+	for _, block := range expr.Blocks {
+		refs = appendExpressionsReferences(refs, block)
+	}
+	return refs
+}
+
+// reachable returns the sorted keys of all of the nodes of the given graph
+// that can be reached from the given node, other than the node itself. The
+// graph may contain cycles.
+func reachable(graph map[string][]string, from string) []string {
+	seen := map[string]bool{from: true}
+	var ret []string
+
+	stack := []string{from}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range graph[node] {
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			ret = append(ret, next)
+			stack = append(stack, next)
+		}
+	}
+
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,198 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanDependencies(t *testing.T) {
+	tests := map[string]struct {
+		config           string
+		address          string
+		wantDependencies []string
+		wantDependents   []string
+	}{
+		"chain start": {
+			testChainConfig,
+			"test_thing.a",
+			nil,
+			[]string{"test_thing.b", "test_thing.c"},
+		},
+		"chain middle": {
+			testChainConfig,
+			"test_thing.b",
+			[]string{"test_thing.a"},
+			[]string{"test_thing.c"},
+		},
+		"chain end": {
+			testChainConfig,
+			"test_thing.c",
+			[]string{"test_thing.a", "test_thing.b"},
+			nil,
+		},
+		"diamond top": {
+			testDiamondConfig,
+			"test_thing.top",
+			nil,
+			[]string{"test_thing.bottom", "test_thing.left", "test_thing.right"},
+		},
+		"diamond side": {
+			testDiamondConfig,
+			"test_thing.left",
+			[]string{"test_thing.top"},
+			[]string{"test_thing.bottom"},
+		},
+		"diamond bottom": {
+			testDiamondConfig,
+			"test_thing.bottom",
+			[]string{"test_thing.left", "test_thing.right", "test_thing.top"},
+			nil,
+		},
+		"explicit dependency": {
+			testExplicitConfig,
+			"test_thing.c",
+			[]string{"test_thing.a", "test_thing.b"},
+			nil,
+		},
+		"explicit dependent": {
+			testExplicitConfig,
+			"test_thing.a",
+			nil,
+			[]string{"test_thing.b", "test_thing.c"},
+		},
+		"through locals": {
+			testLocalsConfig,
+			"test_thing.c",
+			[]string{"test_thing.a", "test_thing.b"},
+			nil,
+		},
+		"through locals dependent": {
+			testLocalsConfig,
+			"test_thing.a",
+			nil,
+			[]string{"test_thing.b", "test_thing.c"},
+		},
+		"unknown resource": {
+			testChainConfig,
+			"test_thing.z",
+			nil,
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := MarshallToPlan(testSnapshot(map[string]string{"": test.config}), nil, nil, testSchemas())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := p.Dependencies(test.address); !reflect.DeepEqual(got, test.wantDependencies) {
+				t.Errorf("wrong dependencies\ngot:  %#v\nwant: %#v", got, test.wantDependencies)
+			}
+			if got := p.Dependents(test.address); !reflect.DeepEqual(got, test.wantDependents) {
+				t.Errorf("wrong dependents\ngot:  %#v\nwant: %#v", got, test.wantDependents)
+			}
+		})
+	}
+}
+
+func TestPlanDependencies_cycle(t *testing.T) {
+	// Terraform would reject a configuration like this one during planning,
+	// but the plan json may come from elsewhere.
+	p := &Plan{
+		Config: Config{
+			RootModule: ConfigRootModule{
+				Resources: []ConfigResource{
+					{
+						Address:     "test_thing.a",
+						Expressions: Expressions{"ami": {References: []string{"test_thing.c.id", "test_thing.c"}}},
+					},
+					{
+						Address:     "test_thing.b",
+						Expressions: Expressions{"ami": {References: []string{"test_thing.a.id", "test_thing.a"}}},
+					},
+					{
+						Address:         "test_thing.c",
+						CountExpression: &Expression{References: []string{"test_thing.b.id", "test_thing.b"}},
+					},
+				},
+			},
+		},
+	}
+
+	want := []string{"test_thing.b", "test_thing.c"}
+	if got := p.Dependencies("test_thing.a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong dependencies\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got := p.Dependents("test_thing.a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong dependents\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+const testChainConfig = `
+resource "test_thing" "a" {
+  ami = "ami-123"
+}
+
+resource "test_thing" "b" {
+  ami = test_thing.a.id
+}
+
+resource "test_thing" "c" {
+  ami = test_thing.b.id
+}
+`
+
+const testDiamondConfig = `
+resource "test_thing" "top" {
+  ami = "ami-123"
+}
+
+resource "test_thing" "left" {
+  ami = test_thing.top.id
+}
+
+resource "test_thing" "right" {
+  ami = "${test_thing.top.id}-right"
+}
+
+resource "test_thing" "bottom" {
+  ami = "${test_thing.left.id}-${test_thing.right.id}"
+}
+`
+
+const testExplicitConfig = `
+resource "test_thing" "a" {
+  ami = "ami-123"
+}
+
+resource "test_thing" "b" {
+  depends_on = [test_thing.a]
+}
+
+resource "test_thing" "c" {
+  ami        = test_thing.b.id
+  depends_on = [test_thing.a]
+}
+`
+
+const testLocalsConfig = `
+locals {
+  a_id  = test_thing.a.id
+  b_ami = "${local.b_id}-ami"
+  b_id  = test_thing.b.id
+}
+
+resource "test_thing" "a" {
+  ami = "ami-123"
+}
+
+resource "test_thing" "b" {
+  ami = local.a_id
+}
+
+resource "test_thing" "c" {
+  ami = local.b_ami
+}
+`
@@ -0,0 +1,246 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// PlanDiff describes how one plan differs from another, such as between two
+// consecutive plans of the same configuration. It describes the changes to
+// the plans themselves, rather than the changes the plans would make.
+type PlanDiff struct {
+	// AddedResourceChanges and RemovedResourceChanges are the resource
+	// changes present in only the new or only the old plan respectively,
+	// while ModifiedResourceChanges are those present in both plans but
+	// differing between them. All are keyed by resource instance address,
+	// with a suffix identifying the deposed object for changes to deposed
+	// objects.
+	AddedResourceChanges    map[string]ResourceChange
+	RemovedResourceChanges  map[string]ResourceChange
+	ModifiedResourceChanges map[string]ResourceChangeDiff
+
+	// OutputChanges summarizes the differences between the output changes
+	// of the two plans, by output name.
+	OutputChanges KeyDiff
+
+	// ConfigResources summarizes the differences between the resources in
+	// the root module configuration of the two plans, by address.
+	ConfigResources KeyDiff
+}
+
+// ResourceChangeDiff is a resource change that differs between two plans.
+type ResourceChangeDiff struct {
+	Old ResourceChange
+	New ResourceChange
+}
+
+// KeyDiff summarizes the differences between two collections of named
+// objects. Each list is sorted.
+type KeyDiff struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// Empty returns true if the two collections are equal.
+func (d KeyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Empty returns true if there are no differences between the two plans.
+func (d *PlanDiff) Empty() bool {
+	return len(d.AddedResourceChanges) == 0 &&
+		len(d.RemovedResourceChanges) == 0 &&
+		len(d.ModifiedResourceChanges) == 0 &&
+		d.OutputChanges.Empty() &&
+		d.ConfigResources.Empty()
+}
+
+// DiffOptions are the options for DiffPlansWithOptions.
+type DiffOptions struct {
+	// IncludeSources causes changes to the source locations of expressions
+	// to be treated as differences. By default they are ignored, so that
+	// moving a block within a configuration file is not considered to be a
+	// change.
+	IncludeSources bool
+}
+
+// DiffPlans returns the differences between the old plan a and the new plan
+// b, using the default options. The comparison doesn't depend on the order
+// of the objects within either plan.
+func DiffPlans(a, b *Plan) (*PlanDiff, error) {
+	return DiffPlansWithOptions(a, b, DiffOptions{})
+}
+
+// DiffPlansWithOptions is a variant of DiffPlans that accepts options.
+func DiffPlansWithOptions(a, b *Plan, opts DiffOptions) (*PlanDiff, error) {
+	if a == nil || b == nil {
+		return nil, errors.New("both plans are required")
+	}
+
+	ret := &PlanDiff{
+		AddedResourceChanges:    make(map[string]ResourceChange),
+		RemovedResourceChanges:  make(map[string]ResourceChange),
+		ModifiedResourceChanges: make(map[string]ResourceChangeDiff),
+	}
+
+	oldChanges := resourceChangesByKey(a.ResourceChanges)
+	newChanges := resourceChangesByKey(b.ResourceChanges)
+	for key, oldRC := range oldChanges {
+		newRC, ok := newChanges[key]
+		if !ok {
+			ret.RemovedResourceChanges[key] = oldRC
+			continue
+		}
+		equal, err := jsonEqual(oldRC, newRC)
+		if err != nil {
+			return nil, fmt.Errorf("error comparing changes for %s: %s", key, err)
+		}
+		if !equal {
+			ret.ModifiedResourceChanges[key] = ResourceChangeDiff{Old: oldRC, New: newRC}
+		}
+	}
+	for key, newRC := range newChanges {
+		if _, ok := oldChanges[key]; !ok {
+			ret.AddedResourceChanges[key] = newRC
+		}
+	}
+
+	oldOutputs := make(map[string]interface{}, len(a.OutputChanges))
+	for name, c := range a.OutputChanges {
+		oldOutputs[name] = c
+	}
+	newOutputs := make(map[string]interface{}, len(b.OutputChanges))
+	for name, c := range b.OutputChanges {
+		newOutputs[name] = c
+	}
+	var err error
+	ret.OutputChanges, err = diffKeys(oldOutputs, newOutputs)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing output changes: %s", err)
+	}
+
+	ret.ConfigResources, err = diffKeys(
+		configResourcesByAddress(a.Config.RootModule.Resources, opts.IncludeSources),
+		configResourcesByAddress(b.Config.RootModule.Resources, opts.IncludeSources),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error comparing configuration resources: %s", err)
+	}
+
+	return ret, nil
+}
+
+// resourceChangeKey returns the key identifying the given change in a
+// PlanDiff.
+func resourceChangeKey(rc ResourceChange) string {
+	if rc.DeposedKey == "" {
+		return rc.Address
+	}
+	return fmt.Sprintf("%s (deposed object %s)", rc.Address, rc.DeposedKey)
+}
+
+func resourceChangesByKey(changes []ResourceChange) map[string]ResourceChange {
+	ret := make(map[string]ResourceChange, len(changes))
+	for _, rc := range changes {
+		ret[resourceChangeKey(rc)] = rc
+	}
+	return ret
+}
+
+func configResourcesByAddress(resources []ConfigResource, includeSources bool) map[string]interface{} {
+	ret := make(map[string]interface{}, len(resources))
+	for _, r := range resources {
+		if !includeSources {
+			r.Expressions = expressionsWithoutSources(r.Expressions)
+			r.CountExpression = expressionWithoutSource(r.CountExpression)
+			r.ForEachExpression = expressionWithoutSource(r.ForEachExpression)
+		}
+		ret[r.Address] = r
+	}
+	return ret
+}
+
+// diffKeys compares the two given collections of objects, each of which must
+// be encodable as json.
+func diffKeys(oldObjs, newObjs map[string]interface{}) (KeyDiff, error) {
+	var ret KeyDiff
+	for key, oldV := range oldObjs {
+		newV, ok := newObjs[key]
+		if !ok {
+			ret.Removed = append(ret.Removed, key)
+			continue
+		}
+		equal, err := jsonEqual(oldV, newV)
+		if err != nil {
+			return ret, fmt.Errorf("%s: %s", key, err)
+		}
+		if !equal {
+			ret.Modified = append(ret.Modified, key)
+		}
+	}
+	for key := range newObjs {
+		if _, ok := oldObjs[key]; !ok {
+			ret.Added = append(ret.Added, key)
+		}
+	}
+
+	sort.Strings(ret.Added)
+	sort.Strings(ret.Removed)
+	sort.Strings(ret.Modified)
+	return ret, nil
+}
+
+// jsonEqual returns true if the json encodings of the two given values are
+// equivalent, regardless of formatting and of the order of object
+// properties.
+func jsonEqual(a, b interface{}) (bool, error) {
+	aV, err := jsonGeneric(a)
+	if err != nil {
+		return false, err
+	}
+	bV, err := jsonGeneric(b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aV, bV), nil
+}
+
+func jsonGeneric(v interface{}) (interface{}, error) {
+	src, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = json.Unmarshal(src, &ret)
+	return ret, err
+}
+
+func expressionsWithoutSources(exprs Expressions) Expressions {
+	if exprs == nil {
+		return nil
+	}
+	ret := make(Expressions, len(exprs))
+	for name, expr := range exprs {
+		ret[name] = *expressionWithoutSource(&expr)
+	}
+	return ret
+}
+
+func expressionWithoutSource(expr *Expression) *Expression {
+	if expr == nil {
+		return nil
+	}
+	ret := *expr
+	ret.Source = Source{}
+	if expr.Blocks != nil {
+		ret.Blocks = make([]Expressions, len(expr.Blocks))
+		for i, block := range expr.Blocks {
+			ret.Blocks[i] = expressionsWithoutSources(block)
+		}
+	}
+	return &ret
+}
@@ -0,0 +1,120 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffPlans(t *testing.T) {
+	oldPlan := &Plan{
+		ResourceChanges: []ResourceChange{
+			{Address: "test_thing.same", Change: Change{Actions: []string{"create"}, After: json.RawMessage(`{"ami":"ami-123","id":"i-abc"}`)}},
+			{Address: "test_thing.changed", Change: Change{Actions: []string{"update"}}},
+			{Address: "test_thing.removed", Change: Change{Actions: []string{"delete"}}},
+			{Address: "test_thing.web", DeposedKey: "00000001", Change: Change{Actions: []string{"delete"}}},
+		},
+		OutputChanges: map[string]OutputChange{
+			"same":    {Change: Change{Actions: []string{"no-op"}}},
+			"changed": {Change: Change{Actions: []string{"create"}, After: json.RawMessage(`"a"`)}},
+			"removed": {Change: Change{Actions: []string{"create"}}},
+		},
+	}
+	newPlan := &Plan{
+		// The order of the changes and the formatting of their values
+		// don't matter.
+		ResourceChanges: []ResourceChange{
+			{Address: "test_thing.web", Change: Change{Actions: []string{"create", "delete"}}},
+			{Address: "test_thing.changed", Change: Change{Actions: []string{"delete", "create"}}},
+			{Address: "test_thing.same", Change: Change{Actions: []string{"create"}, After: json.RawMessage(`{ "id": "i-abc", "ami": "ami-123" }`)}},
+		},
+		OutputChanges: map[string]OutputChange{
+			"same":    {Change: Change{Actions: []string{"no-op"}}},
+			"changed": {Change: Change{Actions: []string{"create"}, After: json.RawMessage(`"b"`)}},
+			"added":   {Change: Change{Actions: []string{"create"}}},
+		},
+	}
+
+	got, err := DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := resourceChangeKeys(got.AddedResourceChanges), []string{"test_thing.web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong added resource changes %#v; want %#v", got, want)
+	}
+	if got, want := resourceChangeKeys(got.RemovedResourceChanges), []string{"test_thing.removed", "test_thing.web (deposed object 00000001)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong removed resource changes %#v; want %#v", got, want)
+	}
+	if len(got.ModifiedResourceChanges) != 1 {
+		t.Fatalf("wrong modified resource changes %#v", got.ModifiedResourceChanges)
+	}
+	if got, want := got.ModifiedResourceChanges["test_thing.changed"].New.Change.ReplaceOrder(), "delete-first"; got != want {
+		t.Errorf("wrong newPlan change for test_thing.changed: replace order %q; want %q", got, want)
+	}
+
+	wantOutputs := KeyDiff{
+		Added:    []string{"added"},
+		Removed:  []string{"removed"},
+		Modified: []string{"changed"},
+	}
+	if !reflect.DeepEqual(got.OutputChanges, wantOutputs) {
+		t.Errorf("wrong output changes\ngot:  %#v\nwant: %#v", got.OutputChanges, wantOutputs)
+	}
+
+	if got.Empty() {
+		t.Errorf("diff is empty")
+	}
+}
+
+func TestDiffPlans_sources(t *testing.T) {
+	resource := func(line int) ConfigResource {
+		return ConfigResource{
+			Address: "test_thing.web",
+			Expressions: Expressions{
+				"ami": {
+					ConstantValue: json.RawMessage(`"ami-123"`),
+					Source: Source{
+						FileName: "main.tf",
+						Start:    Pos{Line: line, Column: 9},
+						End:      Pos{Line: line, Column: 18},
+					},
+				},
+			},
+		}
+	}
+	oldPlan := &Plan{Config: Config{RootModule: ConfigRootModule{Resources: []ConfigResource{resource(2)}}}}
+	newPlan := &Plan{Config: Config{RootModule: ConfigRootModule{Resources: []ConfigResource{resource(5)}}}}
+
+	got, err := DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Empty() {
+		t.Errorf("diff is not empty when only sources differ\n%#v", got)
+	}
+
+	got, err = DiffPlansWithOptions(oldPlan, newPlan, DiffOptions{IncludeSources: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"test_thing.web"}; !reflect.DeepEqual(got.ConfigResources.Modified, want) {
+		t.Errorf("wrong modified config resources %#v; want %#v", got.ConfigResources.Modified, want)
+	}
+}
+
+func TestDiffPlans_nil(t *testing.T) {
+	if _, err := DiffPlans(nil, &Plan{}); err == nil {
+		t.Fatal("succeeded; want error")
+	}
+}
+
+func resourceChangeKeys(changes map[string]ResourceChange) []string {
+	var ret []string
+	for key := range changes {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
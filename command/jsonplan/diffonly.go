@@ -0,0 +1,87 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// diffOnlyChangeValues replaces the before and after values of each resource
+// change with the update action by their BeforeDiff and AfterDiff, as
+// described for MarshallOptions.DiffOnly.
+func (p *Plan) diffOnlyChangeValues() error {
+	for i := range p.ResourceChanges {
+		c := &p.ResourceChanges[i].Change
+		if len(c.Actions) != 1 || c.Actions[0] != "update" {
+			continue
+		}
+
+		var before, after interface{}
+		if err := decodeValue(c.Before, &before); err != nil {
+			return err
+		}
+		if err := decodeValue(c.After, &after); err != nil {
+			return err
+		}
+
+		beforeDiff, afterDiff, _ := diffValues(before, after)
+		var err error
+		c.BeforeDiff, err = json.Marshal(beforeDiff)
+		if err != nil {
+			return err
+		}
+		c.AfterDiff, err = json.Marshal(afterDiff)
+		if err != nil {
+			return err
+		}
+		c.Before, c.After = nil, nil
+	}
+	return nil
+}
+
+// diffValues returns the parts of the given decoded json values that differ,
+// and whether there are any. Objects are reduced to the attributes that
+// differ, recursively, with an attribute that is absent from one of the
+// values also absent from its result. Any other values that differ,
+// including lists, are returned whole.
+func diffValues(before, after interface{}) (interface{}, interface{}, bool) {
+	bm, bIsMap := before.(map[string]interface{})
+	am, aIsMap := after.(map[string]interface{})
+	if !bIsMap || !aIsMap {
+		if jsonValuesEqual(before, after) {
+			return nil, nil, false
+		}
+		return before, after, true
+	}
+
+	retB := make(map[string]interface{})
+	retA := make(map[string]interface{})
+	for name, bv := range bm {
+		av, ok := am[name]
+		if !ok {
+			retB[name] = bv
+			continue
+		}
+		if bd, ad, changed := diffValues(bv, av); changed {
+			retB[name] = bd
+			retA[name] = ad
+		}
+	}
+	for name, av := range am {
+		if _, ok := bm[name]; !ok {
+			retA[name] = av
+		}
+	}
+	return retB, retA, len(retB) != 0 || len(retA) != 0
+}
+
+// decodeValue decodes the given json value into v, keeping numbers as they
+// were written. An absent value decodes as nil.
+func decodeValue(raw json.RawMessage, v *interface{}) error {
+	if len(raw) == 0 {
+		*v = nil
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
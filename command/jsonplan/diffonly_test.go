@@ -0,0 +1,102 @@
+package jsonplan
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshallWithOptions_diffOnly(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"tags": {Type: cty.Map(cty.String), Optional: true},
+		},
+	}
+	beforeAttrs := map[string]cty.Value{
+		"tags": cty.MapVal(map[string]cty.Value{
+			"Name": cty.StringVal("web"),
+			"Env":  cty.StringVal("prod"),
+		}),
+	}
+	afterAttrs := map[string]cty.Value{
+		"tags": cty.MapVal(map[string]cty.Value{
+			"Name": cty.StringVal("web"),
+			"Team": cty.StringVal("infra"),
+		}),
+	}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("field_%02d", i)
+		schema.Attributes[name] = &configschema.Attribute{Type: cty.String, Optional: true}
+		beforeAttrs[name] = cty.StringVal("a")
+		afterAttrs[name] = cty.StringVal("a")
+	}
+	afterAttrs["field_17"] = cty.StringVal("b")
+
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_big"] = schema
+	ty := schema.ImpliedType()
+
+	encode := func(name string, action plans.Action, before, after cty.Value) *plans.ResourceInstanceChangeSrc {
+		rc := &plans.ResourceInstanceChange{
+			Addr: addrs.Resource{
+				Mode: addrs.ManagedResourceMode,
+				Type: "test_big",
+				Name: name,
+			}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+			ProviderAddr: addrs.ProviderConfig{
+				Type: "test",
+			}.Absolute(addrs.RootModuleInstance),
+			Change: plans.Change{
+				Action: action,
+				Before: before,
+				After:  after,
+			},
+		}
+		ret, err := rc.Encode(ty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				encode("created", plans.Create, cty.NullVal(ty), cty.ObjectVal(afterAttrs)),
+				encode("updated", plans.Update, cty.ObjectVal(beforeAttrs), cty.ObjectVal(afterAttrs)),
+			},
+		},
+	}
+
+	src, err := MarshallWithOptions(nil, plan, nil, schemas, MarshallOptions{DiffOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, ok := got.ResourceChange("test_big.updated")
+	if !ok {
+		t.Fatal("no change for test_big.updated")
+	}
+	if updated.Change.Before != nil || updated.Change.After != nil {
+		t.Errorf("update has full values\nbefore: %s\nafter:  %s", updated.Change.Before, updated.Change.After)
+	}
+	assertJSONEqual(t, updated.Change.BeforeDiff, []byte(`{"field_17":"a","tags":{"Env":"prod"}}`))
+	assertJSONEqual(t, updated.Change.AfterDiff, []byte(`{"field_17":"b","tags":{"Team":"infra"}}`))
+
+	// Other actions keep their full values.
+	created, ok := got.ResourceChange("test_big.created")
+	if !ok {
+		t.Fatal("no change for test_big.created")
+	}
+	if created.Change.After == nil || created.Change.AfterDiff != nil {
+		t.Errorf("create was reduced to a diff")
+	}
+}
@@ -0,0 +1,130 @@
+package jsonplan
+
+import (
+	"bytes"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// marshalResourceDrift populates the resource drift of the plan with the
+// differences between the current objects of managed resources in the state
+// recorded before refreshing and in the refreshed state that the plan was
+// created against. Objects that were refreshed away appear as deletions.
+func (p *Plan) marshalResourceDrift(recorded, refreshed *states.State, config *configs.Config, schemas *terraform.Schemas) error {
+	changes, err := driftChanges(recorded, refreshed, schemas)
+	if err != nil {
+		return err
+	}
+
+	for _, rc := range sortedResourceChanges(changes) {
+		r, err := marshalResourceChange(rc, config, refreshed, schemas)
+		if perr, ok := err.(PlanError); ok {
+			p.Errors = append(p.Errors, perr)
+		} else if err != nil {
+			return err
+		}
+		p.ResourceDrift = append(p.ResourceDrift, r)
+	}
+
+	return nil
+}
+
+// driftChanges returns an update or delete change for each current object of
+// a managed resource in the recorded state which differs in the refreshed
+// state. Objects are compared by their decoded values where the resource
+// schema is available and by their raw attributes otherwise; in the latter
+// case the change has no values, and marshalResourceChange reports the
+// missing schema.
+func driftChanges(recorded, refreshed *states.State, schemas *terraform.Schemas) ([]*plans.ResourceInstanceChangeSrc, error) {
+	if recorded == nil {
+		return nil, nil
+	}
+
+	var ret []*plans.ResourceInstanceChangeSrc
+	for _, ms := range recorded.Modules {
+		for _, rs := range ms.Resources {
+			if rs.Addr.Mode != addrs.ManagedResourceMode {
+				continue
+			}
+
+			for key, is := range rs.Instances {
+				if is.Current == nil {
+					continue
+				}
+				addr := rs.Addr.Instance(key).Absolute(ms.Addr)
+
+				var after *states.ResourceInstanceObjectSrc
+				if refreshed != nil {
+					if ris := refreshed.ResourceInstance(addr); ris != nil {
+						after = ris.Current
+					}
+				}
+
+				rc, err := driftChange(addr, rs.ProviderConfig, is.Current, after, schemas)
+				if err != nil {
+					return nil, err
+				}
+				if rc != nil {
+					ret = append(ret, rc)
+				}
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// driftChange returns the change from the given recorded object to the given
+// refreshed object, which is nil if the object no longer exists, or nil if the
+// two are the same.
+func driftChange(addr addrs.AbsResourceInstance, provider addrs.AbsProviderConfig, before, after *states.ResourceInstanceObjectSrc, schemas *terraform.Schemas) (*plans.ResourceInstanceChangeSrc, error) {
+	action := plans.Delete
+	if after != nil {
+		action = plans.Update
+	}
+
+	schema := schemaForResource(schemas, provider.ProviderConfig.Type, addr.Resource.Resource)
+	if schema == nil {
+		if after != nil && bytes.Equal(before.AttrsJSON, after.AttrsJSON) {
+			return nil, nil
+		}
+		return &plans.ResourceInstanceChangeSrc{
+			Addr:         addr,
+			ProviderAddr: provider,
+			ChangeSrc:    plans.ChangeSrc{Action: action},
+		}, nil
+	}
+
+	ty := schema.ImpliedType()
+	beforeObj, err := before.Decode(ty)
+	if err != nil {
+		return nil, err
+	}
+	change := &plans.ResourceInstanceChange{
+		Addr:         addr,
+		ProviderAddr: provider,
+		Change: plans.Change{
+			Action: action,
+			Before: beforeObj.Value,
+			After:  cty.NullVal(ty),
+		},
+	}
+	if after != nil {
+		afterObj, err := after.Decode(ty)
+		if err != nil {
+			return nil, err
+		}
+		if beforeObj.Value.RawEquals(afterObj.Value) {
+			return nil, nil
+		}
+		change.After = afterObj.Value
+	}
+
+	return change.Encode(ty)
+}
@@ -0,0 +1,144 @@
+package jsonplan
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMarshall_resourceDrift(t *testing.T) {
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_thing": {
+						Attributes: map[string]*configschema.Attribute{
+							"id":   {Type: cty.String, Computed: true},
+							"tags": {Type: cty.Map(cty.String), Optional: true},
+						},
+					},
+				},
+			},
+		},
+	}
+	provider := addrs.ProviderConfig{Type: "test"}.Absolute(addrs.RootModuleInstance)
+	thing := func(name string) addrs.AbsResourceInstance {
+		return addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_thing",
+			Name: name,
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance)
+	}
+	object := func(attrs string) *states.ResourceInstanceObjectSrc {
+		return &states.ResourceInstanceObjectSrc{
+			Status:    states.ObjectReady,
+			AttrsJSON: []byte(attrs),
+		}
+	}
+
+	recorded := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(thing("web"), object(`{"id":"i-abc","tags":{"env":"prod"}}`), provider)
+		s.SetResourceInstanceCurrent(thing("db"), object(`{"id":"i-def","tags":{}}`), provider)
+	})
+	refreshed := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(thing("web"), object(`{"id":"i-abc","tags":{"env":"staging"}}`), provider)
+		s.SetResourceInstanceCurrent(thing("db"), object(`{"id":"i-def","tags":{}}`), provider)
+	})
+
+	t.Run("with recorded state", func(t *testing.T) {
+		src, err := MarshallWithOptions(nil, &plans.Plan{Changes: plans.NewChanges()}, refreshed, schemas, MarshallOptions{
+			RecordedState: recorded,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got.ResourceChanges) != 0 {
+			t.Errorf("unexpected resource changes %#v", got.ResourceChanges)
+		}
+		if len(got.ResourceDrift) != 1 {
+			t.Fatalf("wrong number of drifted resources %d; want 1", len(got.ResourceDrift))
+		}
+
+		drift := got.ResourceDrift[0]
+		if got, want := drift.Address, "test_thing.web"; got != want {
+			t.Errorf("wrong address %q; want %q", got, want)
+		}
+		if got := drift.Change.Actions; len(got) != 1 || got[0] != "update" {
+			t.Errorf("wrong actions %#v; want [\"update\"]", got)
+		}
+		assertJSONEqual(t, drift.Change.Before, []byte(`{"id":"i-abc","tags":{"env":"prod"}}`))
+		assertJSONEqual(t, drift.Change.After, []byte(`{"id":"i-abc","tags":{"env":"staging"}}`))
+	})
+
+	t.Run("refresh-only", func(t *testing.T) {
+		src, err := MarshallWithOptions(nil, &plans.Plan{Changes: plans.NewChanges()}, refreshed, schemas, MarshallOptions{
+			RecordedState: recorded,
+			RefreshOnly:   true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := got.PlanMode, "refresh-only"; got != want {
+			t.Errorf("wrong plan mode %q; want %q", got, want)
+		}
+		if len(got.ResourceDrift) != 1 || got.ResourceDrift[0].Address != "test_thing.web" {
+			t.Errorf("wrong resource drift %#v; want a change for test_thing.web", got.ResourceDrift)
+		}
+	})
+
+	t.Run("without recorded state", func(t *testing.T) {
+		got, err := MarshallToPlan(nil, &plans.Plan{Changes: plans.NewChanges()}, refreshed, schemas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.ResourceDrift) != 0 {
+			t.Errorf("unexpected resource drift %#v", got.ResourceDrift)
+		}
+	})
+}
+
+func TestDriftChanges_deleted(t *testing.T) {
+	provider := addrs.ProviderConfig{Type: "test"}.Absolute(addrs.RootModuleInstance)
+	addr := addrs.Resource{
+		Mode: addrs.ManagedResourceMode,
+		Type: "test_thing",
+		Name: "web",
+	}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance)
+
+	recorded := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(addr, &states.ResourceInstanceObjectSrc{
+			Status:    states.ObjectReady,
+			AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+		}, provider)
+	})
+
+	got, err := driftChanges(recorded, states.NewState(), testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("wrong number of changes %d; want 1", len(got))
+	}
+	if got[0].Action != plans.Delete {
+		t.Errorf("wrong action %s; want %s", got[0].Action, plans.Delete)
+	}
+	if !got[0].Addr.Equal(addr) {
+		t.Errorf("wrong address %s; want %s", got[0].Addr, addr)
+	}
+}
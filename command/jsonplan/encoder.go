@@ -0,0 +1,159 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PlanEncoder writes the json encoding of a plan incrementally, one resource
+// or output change at a time, for tools that produce a plan as it is being
+// computed. None of the changes are held in memory once written.
+//
+// The document has the metadata of a plan produced by this version of
+// Terraform, as for MergePlans, and only the changes that are written to it.
+// All of the resource changes must be written before any of the output
+// changes. Once an error has occurred, each later call returns it.
+type PlanEncoder struct {
+	w   io.Writer
+	enc *json.Encoder
+	err error
+
+	// section is the property whose value is currently being written, which
+	// is "" before the first change and after Close.
+	section string
+	closed  bool
+	outputs map[string]bool
+}
+
+// Open writes the start of the document to the given writer. It must be
+// called exactly once, before any of the other methods.
+func (e *PlanEncoder) Open(w io.Writer) error {
+	if e.w != nil {
+		return errors.New("plan encoder is already open")
+	}
+	e.w = w
+	e.enc = json.NewEncoder(w)
+	e.outputs = make(map[string]bool)
+
+	head, err := json.Marshal(newPlan())
+	if err != nil {
+		return e.fail(err)
+	}
+	// As in MarshallStream, the head is a non-empty object, so we can leave
+	// off its closing brace to write the remaining properties.
+	return e.write(bytes.TrimSuffix(head, []byte("}")))
+}
+
+// WriteResourceChange writes the given resource change, following those
+// already written.
+func (e *PlanEncoder) WriteResourceChange(rc ResourceChange) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if e.section == "output_changes" {
+		return e.fail(fmt.Errorf("resource change for %s written after output changes", rc.Address))
+	}
+	if err := e.startSection("resource_changes", "["); err != nil {
+		return err
+	}
+	return e.encode(rc)
+}
+
+// WriteOutputChange writes the change for the output value with the given
+// name. It is an error to write more than one change for the same output.
+func (e *PlanEncoder) WriteOutputChange(name string, c OutputChange) error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if e.outputs[name] {
+		return e.fail(fmt.Errorf("duplicate change for output %q", name))
+	}
+	e.outputs[name] = true
+
+	if err := e.startSection("output_changes", "{"); err != nil {
+		return err
+	}
+	key, err := json.Marshal(name)
+	if err != nil {
+		return e.fail(err)
+	}
+	if err := e.write(append(key, ':')); err != nil {
+		return err
+	}
+	return e.encode(c)
+}
+
+// Close writes the end of the document. The underlying writer is not
+// closed.
+func (e *PlanEncoder) Close() error {
+	if err := e.check(); err != nil {
+		return err
+	}
+	if err := e.endSection(); err != nil {
+		return err
+	}
+	e.closed = true
+	return e.write([]byte("}"))
+}
+
+func (e *PlanEncoder) check() error {
+	switch {
+	case e.err != nil:
+		return e.err
+	case e.w == nil:
+		return errors.New("plan encoder is not open")
+	case e.closed:
+		return errors.New("plan encoder is closed")
+	}
+	return nil
+}
+
+// startSection begins the value of the given property, with the given opening
+// delimiter, unless it has already begun, and otherwise writes the separator
+// before the next element.
+func (e *PlanEncoder) startSection(name, open string) error {
+	if e.section == name {
+		return e.write([]byte(","))
+	}
+	if err := e.endSection(); err != nil {
+		return err
+	}
+	e.section = name
+	return e.write([]byte(fmt.Sprintf(",%q:%s", name, open)))
+}
+
+func (e *PlanEncoder) endSection() error {
+	var end string
+	switch e.section {
+	case "resource_changes":
+		end = "]"
+	case "output_changes":
+		end = "}"
+	default:
+		return nil
+	}
+	e.section = ""
+	return e.write([]byte(end))
+}
+
+func (e *PlanEncoder) encode(v interface{}) error {
+	if err := e.enc.Encode(v); err != nil {
+		return e.fail(err)
+	}
+	return nil
+}
+
+func (e *PlanEncoder) write(p []byte) error {
+	if _, err := e.w.Write(p); err != nil {
+		return e.fail(err)
+	}
+	return nil
+}
+
+func (e *PlanEncoder) fail(err error) error {
+	e.err = err
+	return err
+}
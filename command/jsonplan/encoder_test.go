@@ -0,0 +1,115 @@
+package jsonplan
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPlanEncoder_empty(t *testing.T) {
+	var buf bytes.Buffer
+	var e PlanEncoder
+	if err := e.Open(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("invalid document %s: %s", buf.Bytes(), err)
+	}
+	if got.FormatVersion != FormatVersion {
+		t.Errorf("wrong format version %q; want %q", got.FormatVersion, FormatVersion)
+	}
+	if len(got.ResourceChanges) != 0 || len(got.OutputChanges) != 0 {
+		t.Errorf("unexpected changes in %s", buf.Bytes())
+	}
+}
+
+func TestPlanEncoder(t *testing.T) {
+	changes := []ResourceChange{
+		{
+			Address: "test_thing.a",
+			Mode:    ManagedResourceMode,
+			Type:    "test_thing",
+			Name:    "a",
+			Change: Change{
+				Actions: []string{"create"},
+				After:   []byte(`{"ami":"ami-123"}`),
+			},
+		},
+		{
+			Address: "test_thing.b",
+			Mode:    ManagedResourceMode,
+			Type:    "test_thing",
+			Name:    "b",
+			Change: Change{
+				Actions: []string{"delete"},
+				Before:  []byte(`{"ami":"ami-456"}`),
+			},
+		},
+	}
+	outputs := map[string]OutputChange{
+		"a_id": {Change: Change{Actions: []string{"create"}, After: []byte(`"i-abc"`)}},
+		"b_id": {Change: Change{Actions: []string{"delete"}, Before: []byte(`"i-def"`)}},
+	}
+
+	var buf bytes.Buffer
+	var e PlanEncoder
+	if err := e.Open(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, rc := range changes {
+		if err := e.WriteResourceChange(rc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a_id", "b_id"} {
+		if err := e.WriteOutputChange(name, outputs[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("invalid document %s: %s", buf.Bytes(), err)
+	}
+
+	// The cache of decoded values that Parse gives each change is not part
+	// of the document.
+	for i := range got.ResourceChanges {
+		got.ResourceChanges[i].Change.decoded = nil
+	}
+	for name, oc := range got.OutputChanges {
+		oc.Change.decoded = nil
+		got.OutputChanges[name] = oc
+	}
+	if !reflect.DeepEqual(got.ResourceChanges, changes) {
+		t.Errorf("wrong resource changes\ngot:  %#v\nwant: %#v", got.ResourceChanges, changes)
+	}
+	if !reflect.DeepEqual(got.OutputChanges, outputs) {
+		t.Errorf("wrong output changes\ngot:  %#v\nwant: %#v", got.OutputChanges, outputs)
+	}
+}
+
+func TestPlanEncoder_order(t *testing.T) {
+	var buf bytes.Buffer
+	var e PlanEncoder
+	if err := e.Open(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteOutputChange("id", OutputChange{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteResourceChange(ResourceChange{Address: "test_thing.a"}); err == nil {
+		t.Fatal("succeeded; want error")
+	}
+	if err := e.Close(); err == nil {
+		t.Error("close succeeded after error")
+	}
+}
@@ -0,0 +1,74 @@
+package jsonplan
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+)
+
+// PlanError describes a problem that prevented part of a plan from being
+// rendered. The rest of the plan is still rendered as far as possible, so
+// that callers can present a partial plan along with a list of what could
+// not be resolved.
+type PlanError struct {
+	// Address is the absolute address of the object that could not be
+	// rendered. Omitted if the problem does not relate to a particular
+	// object.
+	Address string `json:"address,omitempty"`
+
+	Summary string `json:"summary"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func (e PlanError) Error() string {
+	if e.Address == "" {
+		return fmt.Sprintf("%s: %s", e.Summary, e.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Address, e.Summary, e.Detail)
+}
+
+// missingSchemaError returns the error reported for a resource whose schema
+// is not available.
+func missingSchemaError(address, providerName, resourceType string) PlanError {
+	return PlanError{
+		Address: address,
+		Summary: "Missing resource type schema",
+		Detail: fmt.Sprintf(
+			"The schema for resource type %q of provider %q is not available, so the values of %s cannot be decoded.",
+			resourceType, providerName, address,
+		),
+	}
+}
+
+// preventDestroyViolation returns the violation reported for the given change
+// if it would destroy the current object of a resource instance whose
+// configuration sets the prevent_destroy lifecycle argument, matching the
+// error that Terraform reports for it during planning. The result is false
+// if there is no violation, or if the configuration is not available.
+func preventDestroyViolation(rc *plans.ResourceInstanceChangeSrc, config *configs.Config) (PlanError, bool) {
+	if config == nil || rc.DeposedKey != states.NotDeposed {
+		return PlanError{}, false
+	}
+	if rc.Action != plans.Delete && !rc.Action.IsReplace() {
+		return PlanError{}, false
+	}
+	modCfg := config.DescendentForInstance(rc.Addr.Module)
+	if modCfg == nil {
+		return PlanError{}, false
+	}
+	r := modCfg.Module.ResourceByAddr(rc.Addr.Resource.Resource)
+	if r == nil || r.Managed == nil || !r.Managed.PreventDestroy {
+		return PlanError{}, false
+	}
+
+	return PlanError{
+		Address: rc.Addr.String(),
+		Summary: "Instance cannot be destroyed",
+		Detail: fmt.Sprintf(
+			"Resource %s has lifecycle.prevent_destroy set, but the plan calls for this resource to be destroyed. To avoid this error and continue with the plan, either disable lifecycle.prevent_destroy or reduce the scope of the plan using the -target flag.",
+			rc.Addr.String(),
+		),
+	}, true
+}
@@ -0,0 +1,213 @@
+package jsonplan
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/lang"
+	"github.com/hashicorp/terraform/plans"
+)
+
+// marshalModuleCallValues sets the CountValue and ForEachKeys of the module
+// calls throughout the configuration, as far as the values of their count
+// and for_each arguments can be determined from the plan's input variable
+// values alone.
+func (p *Plan) marshalModuleCallValues(config *configs.Config, vars map[string]plans.DynamicValue) {
+	if config == nil {
+		return
+	}
+
+	varVals := make(map[string]cty.Value, len(vars))
+	for name, dv := range vars {
+		v, err := dv.Decode(cty.DynamicPseudoType)
+		if err != nil {
+			continue
+		}
+		varVals[name] = v
+	}
+	setModuleCallValues(config, varVals, &p.Config.RootModule)
+}
+
+// setModuleCallValues sets the CountValue and ForEachKeys of the module calls
+// of the given module, whose representation is m, and then of those of the
+// modules they call, given the values of the module's input variables that
+// are known.
+func setModuleCallValues(config *configs.Config, varVals map[string]cty.Value, m *ConfigModule) {
+	ctx := staticEvalContext(config.Module, varVals)
+
+	// The module calls are in the order of their names, as produced by
+	// marshalConfigModule.
+	for i, name := range sortedModuleCallNames(config.Module) {
+		mc := config.Module.ModuleCalls[name]
+		call := &m.ModuleCalls[i]
+		if v, ok := staticValue(mc.Count, ctx); ok {
+			call.CountValue = countValue(v)
+		}
+		if v, ok := staticValue(mc.ForEach, ctx); ok {
+			call.ForEachKeys = forEachKeys(v)
+		}
+
+		child := config.Children[name]
+		if child == nil || call.Module == nil {
+			continue
+		}
+		setModuleCallValues(child, moduleCallInputs(mc, child.Module, ctx), call.Module)
+	}
+}
+
+// staticEvalContext returns a context for staticValue in the given module,
+// with the given input variable values and those of the module's local values
+// that can be evaluated from them.
+func staticEvalContext(mod *configs.Module, varVals map[string]cty.Value) *hcl.EvalContext {
+	scope := &lang.Scope{
+		BaseDir:  mod.SourceDir,
+		PureOnly: true,
+	}
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var":   cty.ObjectVal(varVals),
+			"local": cty.EmptyObjectVal,
+		},
+		Functions: scope.Functions(),
+	}
+
+	// Local values may refer to one another, so we repeat until no further
+	// local values can be evaluated.
+	localVals := make(map[string]cty.Value)
+	for changed := true; changed; {
+		changed = false
+		for name, l := range mod.Locals {
+			if _, done := localVals[name]; done {
+				continue
+			}
+			if v, ok := staticValue(l.Expr, ctx); ok {
+				localVals[name] = v
+				ctx.Variables["local"] = cty.ObjectVal(localVals)
+				changed = true
+			}
+		}
+	}
+	return ctx
+}
+
+// moduleCallInputs returns the values of the input variables of the given
+// called module that can be determined statically in the given context of
+// the calling module: those set by an argument of the module call for which
+// staticValue succeeds, and the defaults of those that aren't set.
+func moduleCallInputs(mc *configs.ModuleCall, mod *configs.Module, ctx *hcl.EvalContext) map[string]cty.Value {
+	var attrs hcl.Attributes
+	if mc.Config != nil {
+		attrs, _ = mc.Config.JustAttributes()
+	}
+
+	ret := make(map[string]cty.Value)
+	for name, v := range mod.Variables {
+		attr, ok := attrs[name]
+		if !ok {
+			if v.Default != cty.NilVal {
+				ret[name] = v.Default
+			}
+			continue
+		}
+		val, ok := staticValue(attr.Expr, ctx)
+		if !ok {
+			continue
+		}
+		if v.Type != cty.NilType {
+			var err error
+			val, err = convert.Convert(val, v.Type)
+			if err != nil {
+				continue
+			}
+		}
+		ret[name] = val
+	}
+	return ret
+}
+
+// sortedModuleCallNames returns the names of the module calls of the given
+// module, sorted.
+func sortedModuleCallNames(m *configs.Module) []string {
+	names := make([]string, 0, len(m.ModuleCalls))
+	for name := range m.ModuleCalls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// staticValue evaluates the given expression if it refers to nothing other
+// than input variables and local values, whose known values are given in the
+// context along with the pure functions. The result is false if the
+// expression is nil, refers to anything else, or can't be evaluated to a
+// wholly-known value.
+func staticValue(expr hcl.Expression, ctx *hcl.EvalContext) (cty.Value, bool) {
+	if expr == nil {
+		return cty.NilVal, false
+	}
+	refs, diags := lang.ReferencesInExpr(expr)
+	if diags.HasErrors() {
+		return cty.NilVal, false
+	}
+	for _, ref := range refs {
+		switch ref.Subject.(type) {
+		case addrs.InputVariable, addrs.LocalValue:
+		default:
+			return cty.NilVal, false
+		}
+	}
+
+	v, hclDiags := expr.Value(ctx)
+	if hclDiags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
+
+// countValue returns the given count argument value as an int, or nil if it
+// is not a valid count.
+func countValue(v cty.Value) *int {
+	if v.Type() != cty.Number {
+		return nil
+	}
+	bf := v.AsBigFloat()
+	if !bf.IsInt() || bf.Sign() < 0 {
+		return nil
+	}
+	i, acc := bf.Int64()
+	if acc != big.Exact || int64(int(i)) != i {
+		return nil
+	}
+	ret := int(i)
+	return &ret
+}
+
+// forEachKeys returns the sorted instance keys given by the given for_each
+// argument value, which is a map or object whose attributes are the keys or a
+// set of strings. The result is nil for any other value.
+func forEachKeys(v cty.Value) []string {
+	ty := v.Type()
+	var ret []string
+	switch {
+	case ty.IsMapType() || ty.IsObjectType():
+		for it := v.ElementIterator(); it.Next(); {
+			k, _ := it.Element()
+			ret = append(ret, k.AsString())
+		}
+	case ty.IsSetType() && ty.ElementType() == cty.String:
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			ret = append(ret, elem.AsString())
+		}
+	default:
+		return nil
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,270 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/lang"
+)
+
+// Expression represents any unparsed expression
+type Expression struct {
+	// "constant_value" is set only if the expression contains no references to
+	// other objects, in which case it gives the resulting constant value. This
+	// is mapped as for the individual values in the common value mapping. It
+	// is omitted for arguments that the schema marks as sensitive.
+	ConstantValue json.RawMessage `json:"constant_value,omitempty"`
+
+	// Alternatively, "references" will be set to a list of references in the
+	// expression. Multi-step references will be unwrapped and duplicated for
+	// each significant traversal step, allowing callers to more easily
+	// recognize the objects they care about without attempting to parse the
+	// expressions. Callers should only use string equality checks here, since
+	// the syntax may be extended in future releases.
+	References []string `json:"references,omitempty"`
+
+	// "source" is an object describing the source span of this expression in
+	// the configuration. Callers might use this, for example, to extract a raw
+	// source code snippet for display purposes.
+	Source Source `json:"source,omitempty"`
+
+	// Raw is the source text of the expression exactly as written in the
+	// configuration, such as `"${var.env}-web"`. It is omitted if
+	// ConstantValue is set, for arguments that the schema marks as sensitive,
+	// or if the source is not available.
+	Raw string `json:"raw,omitempty"`
+
+	// Blocks is set instead of the above when this entry describes a nested
+	// block type rather than an attribute. It holds the expressions of each
+	// block of that type, in the order they appear in configuration.
+	Blocks []Expressions `json:"blocks,omitempty"`
+
+	// sensitive is set for the expressions of sensitive arguments, so that
+	// setRaw doesn't reveal their source text.
+	sensitive bool
+}
+
+// Expressions is a map of attribute names to their expressions.
+type Expressions map[string]Expression
+
+// Source describes the location of an expression in the configuration.
+type Source struct {
+	FileName string `json:"filename,omitempty"`
+	Start    Pos    `json:"start"`
+	End      Pos    `json:"end"`
+}
+
+// Pos is a single position within a configuration file. Line and Column
+// count from one, while Byte is the zero-based byte offset from the start of
+// the file. The End position of a Source is just after its final character.
+type Pos struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Byte   int `json:"byte"`
+}
+
+// marshalExpression returns the representation of the given expression.
+// References are relative to the module the expression belongs to, exactly as
+// written in the configuration.
+func marshalExpression(expr hcl.Expression) Expression {
+	var ret Expression
+	if expr == nil {
+		return ret
+	}
+
+	rng := expr.Range()
+	ret.Source = Source{
+		FileName: rng.Filename,
+		Start:    marshalPos(rng.Start),
+		End:      marshalPos(rng.End),
+	}
+
+	if len(expr.Variables()) == 0 {
+		// The expression may still fail to evaluate without an evaluation
+		// context, such as if it calls functions, in which case we just leave
+		// the constant value unset.
+		val, diags := expr.Value(nil)
+		if !diags.HasErrors() && val.IsWhollyKnown() {
+			if raw, err := ctyjson.Marshal(val, val.Type()); err == nil {
+				ret.ConstantValue = json.RawMessage(raw)
+			}
+		}
+		return ret
+	}
+
+	// Any errors here would also have been reported when the configuration was
+	// loaded, so we just describe whatever references we were able to find.
+	refs, _ := lang.ReferencesInExpr(expr)
+
+	seen := make(map[string]bool)
+	add := func(ref string) {
+		if !seen[ref] {
+			seen[ref] = true
+			ret.References = append(ret.References, ref)
+		}
+	}
+	for _, ref := range refs {
+		// We work backwards from the full reference, unwrapping the remaining
+		// traversal one step at a time until we reach the referenced object
+		// itself.
+		for remain := ref.Remaining; len(remain) > 0; remain = remain[:len(remain)-1] {
+			add(ref.Subject.String() + traversalString(remain))
+		}
+		add(ref.Subject.String())
+
+		switch subject := ref.Subject.(type) {
+		case addrs.ResourceInstance:
+			add(subject.ContainingResource().String())
+		case addrs.ModuleCallOutput:
+			add(subject.Call.String())
+			add(subject.Call.Call.String())
+		}
+	}
+
+	return ret
+}
+
+// setRaw sets the Raw field of the expression from the given source files,
+// keyed by filename, if the expression has no constant value and is not that
+// of a sensitive argument.
+func (e *Expression) setRaw(sources map[string][]byte) {
+	if e == nil || e.ConstantValue != nil || e.sensitive {
+		return
+	}
+	src, ok := sources[e.Source.FileName]
+	if !ok {
+		return
+	}
+	start, end := e.Source.Start.Byte, e.Source.End.Byte
+	if start < 0 || start > end || end > len(src) {
+		return
+	}
+	e.Raw = string(src[start:end])
+}
+
+// setRaw sets the Raw field of each of the expressions, including those of
+// any nested blocks, as described for Expression.setRaw.
+func (es Expressions) setRaw(sources map[string][]byte) {
+	for name, e := range es {
+		for _, block := range e.Blocks {
+			block.setRaw(sources)
+		}
+		if e.Blocks == nil {
+			e.setRaw(sources)
+		}
+		es[name] = e
+	}
+}
+
+// marshalOptionalExpression is a variant of marshalExpression for optional
+// arguments, returning nil if the given expression is not set.
+func marshalOptionalExpression(expr hcl.Expression) *Expression {
+	if expr == nil {
+		return nil
+	}
+	ret := marshalExpression(expr)
+	return &ret
+}
+
+func marshalPos(pos hcl.Pos) Pos {
+	return Pos{
+		Line:   pos.Line,
+		Column: pos.Column,
+		Byte:   pos.Byte,
+	}
+}
+
+// marshalExpressions returns the expressions of each of the attributes and
+// nested blocks of the given body that are described by the given schema.
+// The constant values of the attributes that the schema marks as sensitive
+// are omitted.
+func marshalExpressions(body hcl.Body, schema *configschema.Block) Expressions {
+	if body == nil || schema == nil {
+		return nil
+	}
+
+	// We want the raw, unevaluated expressions, so we must use the low-level
+	// HCL API here, rather than decoding with the schema's decoder spec.
+	// Anything else in the body, such as "dynamic" blocks, is ignored.
+	content, _, _ := body.PartialContent(hcldec.ImpliedSchema(schema.DecoderSpec()))
+	if content == nil {
+		return nil
+	}
+
+	ret := make(Expressions)
+	for name, attr := range content.Attributes {
+		expr := marshalExpression(attr.Expr)
+		if attrS := schema.Attributes[name]; attrS != nil && attrS.Sensitive {
+			expr.ConstantValue = nil
+			expr.sensitive = true
+		}
+		ret[name] = expr
+	}
+	for _, block := range content.Blocks {
+		blockS, ok := schema.BlockTypes[block.Type]
+		if !ok {
+			continue
+		}
+		expr := ret[block.Type]
+		expr.Blocks = append(expr.Blocks, marshalExpressions(block.Body, &blockS.Block))
+		ret[block.Type] = expr
+	}
+
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// marshalAttributeExpressions is a variant of marshalExpressions for bodies
+// that have no schema, such as the arguments of a module call, whose content
+// can only be attributes.
+func marshalAttributeExpressions(body hcl.Body) Expressions {
+	if body == nil {
+		return nil
+	}
+
+	attrs, _ := body.JustAttributes()
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	ret := make(Expressions, len(attrs))
+	for name, attr := range attrs {
+		ret[name] = marshalExpression(attr.Expr)
+	}
+	return ret
+}
+
+// traversalString returns the configuration syntax for the given relative
+// traversal, such as `.id` or `[0].name`.
+func traversalString(traversal hcl.Traversal) string {
+	var buf bytes.Buffer
+	for _, step := range traversal {
+		switch step := step.(type) {
+		case hcl.TraverseAttr:
+			buf.WriteByte('.')
+			buf.WriteString(step.Name)
+		case hcl.TraverseIndex:
+			buf.WriteByte('[')
+			switch {
+			case step.Key.Type() == cty.String && step.Key.IsKnown():
+				fmt.Fprintf(&buf, "%q", step.Key.AsString())
+			case step.Key.Type() == cty.Number && step.Key.IsKnown():
+				buf.WriteString(step.Key.AsBigFloat().Text('f', -1))
+			default:
+				buf.WriteString("...")
+			}
+			buf.WriteByte(']')
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,209 @@
+package jsonplan
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/lang"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// MarshallFiltered is a variant of Marshall that includes only the parts of
+// the plan that concern the given targets, each of which is a module or
+// resource address in the same syntax as the -target command line option, or
+// a pattern containing wildcards as accepted by MatchAddress.
+//
+// The resource changes and planned values include only the resource instances
+// that are either addressed by or contained within one of the targets. Output
+// changes are included unless the output's expression refers only to
+// resources and modules that are excluded, which requires the configuration
+// snapshot; without it, all output changes are included. The prior state and
+// configuration are not filtered, and nor is the plan if no targets are given.
+func MarshallFiltered(
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+	targets []string,
+) ([]byte, error) {
+	return MarshallWithOptions(c, p, s, schemas, MarshallOptions{Targets: targets})
+}
+
+// targetSet is the parsed form of the targets given to MarshallFiltered.
+type targetSet struct {
+	addrs    []addrs.Targetable
+	patterns []addressPattern
+}
+
+func (t targetSet) empty() bool {
+	return len(t.addrs) == 0 && len(t.patterns) == 0
+}
+
+// contains returns true if any of the targets contains or, for a pattern,
+// matches the given resource instance address.
+func (t targetSet) contains(addr addrs.AbsResourceInstance) bool {
+	if targetsContain(t.addrs, addr) {
+		return true
+	}
+	if len(t.patterns) == 0 {
+		return false
+	}
+	a, err := ParseAddress(addr.String())
+	if err != nil {
+		return false
+	}
+	for _, p := range t.patterns {
+		if p.match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTargets parses the given target addresses and patterns, as given to
+// MarshallFiltered.
+func parseTargets(targets []string) (targetSet, error) {
+	var ret targetSet
+	for _, str := range targets {
+		if isAddressPattern(str) {
+			p, err := parseAddressPattern(str)
+			if err != nil {
+				return ret, fmt.Errorf("invalid target %q: %s", str, err)
+			}
+			ret.patterns = append(ret.patterns, p)
+			continue
+		}
+
+		target, diags := addrs.ParseTargetStr(str)
+		if diags.HasErrors() {
+			return ret, fmt.Errorf("invalid target %q: %s", str, diags.Err())
+		}
+		ret.addrs = append(ret.addrs, target.Subject)
+	}
+	return ret, nil
+}
+
+// filterChanges returns a copy of the given changes that includes only the
+// changes relevant to the given targets, as described for MarshallFiltered.
+// The given configuration may be nil.
+func filterChanges(changes *plans.Changes, config *configs.Config, targets targetSet) *plans.Changes {
+	ret := plans.NewChanges()
+
+	// A pattern has no address to compare with an output's references, so
+	// outputs are instead compared with the resource instances it matches.
+	var matched []addrs.Targetable
+	for _, rc := range changes.Resources {
+		if targets.contains(rc.Addr) {
+			ret.Resources = append(ret.Resources, rc)
+			if !targetsContain(targets.addrs, rc.Addr) {
+				matched = append(matched, rc.Addr)
+			}
+		}
+	}
+
+	for _, oc := range changes.Outputs {
+		if !oc.Addr.Module.IsRoot() || config == nil {
+			ret.Outputs = append(ret.Outputs, oc)
+			continue
+		}
+
+		output, ok := config.Module.Outputs[oc.Addr.OutputValue.Name]
+		if !ok {
+			ret.Outputs = append(ret.Outputs, oc)
+			continue
+		}
+
+		// Any errors here would also have been reported when the
+		// configuration was loaded, so we just consider whatever references we
+		// were able to find.
+		refs, _ := lang.ReferencesInExpr(output.Expr)
+		deps := referencedTargetables(refs)
+		if len(deps) == 0 {
+			// An output that doesn't depend on any resources is relevant
+			// regardless of which resources are targeted.
+			ret.Outputs = append(ret.Outputs, oc)
+			continue
+		}
+		for _, dep := range deps {
+			if targetsOverlap(targets.addrs, dep) || targetsOverlap(matched, dep) {
+				ret.Outputs = append(ret.Outputs, oc)
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// referencedTargetables returns the absolute addresses of the resources,
+// resource instances and module instances referred to by the given references,
+// which must be from the root module. Other references are ignored.
+func referencedTargetables(refs []*addrs.Reference) []addrs.Targetable {
+	var ret []addrs.Targetable
+	for _, ref := range refs {
+		switch subject := ref.Subject.(type) {
+		case addrs.Resource:
+			ret = append(ret, subject.Absolute(addrs.RootModuleInstance))
+		case addrs.ResourceInstance:
+			if subject.Key == addrs.NoKey {
+				// A reference without an instance key, such as in a splat
+				// expression, may refer to all of the instances of the
+				// resource.
+				ret = append(ret, subject.ContainingResource().Absolute(addrs.RootModuleInstance))
+				continue
+			}
+			ret = append(ret, subject.Absolute(addrs.RootModuleInstance))
+		case addrs.ModuleCallInstance:
+			ret = append(ret, subject.ModuleInstance(addrs.RootModuleInstance))
+		case addrs.ModuleCallOutput:
+			ret = append(ret, subject.Call.ModuleInstance(addrs.RootModuleInstance))
+		}
+	}
+	return ret
+}
+
+// targetsContain returns true if any of the given targets contains the given
+// address.
+func targetsContain(targets []addrs.Targetable, addr addrs.Targetable) bool {
+	for _, target := range targets {
+		if target.TargetContains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetsOverlap returns true if any of the given targets either contains or
+// is contained by the given address, such as when a reference to a whole
+// resource is compared with a target addressing only one of its instances.
+func targetsOverlap(targets []addrs.Targetable, addr addrs.Targetable) bool {
+	for _, target := range targets {
+		if target.TargetContains(addr) || addr.TargetContains(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterDeposed removes the deposed objects of the planned values and proposed
+// unknown values whose resource instances are not relevant to the given
+// targets, since the plan's changes for those have been filtered out.
+func (p *Plan) filterDeposed(targets targetSet) {
+	filter := func(_ string, m *Module) error {
+		var kept []Resource
+		for _, r := range m.Deposed {
+			addr, diags := addrs.ParseAbsResourceInstanceStr(r.Address)
+			if !diags.HasErrors() && targets.contains(addr) {
+				kept = append(kept, r)
+			}
+		}
+		m.Deposed = kept
+		return nil
+	}
+	walkModule(&p.PlannedValues.RootModule, filter)
+	walkModule(&p.ProposedUnknown.RootModule, filter)
+}
@@ -0,0 +1,165 @@
+package jsonplan
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshallFiltered(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_thing" "web" {
+  count = 2
+  ami   = "ami-123"
+}
+
+module "net" {
+  source = "./net"
+}
+
+output "first_id" {
+  value = test_thing.web[0].id
+}
+
+output "second_id" {
+  value = test_thing.web[1].id
+}
+
+output "web_ids" {
+  value = test_thing.web.*.id
+}
+
+output "net_id" {
+  value = module.net.id
+}
+
+output "static" {
+  value = "hello"
+}
+`,
+		"net": `
+resource "test_thing" "db" {
+  ami = "ami-456"
+}
+
+output "id" {
+  value = test_thing.db.id
+}
+`,
+	})
+
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	netModule := addrs.RootModuleInstance.Child("net", addrs.NoKey)
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.IntKey(0), plans.Create, cty.NullVal(testThingType), after),
+				testResourceChange(t, "web", addrs.IntKey(1), plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, netModule, "db", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "first_id", plans.Create, cty.NilVal, cty.StringVal("i-abc")),
+				testOutputChange(t, "second_id", plans.Create, cty.NilVal, cty.StringVal("i-abc")),
+				testOutputChange(t, "web_ids", plans.Create, cty.NilVal, cty.ListVal([]cty.Value{cty.StringVal("i-abc"), cty.StringVal("i-abc")})),
+				testOutputChange(t, "net_id", plans.Create, cty.NilVal, cty.StringVal("i-abc")),
+				testOutputChange(t, "static", plans.Create, cty.NilVal, cty.StringVal("hello")),
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		targets       []string
+		wantResources []string
+		wantOutputs   []string
+	}{
+		"whole module": {
+			[]string{"module.net"},
+			[]string{"module.net.test_thing.db"},
+			[]string{"net_id", "static"},
+		},
+		"single instance": {
+			[]string{"test_thing.web[1]"},
+			[]string{"test_thing.web[1]"},
+			[]string{"second_id", "static", "web_ids"},
+		},
+		"whole resource": {
+			[]string{"test_thing.web"},
+			[]string{"test_thing.web[0]", "test_thing.web[1]"},
+			[]string{"first_id", "second_id", "static", "web_ids"},
+		},
+		"several targets": {
+			[]string{"test_thing.web[0]", "module.net"},
+			[]string{"test_thing.web[0]", "module.net.test_thing.db"},
+			[]string{"first_id", "net_id", "static", "web_ids"},
+		},
+		"instance pattern": {
+			[]string{"test_thing.web[*]"},
+			[]string{"test_thing.web[0]", "test_thing.web[1]"},
+			[]string{"first_id", "second_id", "static", "web_ids"},
+		},
+		"module pattern": {
+			[]string{"module.*.*"},
+			[]string{"module.net.test_thing.db"},
+			[]string{"net_id", "static"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			src, err := MarshallFiltered(snap, plan, nil, testSchemas(), test.targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotChanges []string
+			for _, rc := range got.ResourceChanges {
+				gotChanges = append(gotChanges, rc.Address)
+			}
+			if !reflect.DeepEqual(gotChanges, test.wantResources) {
+				t.Errorf("wrong resource changes\ngot:  %#v\nwant: %#v", gotChanges, test.wantResources)
+			}
+
+			var gotValues []string
+			modules := []Module{got.PlannedValues.RootModule}
+			for len(modules) > 0 {
+				module := modules[0]
+				modules = append(modules[1:], module.ChildModules...)
+				for _, r := range module.Resources {
+					gotValues = append(gotValues, r.Address)
+				}
+			}
+			if !reflect.DeepEqual(gotValues, test.wantResources) {
+				t.Errorf("wrong planned values\ngot:  %#v\nwant: %#v", gotValues, test.wantResources)
+			}
+
+			var gotOutputs []string
+			for name := range got.OutputChanges {
+				gotOutputs = append(gotOutputs, name)
+			}
+			sort.Strings(gotOutputs)
+			if !reflect.DeepEqual(gotOutputs, test.wantOutputs) {
+				t.Errorf("wrong output changes\ngot:  %#v\nwant: %#v", gotOutputs, test.wantOutputs)
+			}
+		})
+	}
+}
+
+func TestMarshallFiltered_invalidTarget(t *testing.T) {
+	_, err := MarshallFiltered(nil, nil, nil, testSchemas(), []string{"not a target"})
+	if err == nil {
+		t.Fatal("succeeded; want error")
+	}
+}
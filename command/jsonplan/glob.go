@@ -0,0 +1,211 @@
+package jsonplan
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MatchAddress returns true if the given absolute resource instance address
+// matches the given pattern, which is written as an address in which any
+// module call name, resource type or resource name may contain * wildcards,
+// as for path.Match, and any instance key may be [*] to match any key or
+// none. For example, `module.app[*].aws_instance.*` matches each instance of
+// each aws_instance resource in each instance of module.app.
+//
+// A resource part that is just * matches any resource in the module, of
+// either mode, so `module.app.*` matches every resource instance directly
+// within module.app. Each wildcard matches within a single step of the
+// address, so a pattern only matches resources in nested modules if it
+// includes a step for each module call, and a step whose key is omitted from
+// the pattern matches only a step with no key, other than a name that is
+// just *, which matches any key.
+//
+// The result is false if either the pattern or the address is invalid.
+func MatchAddress(pattern, addr string) bool {
+	p, err := parseAddressPattern(pattern)
+	if err != nil {
+		return false
+	}
+	a, err := ParseAddress(addr)
+	if err != nil {
+		return false
+	}
+	return p.match(a)
+}
+
+// addressPattern is a parsed MatchAddress pattern.
+type addressPattern struct {
+	module []stepPattern
+
+	// anyResource is set if the resource part of the pattern is just *, in
+	// which case the remaining fields are unused.
+	anyResource bool
+
+	mode ResourceMode
+	typ  string
+	name stepPattern
+}
+
+// stepPattern is a name pattern with an instance key pattern, which is nil
+// for no key, anyKey for [*], or an int or string for a literal key.
+type stepPattern struct {
+	name string
+	key  interface{}
+}
+
+type anyKeyType struct{}
+
+var anyKey = anyKeyType{}
+
+func (p addressPattern) match(a Address) bool {
+	if len(p.module) != len(a.Module) {
+		return false
+	}
+	for i, step := range p.module {
+		if !step.match(a.Module[i].Name, a.Module[i].Key) {
+			return false
+		}
+	}
+	if p.anyResource {
+		return true
+	}
+	if p.mode != a.Mode {
+		return false
+	}
+	if ok, _ := path.Match(p.typ, a.Type); !ok {
+		return false
+	}
+	return p.name.match(a.Name, a.Key)
+}
+
+func (p stepPattern) match(name string, key interface{}) bool {
+	if ok, _ := path.Match(p.name, name); !ok {
+		return false
+	}
+	if p.key == anyKey || (p.key == nil && p.name == "*") {
+		return true
+	}
+	return p.key == key
+}
+
+// isAddressPattern returns true if the given string contains any wildcards,
+// and so should be treated as a pattern rather than as an address.
+func isAddressPattern(s string) bool {
+	return strings.Contains(s, "*")
+}
+
+func parseAddressPattern(s string) (addressPattern, error) {
+	var ret addressPattern
+	parts, err := splitAddressPattern(s)
+	if err != nil {
+		return ret, err
+	}
+
+	for len(parts) >= 2 && parts[0].name == "module" && parts[0].key == nil {
+		ret.module = append(ret.module, parts[1])
+		parts = parts[2:]
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0].name == "*" && parts[0].key == nil:
+		ret.anyResource = true
+		return ret, nil
+	case len(parts) == 3 && parts[0].name == "data" && parts[0].key == nil && parts[1].key == nil:
+		ret.mode = DataResourceMode
+		parts = parts[1:]
+	case len(parts) == 2 && parts[0].key == nil:
+		ret.mode = ManagedResourceMode
+	default:
+		return ret, fmt.Errorf("invalid address pattern %q", s)
+	}
+	for _, part := range parts {
+		if _, err := path.Match(part.name, ""); err != nil {
+			return ret, fmt.Errorf("invalid address pattern %q: %s", s, err)
+		}
+	}
+	ret.typ = parts[0].name
+	ret.name = parts[1]
+	return ret, nil
+}
+
+// splitAddressPattern splits the given pattern into its dot-separated steps,
+// with any instance key of each.
+func splitAddressPattern(s string) ([]stepPattern, error) {
+	var ret []stepPattern
+	for len(s) > 0 {
+		end := strings.IndexAny(s, ".[")
+		if end < 0 {
+			end = len(s)
+		}
+		step := stepPattern{name: s[:end]}
+		if step.name == "" {
+			return nil, errors.New("empty step in address pattern")
+		}
+		s = s[end:]
+
+		if strings.HasPrefix(s, "[") {
+			close := closingBracket(s)
+			if close < 0 {
+				return nil, errors.New("unterminated instance key in address pattern")
+			}
+			key, err := parseKeyPattern(strings.TrimSpace(s[1:close]))
+			if err != nil {
+				return nil, err
+			}
+			step.key = key
+			s = s[close+1:]
+		}
+		ret = append(ret, step)
+
+		if len(s) > 0 {
+			if s[0] != '.' {
+				return nil, errors.New("expected a dot after instance key in address pattern")
+			}
+			s = s[1:]
+			if len(s) == 0 {
+				return nil, errors.New("address pattern ends with a dot")
+			}
+		}
+	}
+	return ret, nil
+}
+
+// closingBracket returns the index of the bracket that closes the instance
+// key at the start of the given string, skipping over any quoted string, or
+// -1 if there is none.
+func closingBracket(s string) int {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseKeyPattern(s string) (interface{}, error) {
+	switch {
+	case s == "*":
+		return anyKey, nil
+	case strings.HasPrefix(s, `"`):
+		key, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid instance key %s in address pattern", s)
+		}
+		return key, nil
+	default:
+		key, err := strconv.Atoi(s)
+		if err != nil || key < 0 {
+			return nil, fmt.Errorf("invalid instance key %s in address pattern", s)
+		}
+		return key, nil
+	}
+}
@@ -0,0 +1,53 @@
+package jsonplan
+
+import (
+	"testing"
+)
+
+func TestMatchAddress(t *testing.T) {
+	tests := []struct {
+		pattern string
+		addr    string
+		want    bool
+	}{
+		{`aws_instance.web`, `aws_instance.web`, true},
+		{`aws_instance.web`, `aws_instance.web[0]`, false},
+		{`aws_instance.web[*]`, `aws_instance.web[0]`, true},
+		{`aws_instance.web[*]`, `aws_instance.web["a"]`, true},
+		{`aws_instance.web[*]`, `aws_instance.web`, true},
+		{`aws_instance.web[*]`, `aws_instance.db[0]`, false},
+		{`aws_instance.web["a"]`, `aws_instance.web["a"]`, true},
+		{`aws_instance.web["a"]`, `aws_instance.web["b"]`, false},
+		{`aws_instance.web[1]`, `aws_instance.web["1"]`, false},
+		{`aws_instance.*`, `aws_instance.web[2]`, true},
+		{`aws_instance.*`, `aws_subnet.web`, false},
+		{`aws_*.web`, `aws_subnet.web`, true},
+		{`aws_*.web`, `data.aws_subnet.web`, false},
+		{`data.aws_ami.*`, `data.aws_ami.ubuntu`, true},
+		{`data.aws_ami.*`, `aws_ami.ubuntu`, false},
+		{`*`, `aws_instance.web`, true},
+		{`*`, `module.app.aws_instance.web`, false},
+		{`module.app.*`, `module.app.aws_instance.web`, true},
+		{`module.app.*`, `module.app.data.aws_ami.ubuntu`, true},
+		{`module.app.*`, `module.app.module.db.aws_instance.web`, false},
+		{`module.app.*`, `module.app[0].aws_instance.web`, false},
+		{`module.app[*].*`, `module.app[0].aws_instance.web`, true},
+		{`module.app[*].*`, `module.other[0].aws_instance.web`, false},
+		{`module.*.aws_instance.web`, `module.app["x"].aws_instance.web`, true},
+		{`module.app.module.*.*`, `module.app.module.db.aws_instance.web`, true},
+		{`aws_instance.web`, `module.app.aws_instance.web`, false},
+
+		// Invalid patterns and addresses match nothing.
+		{`module.app`, `module.app.aws_instance.web`, false},
+		{`aws_instance.web[`, `aws_instance.web`, false},
+		{`aws_instance.web[x]`, `aws_instance.web`, false},
+		{`aws_instance.[*`, `aws_instance.web`, false},
+		{`aws_instance.web`, `not an address`, false},
+	}
+
+	for _, test := range tests {
+		if got := MatchAddress(test.pattern, test.addr); got != test.want {
+			t.Errorf("MatchAddress(%q, %q) = %t; want %t", test.pattern, test.addr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package jsonplan
+
+import (
+	"sync"
+)
+
+// planIndex maps absolute resource instance addresses to the corresponding
+// objects within a plan.
+type planIndex struct {
+	once sync.Once
+
+	resourceChanges map[string]*ResourceChange
+	resources       map[string]*Resource
+
+	// modules maps resource instance addresses to the module within the
+	// planned values that contains that resource.
+	modules map[string]*Module
+}
+
+// ResourceChange returns the change for the current object of the resource
+// instance with the given absolute address, such as
+// `module.net[0].aws_instance.web["a"]`, if the plan includes one. Changes
+// for deposed objects are not returned.
+func (p *Plan) ResourceChange(addr string) (*ResourceChange, bool) {
+	rc, ok := p.lookupIndex().resourceChanges[normalizeResourceAddress(addr)]
+	return rc, ok
+}
+
+// Resource returns the planned values for the resource instance with the
+// given absolute address, if the plan includes them, under the same
+// conditions given for ResourceChange.
+func (p *Plan) Resource(addr string) (*Resource, bool) {
+	r, ok := p.lookupIndex().resources[normalizeResourceAddress(addr)]
+	return r, ok
+}
+
+// ModuleOf returns the module within the planned values that directly
+// contains the resource instance with the given absolute address, under the
+// same conditions given for ResourceChange. This is the root module for a
+// resource that isn't in a child module.
+func (p *Plan) ModuleOf(addr string) (*Module, bool) {
+	m, ok := p.lookupIndex().modules[normalizeResourceAddress(addr)]
+	return m, ok
+}
+
+// lookupIndex returns the index of the plan, building it on the first call.
+// A plan that was not created by this package has no index of its own, so a
+// new index is built on each call.
+func (p *Plan) lookupIndex() *planIndex {
+	if p.index == nil {
+		idx := new(planIndex)
+		idx.build(p)
+		return idx
+	}
+	p.index.once.Do(func() {
+		p.index.build(p)
+	})
+	return p.index
+}
+
+func (idx *planIndex) build(p *Plan) {
+	idx.resourceChanges = make(map[string]*ResourceChange, len(p.ResourceChanges))
+	idx.resources = make(map[string]*Resource)
+	idx.modules = make(map[string]*Module)
+	for i := range p.ResourceChanges {
+		rc := &p.ResourceChanges[i]
+		if rc.DeposedKey != "" {
+			continue
+		}
+		idx.resourceChanges[normalizeResourceAddress(rc.Address)] = rc
+	}
+	p.WalkModules(func(_ string, m *Module) error {
+		for i := range m.Resources {
+			addr := normalizeResourceAddress(m.Resources[i].Address)
+			idx.resources[addr] = &m.Resources[i]
+			idx.modules[addr] = m
+		}
+		return nil
+	})
+}
+
+// normalizeResourceAddress returns the canonical form of the given resource
+// instance address, so that lookups don't depend on incidental differences
+// such as whitespace within index brackets. Addresses that can't be parsed
+// are returned unchanged.
+func normalizeResourceAddress(addr string) string {
+	parsed, err := ParseAddress(addr)
+	if err != nil {
+		return addr
+	}
+	return parsed.String()
+}
@@ -0,0 +1,221 @@
+package jsonplan
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+)
+
+func TestPlanLookup(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+	net := addrs.RootModuleInstance.Child("net", addrs.IntKey(0))
+
+	deposed := testResourceChange(t, "db", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType))
+	deposed.DeposedKey = states.DeposedKey("00000001")
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "db", addrs.NoKey, plans.Update, before, after),
+				deposed,
+				testResourceChange(t, "web", addrs.StringKey("a"), plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, net, "subnet", addrs.IntKey(1), plans.NoOp, before, before),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		address    string
+		wantAction string
+		wantFound  bool
+	}{
+		"root module": {
+			`test_thing.db`,
+			"update",
+			true,
+		},
+		"for_each instance": {
+			`test_thing.web["a"]`,
+			"create",
+			true,
+		},
+		"for_each instance with spacing": {
+			`test_thing.web[ "a" ]`,
+			"create",
+			true,
+		},
+		"module instance": {
+			`module.net[0].test_thing.subnet[1]`,
+			"no-op",
+			true,
+		},
+		"other instance key": {
+			`test_thing.web["b"]`,
+			"",
+			false,
+		},
+		"whole resource": {
+			`test_thing.web`,
+			"",
+			false,
+		},
+		"unknown resource": {
+			`test_thing.nope`,
+			"",
+			false,
+		},
+		"invalid address": {
+			`not an address`,
+			"",
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rc, ok := p.ResourceChange(test.address)
+			if ok != test.wantFound {
+				t.Fatalf("wrong result for resource change %t; want %t", ok, test.wantFound)
+			}
+			r, ok := p.Resource(test.address)
+			if ok != test.wantFound {
+				t.Fatalf("wrong result for resource %t; want %t", ok, test.wantFound)
+			}
+			if !test.wantFound {
+				return
+			}
+
+			if got := rc.Change.Actions; len(got) != 1 || got[0] != test.wantAction {
+				t.Errorf("wrong actions %#v; want [%q]", got, test.wantAction)
+			}
+			if rc.DeposedKey != "" {
+				t.Errorf("found change for deposed object %s", rc.DeposedKey)
+			}
+			if rc.Address != r.Address {
+				t.Errorf("resource change address %q doesn't match resource address %q", rc.Address, r.Address)
+			}
+		})
+	}
+}
+
+func TestPlanModuleOf(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	outer := addrs.RootModuleInstance.Child("outer", addrs.NoKey)
+	inner := outer.Child("inner", addrs.IntKey(0))
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "root", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, outer, "a", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, inner, "b", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		address   string
+		want      string
+		wantFound bool
+	}{
+		"root module": {
+			`test_thing.root`,
+			"",
+			true,
+		},
+		"child module": {
+			`module.outer.test_thing.a`,
+			"module.outer",
+			true,
+		},
+		"nested module": {
+			`module.outer.module.inner[0].test_thing.b`,
+			"module.outer.module.inner[0]",
+			true,
+		},
+		"wrong module": {
+			`module.outer.test_thing.b`,
+			"",
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, ok := p.ModuleOf(test.address)
+			if ok != test.wantFound {
+				t.Fatalf("wrong result %t; want %t", ok, test.wantFound)
+			}
+			if !ok {
+				return
+			}
+			if m.Address != test.want {
+				t.Errorf("wrong module %q; want %q", m.Address, test.want)
+			}
+			r, _ := p.Resource(test.address)
+			if len(m.Resources) == 0 || r != &m.Resources[0] {
+				t.Errorf("module doesn't contain %s", test.address)
+			}
+		})
+	}
+}
+
+func TestPlanLookup_concurrent(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+		},
+	}
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first lookups build the index, and must be safe to make
+	// concurrently, as checked by the race detector.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := p.ResourceChange("test_thing.web"); !ok {
+				t.Error("no change for test_thing.web")
+			}
+			if _, ok := p.Resource("test_thing.web"); !ok {
+				t.Error("no planned values for test_thing.web")
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,214 @@
+package jsonplan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MergePlans combines the given plans, such as the plans of separate stacks
+// in one repository, into a single plan.
+//
+// The resource changes and resource drift of the plans are concatenated, in
+// the order the plans are given, as are the resources and module calls of
+// their configurations and the resources of their planned values, whose
+// modules are merged by address. The output changes, planned outputs and
+// configured outputs, variables and local values are merged by name, and the
+// provider configurations are combined, keeping one of each distinct module
+// address, name and alias. The required providers are merged by name,
+// combining the version constraints given for the same provider. It is an
+// error for two of the plans to have a change for the same resource instance
+// object, or for their configurations to have a resource with the same
+// address, or a module call, output, variable or local value with the same
+// name.
+//
+// All of the plans must have the same format version and plan mode. The
+// result has the metadata of a plan produced by this version of Terraform,
+// but has neither a prior state nor a configuration hash, since those belong
+// to the individual plans. It is also an error if the result is inconsistent
+// with its configuration, as described for Validate.
+func MergePlans(plans ...*Plan) (*Plan, error) {
+	if len(plans) == 0 {
+		return nil, errors.New("no plans to merge")
+	}
+	for i, p := range plans {
+		if p == nil {
+			return nil, fmt.Errorf("plan %d is nil", i)
+		}
+	}
+
+	ret := newPlan()
+	ret.FormatVersion = plans[0].FormatVersion
+	ret.PlanMode = plans[0].PlanMode
+
+	changes := make(map[string]bool)
+	resources := make(map[string]bool)
+	moduleCalls := make(map[string]bool)
+	variables := make(map[string]bool)
+	providers := make(map[string]bool)
+	for i, p := range plans {
+		if p.FormatVersion != ret.FormatVersion {
+			return nil, fmt.Errorf("plan %d has format version %q, but plan 0 has %q", i, p.FormatVersion, ret.FormatVersion)
+		}
+		if p.PlanMode != ret.PlanMode {
+			return nil, fmt.Errorf("plan %d has plan mode %q, but plan 0 has %q", i, p.PlanMode, ret.PlanMode)
+		}
+
+		for _, rc := range p.ResourceChanges {
+			key := resourceChangeKey(rc)
+			if changes[key] {
+				return nil, fmt.Errorf("plan %d has a change for %s, which is already in another plan", i, key)
+			}
+			changes[key] = true
+			ret.ResourceChanges = append(ret.ResourceChanges, rc)
+		}
+		ret.ResourceDrift = append(ret.ResourceDrift, p.ResourceDrift...)
+
+		for name, oc := range p.OutputChanges {
+			if _, exists := ret.OutputChanges[name]; exists {
+				return nil, fmt.Errorf("plan %d has a change for output %q, which is already in another plan", i, name)
+			}
+			if ret.OutputChanges == nil {
+				ret.OutputChanges = make(map[string]OutputChange)
+			}
+			ret.OutputChanges[name] = oc
+		}
+
+		for _, r := range p.Config.RootModule.Resources {
+			if resources[r.Address] {
+				return nil, fmt.Errorf("plan %d configures %s, which is already configured in another plan", i, r.Address)
+			}
+			resources[r.Address] = true
+			ret.Config.RootModule.Resources = append(ret.Config.RootModule.Resources, r)
+		}
+		for _, mc := range p.Config.RootModule.ModuleCalls {
+			// Documents that predate the names of module calls can't be
+			// checked for duplicates.
+			if mc.Name != "" && moduleCalls[mc.Name] {
+				return nil, fmt.Errorf("plan %d configures module call %q, which is already configured in another plan", i, mc.Name)
+			}
+			moduleCalls[mc.Name] = true
+			ret.Config.RootModule.ModuleCalls = append(ret.Config.RootModule.ModuleCalls, mc)
+		}
+		for _, v := range p.Config.RootModule.Variables {
+			if variables[v.Name] {
+				return nil, fmt.Errorf("plan %d declares variable %q, which is already declared in another plan", i, v.Name)
+			}
+			variables[v.Name] = true
+			ret.Config.RootModule.Variables = append(ret.Config.RootModule.Variables, v)
+		}
+		for name, l := range p.Config.RootModule.Locals {
+			if _, exists := ret.Config.RootModule.Locals[name]; exists {
+				return nil, fmt.Errorf("plan %d configures local value %q, which is already configured in another plan", i, name)
+			}
+			if ret.Config.RootModule.Locals == nil {
+				ret.Config.RootModule.Locals = make(Expressions)
+			}
+			ret.Config.RootModule.Locals[name] = l
+		}
+		for name, constraint := range p.Config.RootModule.RequiredProviders {
+			if ret.Config.RootModule.RequiredProviders == nil {
+				ret.Config.RootModule.RequiredProviders = make(map[string]string)
+			}
+			ret.Config.RootModule.RequiredProviders[name] = mergeConstraints(ret.Config.RootModule.RequiredProviders[name], constraint)
+		}
+		for name, o := range p.Config.RootModule.Outputs {
+			if _, exists := ret.Config.RootModule.Outputs[name]; exists {
+				return nil, fmt.Errorf("plan %d configures output %q, which is already configured in another plan", i, name)
+			}
+			if ret.Config.RootModule.Outputs == nil {
+				ret.Config.RootModule.Outputs = make(map[string]ConfigOutput)
+			}
+			ret.Config.RootModule.Outputs[name] = o
+		}
+
+		for _, pc := range p.Config.ProviderConfigs {
+			key := pc.ModuleAddress + "\x00" + pc.Name + "\x00" + pc.Alias
+			if providers[key] {
+				continue
+			}
+			providers[key] = true
+			ret.Config.ProviderConfigs = append(ret.Config.ProviderConfigs, pc)
+		}
+
+		var err error
+		ret.PlannedValues, err = mergeValues(ret.PlannedValues, p.PlannedValues)
+		if err != nil {
+			return nil, fmt.Errorf("plan %d: %s", i, err)
+		}
+		ret.ProposedUnknown, err = mergeValues(ret.ProposedUnknown, p.ProposedUnknown)
+		if err != nil {
+			return nil, fmt.Errorf("plan %d: %s", i, err)
+		}
+
+		ret.Errors = append(ret.Errors, p.Errors...)
+		ret.LifecycleViolations = append(ret.LifecycleViolations, p.LifecycleViolations...)
+		ret.RelevantAttributes = append(ret.RelevantAttributes, p.RelevantAttributes...)
+	}
+	sortProviderConfigs(ret.Config.ProviderConfigs)
+	sort.Slice(ret.Config.RootModule.Variables, func(i, j int) bool {
+		return ret.Config.RootModule.Variables[i].Name < ret.Config.RootModule.Variables[j].Name
+	})
+
+	if errs := ret.Validate(); len(errs) != 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return nil, fmt.Errorf("merged plan is inconsistent with its configuration: %s", strings.Join(msgs, "; "))
+	}
+
+	return ret, nil
+}
+
+// mergeConstraints returns the version constraint that combines the given
+// constraints for the same provider, either of which may be empty.
+func mergeConstraints(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	default:
+		return a + ", " + b
+	}
+}
+
+func mergeValues(a, b Values) (Values, error) {
+	for name, o := range b.Outputs {
+		if _, exists := a.Outputs[name]; exists {
+			return a, fmt.Errorf("output %q is already in another plan", name)
+		}
+		if a.Outputs == nil {
+			a.Outputs = make(map[string]Output)
+		}
+		a.Outputs[name] = o
+	}
+	a.RootModule = mergeModules(a.RootModule, b.RootModule)
+	return a, nil
+}
+
+// mergeModules returns the module a with the resources and deposed objects of
+// b appended, and with the child modules of b merged into those of a with the
+// same address or, for those with none, appended.
+func mergeModules(a, b Module) Module {
+	a.Resources = append(a.Resources, b.Resources...)
+	a.Deposed = append(a.Deposed, b.Deposed...)
+
+	children := make(map[string]int, len(a.ChildModules))
+	for i, child := range a.ChildModules {
+		children[child.Address] = i
+	}
+	for _, child := range b.ChildModules {
+		if i, ok := children[child.Address]; ok {
+			a.ChildModules[i] = mergeModules(a.ChildModules[i], child)
+			continue
+		}
+		// Merging into an empty module copies the child, so that merging
+		// further modules into it doesn't modify b.
+		children[child.Address] = len(a.ChildModules)
+		a.ChildModules = append(a.ChildModules, mergeModules(Module{Address: child.Address}, child))
+	}
+	return a
+}
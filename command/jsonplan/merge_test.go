@@ -0,0 +1,260 @@
+package jsonplan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMergePlans(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	stack := func(name, output string) *Plan {
+		net := addrs.RootModuleInstance.Child(name+"_net", addrs.NoKey)
+		snap := testSnapshot(map[string]string{
+			"": `
+terraform {
+  required_providers {
+    test = "~> 1.0"
+  }
+}
+
+variable "` + name + `_zone" {
+}
+
+locals {
+  ` + name + `_tag = "` + name + `"
+}
+
+provider "test" {
+  region = "us-east-1"
+}
+
+resource "test_thing" "` + name + `" {
+  ami = "ami-123"
+}
+
+module "` + name + `_net" {
+  source = "./` + name + `_net"
+}
+`,
+			name + "_net": `
+resource "test_thing" "` + name + `" {
+}
+`,
+		})
+		plan := &plans.Plan{
+			Changes: &plans.Changes{
+				Resources: []*plans.ResourceInstanceChangeSrc{
+					testResourceChange(t, name, addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+					testModuleResourceChange(t, net, name, addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				},
+				Outputs: []*plans.OutputChangeSrc{
+					testOutputChange(t, output, plans.Create, cty.NilVal, cty.StringVal(name)),
+				},
+			},
+		}
+		p, err := MarshallToPlan(snap, plan, nil, testSchemas())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	a := stack("a", "a_id")
+	b := stack("b", "b_id")
+
+	got, err := MergePlans(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	for _, rc := range got.ResourceChanges {
+		changes = append(changes, rc.Address)
+	}
+	wantChanges := []string{
+		"test_thing.a",
+		"module.a_net.test_thing.a",
+		"test_thing.b",
+		"module.b_net.test_thing.b",
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("wrong resource changes\ngot:  %#v\nwant: %#v", changes, wantChanges)
+	}
+
+	if _, ok := got.OutputChanges["a_id"]; !ok {
+		t.Error("no change for output a_id")
+	}
+	if _, ok := got.OutputChanges["b_id"]; !ok {
+		t.Error("no change for output b_id")
+	}
+
+	if len(got.Config.ProviderConfigs) != 1 {
+		t.Errorf("wrong number of provider configs %d; want 1", len(got.Config.ProviderConfigs))
+	}
+	if len(got.Config.RootModule.Resources) != 2 {
+		t.Errorf("wrong number of configured resources %d; want 2", len(got.Config.RootModule.Resources))
+	}
+	if len(got.Config.RootModule.ModuleCalls) != 2 {
+		t.Errorf("wrong number of module calls %d; want 2", len(got.Config.RootModule.ModuleCalls))
+	}
+	var variables []string
+	for _, v := range got.Config.RootModule.Variables {
+		variables = append(variables, v.Name)
+	}
+	if want := []string{"a_zone", "b_zone"}; !reflect.DeepEqual(variables, want) {
+		t.Errorf("wrong variables\ngot:  %#v\nwant: %#v", variables, want)
+	}
+	if len(got.Config.RootModule.Locals) != 2 {
+		t.Errorf("wrong number of local values %d; want 2", len(got.Config.RootModule.Locals))
+	}
+	if got, want := got.Config.RootModule.RequiredProviders, map[string]string{"test": "~> 1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong required providers\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got, want := got.RequiredProviders(), []string{"registry.terraform.io/terraform-providers/test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong required provider addresses\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	var resources []string
+	got.WalkResources(func(r *Resource) error {
+		resources = append(resources, r.Address)
+		return nil
+	})
+	wantResources := []string{
+		"test_thing.a",
+		"test_thing.b",
+		"module.a_net.test_thing.a",
+		"module.b_net.test_thing.b",
+	}
+	if !reflect.DeepEqual(resources, wantResources) {
+		t.Errorf("wrong planned resources\ngot:  %#v\nwant: %#v", resources, wantResources)
+	}
+
+	if errs := got.Validate(); len(errs) != 0 {
+		t.Errorf("merged plan is invalid: %v", errs)
+	}
+
+	// The inputs are left as they were.
+	if len(a.ResourceChanges) != 2 || len(a.PlannedValues.RootModule.ChildModules[0].Resources) != 1 {
+		t.Error("first plan was modified")
+	}
+}
+
+func TestMergePlans_collision(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	stack := func(names ...string) *Plan {
+		changes := plans.NewChanges()
+		for _, name := range names {
+			changes.Resources = append(changes.Resources,
+				testResourceChange(t, name, addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			)
+		}
+		p, err := MarshallToPlan(nil, &plans.Plan{Changes: changes}, nil, testSchemas())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	_, err := MergePlans(stack("a", "shared"), stack("b", "shared"))
+	if err == nil {
+		t.Fatal("succeeded; want error")
+	}
+	if got, want := err.Error(), "plan 1 has a change for test_thing.shared, which is already in another plan"; got != want {
+		t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestMergePlans_configCollision(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		want   string
+	}{
+		"module call": {
+			`
+module "net" {
+  source = "./net"
+}
+`,
+			`plan 1 configures module call "net", which is already configured in another plan`,
+		},
+		"variable": {
+			`
+variable "zone" {
+}
+`,
+			`plan 1 declares variable "zone", which is already declared in another plan`,
+		},
+		"local value": {
+			`
+locals {
+  tag = "web"
+}
+`,
+			`plan 1 configures local value "tag", which is already configured in another plan`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			stack := func() *Plan {
+				snap := testSnapshot(map[string]string{
+					"":    test.config,
+					"net": ``,
+				})
+				p, err := MarshallToPlan(snap, &plans.Plan{Changes: plans.NewChanges()}, nil, testSchemas())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+
+			_, err := MergePlans(stack(), stack())
+			if err == nil {
+				t.Fatal("succeeded; want error")
+			}
+			if got := err.Error(); got != test.want {
+				t.Errorf("wrong error\ngot:  %s\nwant: %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeConstraints(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"~> 1.0", "", "~> 1.0"},
+		{"", "~> 1.0", "~> 1.0"},
+		{"~> 1.0", "~> 1.0", "~> 1.0"},
+		{"~> 1.0", ">= 1.2", "~> 1.0, >= 1.2"},
+	}
+
+	for _, test := range tests {
+		if got := mergeConstraints(test.a, test.b); got != test.want {
+			t.Errorf("mergeConstraints(%q, %q) = %q; want %q", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestMergePlans_formatVersion(t *testing.T) {
+	a := &Plan{FormatVersion: "0.1"}
+	b := &Plan{FormatVersion: FormatVersion}
+
+	_, err := MergePlans(a, b)
+	if err == nil || !strings.Contains(err.Error(), "format version") {
+		t.Fatalf("wrong error %v; want format version mismatch", err)
+	}
+}
@@ -0,0 +1,107 @@
+package jsonplan
+
+import (
+	"encoding/json"
+)
+
+// Module is the representation of a module in state. This can be the root
+// module or a child module.
+type Module struct {
+	Resources []Resource `json:"resources,omitempty"`
+
+	// Address is the absolute module instance address, including the
+	// instance key of each module called with count or for_each, such as
+	// "module.net[0]". Omitted for the root module.
+	Address string `json:"address,omitempty"`
+
+	// Deposed lists the deposed objects in the module, left behind by
+	// replacements that created the new object before destroying the old,
+	// which the plan won't destroy and so will remain after apply. Each has
+	// its DeposedKey set. A complete plan destroys every deposed object, so
+	// this is usually empty. The prior state describes all of the deposed
+	// objects that currently exist.
+	Deposed []Resource `json:"deposed,omitempty"`
+
+	// Each module object can optionally have its own nested "child_modules",
+	// recursively describing the full module tree.
+	ChildModules []Module `json:"child_modules,omitempty"`
+}
+
+// WalkModules calls the given function for each module in the planned values,
+// depth-first, starting with the root module, whose address is the empty
+// string. Child modules are visited in the order they appear, after their
+// parent. The walk stops at the first error returned by the function, which
+// is then returned.
+func (p *Plan) WalkModules(fn func(addr string, m *Module) error) error {
+	return walkModule(&p.PlannedValues.RootModule, fn)
+}
+
+func walkModule(m *Module, fn func(addr string, m *Module) error) error {
+	if err := fn(m.Address, m); err != nil {
+		return err
+	}
+	for i := range m.ChildModules {
+		if err := walkModule(&m.ChildModules[i], fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkResources calls the given function for each resource in the planned
+// values, visiting the resources of each module in the order described for
+// WalkModules. The walk stops at the first error returned by the function,
+// which is then returned.
+func (p *Plan) WalkResources(fn func(*Resource) error) error {
+	return p.WalkModules(func(_ string, m *Module) error {
+		for i := range m.Resources {
+			if err := fn(&m.Resources[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForEachPlannedResource calls the given function with the address and change
+// of each resource change that has an action other than "no-op", in the order
+// of ResourceChanges, which is stable for a given plan. This is intended for
+// tools such as cost estimators that act on each planned change.
+//
+// The changes for deposed objects are included, each with the address of its
+// resource instance, so the same address is given more than once for an
+// instance with deposed objects to be destroyed.
+func (p *Plan) ForEachPlannedResource(fn func(addr string, change Change)) {
+	for _, rc := range p.ResourceChanges {
+		if a := rc.Change.Actions; len(a) == 1 && a[0] == "no-op" {
+			continue
+		}
+		fn(rc.Address, rc.Change)
+	}
+}
+
+// DataSourceValues returns the planned values of each data resource instance
+// whose values are wholly known, keyed by address. The values of data
+// resources that can only be read during apply are not yet known, so those
+// instances are omitted.
+func (p *Plan) DataSourceValues() map[string]json.RawMessage {
+	unknown := make(map[string]bool)
+	walkModule(&p.ProposedUnknown.RootModule, func(_ string, m *Module) error {
+		for _, r := range m.Resources {
+			var v interface{}
+			if err := decodeValue(r.Values, &v); err != nil || containsUnknown(v) {
+				unknown[r.Address] = true
+			}
+		}
+		return nil
+	})
+
+	ret := make(map[string]json.RawMessage)
+	p.WalkResources(func(r *Resource) error {
+		if r.Mode == DataResourceMode && !unknown[r.Address] {
+			ret[r.Address] = r.Values
+		}
+		return nil
+	})
+	return ret
+}
@@ -0,0 +1,188 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testModuleTreePlan() *Plan {
+	return &Plan{
+		PlannedValues: Values{
+			RootModule: Module{
+				Resources: []Resource{
+					{Address: "test_thing.a"},
+					{Address: "test_thing.b"},
+				},
+				ChildModules: []Module{
+					{
+						Address: "module.x",
+						Resources: []Resource{
+							{Address: "module.x.test_thing.c"},
+						},
+						ChildModules: []Module{
+							{
+								Address: "module.x.module.y[0]",
+								Resources: []Resource{
+									{Address: "module.x.module.y[0].test_thing.d"},
+								},
+							},
+						},
+					},
+					{
+						Address: "module.z",
+						Resources: []Resource{
+							{Address: "module.z.test_thing.e"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPlanWalkModules(t *testing.T) {
+	p := testModuleTreePlan()
+
+	var got []string
+	err := p.WalkModules(func(addr string, m *Module) error {
+		if addr != m.Address {
+			t.Errorf("address %q doesn't match module address %q", addr, m.Address)
+		}
+		got = append(got, addr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"", "module.x", "module.x.module.y[0]", "module.z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong visit order\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestPlanWalkResources(t *testing.T) {
+	p := testModuleTreePlan()
+
+	var got []string
+	err := p.WalkResources(func(r *Resource) error {
+		got = append(got, r.Address)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"test_thing.a",
+		"test_thing.b",
+		"module.x.test_thing.c",
+		"module.x.module.y[0].test_thing.d",
+		"module.z.test_thing.e",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong visit order\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	// The function is given the resources themselves, rather than copies.
+	p.WalkResources(func(r *Resource) error {
+		r.Name = "visited"
+		return nil
+	})
+	if got := p.PlannedValues.RootModule.ChildModules[0].ChildModules[0].Resources[0].Name; got != "visited" {
+		t.Errorf("resource was not modified")
+	}
+}
+
+func TestPlanWalk_stop(t *testing.T) {
+	p := testModuleTreePlan()
+	stop := errors.New("stop")
+
+	var gotModules []string
+	err := p.WalkModules(func(addr string, m *Module) error {
+		gotModules = append(gotModules, addr)
+		if addr == "module.x" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("wrong error %v; want %v", err, stop)
+	}
+	if want := []string{"", "module.x"}; !reflect.DeepEqual(gotModules, want) {
+		t.Errorf("wrong modules visited\ngot:  %#v\nwant: %#v", gotModules, want)
+	}
+
+	var gotResources []string
+	err = p.WalkResources(func(r *Resource) error {
+		gotResources = append(gotResources, r.Address)
+		if r.Address == "module.x.test_thing.c" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("wrong error %v; want %v", err, stop)
+	}
+	if want := []string{"test_thing.a", "test_thing.b", "module.x.test_thing.c"}; !reflect.DeepEqual(gotResources, want) {
+		t.Errorf("wrong resources visited\ngot:  %#v\nwant: %#v", gotResources, want)
+	}
+}
+
+func TestPlanForEachPlannedResource(t *testing.T) {
+	p := &Plan{
+		ResourceChanges: []ResourceChange{
+			{Address: "test_thing.a", Change: Change{Actions: []string{"create"}}},
+			{Address: "test_thing.b", Change: Change{Actions: []string{"no-op"}}},
+			{Address: "test_thing.c", Change: Change{Actions: []string{"delete", "create"}}},
+			{Address: "test_thing.c", DeposedKey: "00000001", Change: Change{Actions: []string{"delete"}}},
+			{Address: "module.x.test_thing.d", Change: Change{Actions: []string{"update"}}},
+		},
+	}
+
+	var got []string
+	p.ForEachPlannedResource(func(addr string, change Change) {
+		got = append(got, addr+" "+change.Actions[0])
+	})
+
+	want := []string{
+		"test_thing.a create",
+		"test_thing.c delete",
+		"test_thing.c delete",
+		"module.x.test_thing.d update",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong calls\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestPlanDataSourceValues(t *testing.T) {
+	p := &Plan{
+		PlannedValues: Values{
+			RootModule: Module{
+				Resources: []Resource{
+					{Address: "test_thing.web", Mode: ManagedResourceMode, Values: json.RawMessage(`{"ami":"ami-123"}`)},
+					{Address: "data.test_thing.known", Mode: DataResourceMode, Values: json.RawMessage(`{"id":"i-abc","ami":"ami-123"}`)},
+					{Address: "data.test_thing.pending", Mode: DataResourceMode, Values: json.RawMessage(`{"ami":"ami-123"}`)},
+				},
+			},
+		},
+		ProposedUnknown: Values{
+			RootModule: Module{
+				Resources: []Resource{
+					{Address: "test_thing.web", Mode: ManagedResourceMode, Values: json.RawMessage(`{"id":true}`)},
+					{Address: "data.test_thing.known", Mode: DataResourceMode, Values: json.RawMessage(`{}`)},
+					{Address: "data.test_thing.pending", Mode: DataResourceMode, Values: json.RawMessage(`{"id":true}`)},
+				},
+			},
+		},
+	}
+
+	got := p.DataSourceValues()
+	if len(got) != 1 {
+		t.Fatalf("wrong number of data sources %d; want 1", len(got))
+	}
+	assertJSONEqual(t, got["data.test_thing.known"], []byte(`{"id":"i-abc","ami":"ami-123"}`))
+}
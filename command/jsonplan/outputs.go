@@ -0,0 +1,91 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// SensitiveOutputs returns the sorted names of the root module outputs with
+// changes in the plan that are sensitive, either because the output is
+// declared as sensitive or because its value before or after the change is
+// marked as sensitive.
+func (p *Plan) SensitiveOutputs() []string {
+	declared := make(map[string]bool)
+	for name, o := range p.PlannedValues.Outputs {
+		if o.Sensitive {
+			declared[name] = true
+		}
+	}
+	for name, o := range p.Config.RootModule.Outputs {
+		if o.Sensitive {
+			declared[name] = true
+		}
+	}
+
+	var ret []string
+	for name, oc := range p.OutputChanges {
+		if declared[name] || sensitiveMark(oc.BeforeSensitive) || sensitiveMark(oc.AfterSensitive) {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sensitiveMark returns true if the given sensitivity shape, as described
+// for Change.BeforeSensitive and AfterSensitive, marks any part of its value
+// as sensitive.
+func sensitiveMark(raw json.RawMessage) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return false
+	}
+	return containsTrue(v)
+}
+
+func containsTrue(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case []interface{}:
+		for _, elem := range v {
+			if containsTrue(elem) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, elem := range v {
+			if containsTrue(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countTrue returns the number of true values within the given decoded json
+// value, as for containsTrue.
+func countTrue(v interface{}) int {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+	case []interface{}:
+		n := 0
+		for _, elem := range v {
+			n += countTrue(elem)
+		}
+		return n
+	case map[string]interface{}:
+		n := 0
+		for _, elem := range v {
+			n += countTrue(elem)
+		}
+		return n
+	}
+	return 0
+}
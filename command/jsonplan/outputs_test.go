@@ -0,0 +1,56 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestPlanSensitiveOutputs(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("10.0.0.1")),
+				testOutputChangeSensitive(t, "password", plans.Update, cty.StringVal("hunter2"), cty.StringVal("hunter3"), true),
+				testOutputChangeSensitive(t, "removed_secret", plans.Delete, cty.StringVal("hunter2"), cty.NilVal, true),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"password", "removed_secret"}
+	if got := p.SensitiveOutputs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong sensitive outputs\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestPlanSensitiveOutputs_marks(t *testing.T) {
+	// A plan from elsewhere might mark a value as sensitive without
+	// declaring the output as such, or the reverse.
+	p := &Plan{
+		PlannedValues: Values{
+			Outputs: map[string]Output{
+				"declared": {Sensitive: true},
+				"plain":    {Value: json.RawMessage(`"a"`)},
+			},
+		},
+		OutputChanges: map[string]OutputChange{
+			"declared": {Change: Change{Actions: []string{"create"}, AfterSensitive: json.RawMessage(`false`)}},
+			"marked":   {Change: Change{Actions: []string{"update"}, BeforeSensitive: json.RawMessage(`{"key":true}`)}},
+			"plain":    {Change: Change{Actions: []string{"create"}, AfterSensitive: json.RawMessage(`false`)}},
+		},
+	}
+
+	want := []string{"declared", "marked"}
+	if got := p.SensitiveOutputs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong sensitive outputs\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse decodes the json encoding of a plan, as produced by Marshall.
+//
+// The document must declare a format version with the same major version as
+// FormatVersion and a minor version no later than it. Properties that are not
+// known to this version of the package are ignored, so that documents
+// produced by later releases with backward-compatible additions can still be
+// decoded. Resource modes must be either "managed" or "data", and any prior
+// state must be of version PriorStateVersion of the state file format.
+func Parse(src []byte) (*Plan, error) {
+	return ParseWithOptions(src, ParseOptions{})
+}
+
+// ParseOptions are options for ParseWithOptions.
+type ParseOptions struct {
+	// MinFormatVersion and MaxFormatVersion give the range of format
+	// versions to accept, inclusive, such as "0.1" and "0.3". Versions are
+	// compared by major version and then by minor version. If unset, they
+	// default to the earliest minor version of the major version of
+	// FormatVersion and to FormatVersion itself, respectively.
+	//
+	// Accepting versions later than FormatVersion relies on those versions
+	// only adding properties, which are ignored, so it is safe only for
+	// versions known to be backward-compatible.
+	MinFormatVersion string
+	MaxFormatVersion string
+}
+
+// ParseWithOptions is a variant of Parse that accepts options. It returns an
+// error if either of the format versions in the options is malformed.
+func ParseWithOptions(src []byte, opts ParseOptions) (*Plan, error) {
+	currentMajor, _, _ := splitFormatVersion(FormatVersion)
+	min := opts.MinFormatVersion
+	if min == "" {
+		min = strconv.Itoa(currentMajor) + ".0"
+	}
+	max := opts.MaxFormatVersion
+	if max == "" {
+		max = FormatVersion
+	}
+	for _, v := range []string{min, max} {
+		if _, _, ok := splitFormatVersion(v); !ok {
+			return nil, fmt.Errorf("invalid format version %q in options", v)
+		}
+	}
+
+	var version struct {
+		FormatVersion string `json:"format_version"`
+	}
+	if err := json.Unmarshal(src, &version); err != nil {
+		return nil, fmt.Errorf("invalid plan json: %s", err)
+	}
+	if !formatVersionInRange(version.FormatVersion, min, max) {
+		return nil, fmt.Errorf(
+			"unsupported plan format version %q; only versions %q to %q are supported",
+			version.FormatVersion, min, max,
+		)
+	}
+
+	ret := &Plan{index: new(planIndex)}
+	if err := json.Unmarshal(src, ret); err != nil {
+		return nil, fmt.Errorf("invalid plan json: %s", err)
+	}
+
+	// A null prior state is equivalent to an omitted one, but otherwise it
+	// must be in the expected state file format.
+	if bytes.Equal(bytes.TrimSpace(ret.PriorState), []byte("null")) {
+		ret.PriorState = nil
+	}
+	if ret.PriorState != nil {
+		var state struct {
+			Version *int `json:"version"`
+		}
+		if err := json.Unmarshal(ret.PriorState, &state); err != nil {
+			return nil, fmt.Errorf("invalid prior state: %s", err)
+		}
+		if state.Version == nil || *state.Version != PriorStateVersion {
+			return nil, fmt.Errorf("unsupported prior state version; only version %d is supported", PriorStateVersion)
+		}
+	}
+
+	// The changes are omitted from the json when there are none, but callers
+	// should always be able to treat them as an empty collection.
+	if ret.ResourceChanges == nil {
+		ret.ResourceChanges = []ResourceChange{}
+	}
+	if ret.OutputChanges == nil {
+		ret.OutputChanges = map[string]OutputChange{}
+	}
+
+	// Each change caches its decoded values, as for those produced by
+	// MarshallToPlan.
+	for i := range ret.ResourceChanges {
+		ret.ResourceChanges[i].Change.decoded = new(decodedValues)
+	}
+	for i := range ret.ResourceDrift {
+		ret.ResourceDrift[i].Change.decoded = new(decodedValues)
+	}
+	for name, oc := range ret.OutputChanges {
+		oc.Change.decoded = new(decodedValues)
+		ret.OutputChanges[name] = oc
+	}
+
+	return ret, nil
+}
+
+// formatVersionInRange returns true if the given format version is between
+// the given minimum and maximum versions, inclusive. Each minor version only
+// adds to the previous ones, so documents of any version in the range can be
+// decoded by Parse, ignoring any properties it doesn't know.
+func formatVersionInRange(v, min, max string) bool {
+	major, minor, ok := splitFormatVersion(v)
+	if !ok {
+		return false
+	}
+	minMajor, minMinor, _ := splitFormatVersion(min)
+	maxMajor, maxMinor, _ := splitFormatVersion(max)
+	switch {
+	case major < minMajor || (major == minMajor && minor < minMinor):
+		return false
+	case major > maxMajor || (major == maxMajor && minor > maxMinor):
+		return false
+	default:
+		return true
+	}
+}
+
+func splitFormatVersion(v string) (major, minor int, ok bool) {
+	parts := strings.Split(v, ".")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
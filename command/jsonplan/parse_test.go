@@ -0,0 +1,247 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestParse_roundTrip(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.IntKey(1), plans.DeleteThenCreate,
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.StringVal("i-abc"),
+						"ami": cty.StringVal("ami-123"),
+					}),
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.UnknownVal(cty.String),
+						"ami": cty.StringVal("ami-456"),
+					}),
+				),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Update, cty.StringVal("10.0.0.1"), cty.StringVal("10.0.0.2")),
+			},
+		},
+	}
+
+	src, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := Parse(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The two plans were rendered separately, so their timestamps may differ.
+	if got.Timestamp == "" {
+		t.Errorf("timestamp was not preserved")
+	}
+	got.Timestamp = want.Timestamp
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		src     string
+		wantErr string
+	}{
+		"minimal": {
+			`{"format_version":"0.2","terraform_version":"0.12.0","timestamp":"2018-11-01T12:00:00Z"}`,
+			``,
+		},
+		"earlier format version": {
+			`{"format_version":"0.1"}`,
+			``,
+		},
+		"unknown top-level keys": {
+			`{"format_version":"0.2","from_the_future":{"a":[1,2,3]}}`,
+			``,
+		},
+		"prior state": {
+			`{"format_version":"0.2","prior_state":{"version":4,"serial":1,"resources":[]}}`,
+			``,
+		},
+		"null prior state": {
+			`{"format_version":"0.2","prior_state":null}`,
+			``,
+		},
+		"wrong prior state version": {
+			`{"format_version":"0.2","prior_state":{"version":3}}`,
+			`unsupported prior state version`,
+		},
+		"prior state without version": {
+			`{"format_version":"0.2","prior_state":{"resources":[]}}`,
+			`unsupported prior state version`,
+		},
+		"malformed prior state": {
+			`{"format_version":"0.2","prior_state":[4]}`,
+			`invalid prior state`,
+		},
+		"resource modes": {
+			`{"format_version":"0.2","resource_changes":[{"address":"test_thing.a","mode":"managed"},{"address":"data.test_thing.b","mode":"data"}]}`,
+			``,
+		},
+		"invalid resource change mode": {
+			`{"format_version":"0.2","resource_changes":[{"address":"test_thing.a","mode":"manged"}]}`,
+			`invalid resource mode "manged"`,
+		},
+		"invalid planned resource mode": {
+			`{"format_version":"0.2","planned_values":{"root_module":{"resources":[{"address":"test_thing.a","mode":"resource"}]}}}`,
+			`invalid resource mode "resource"`,
+		},
+		"later format version": {
+			`{"format_version":"0.99"}`,
+			`unsupported plan format version "0.99"`,
+		},
+		"wrong major format version": {
+			`{"format_version":"1.0"}`,
+			`unsupported plan format version "1.0"`,
+		},
+		"malformed format version": {
+			`{"format_version":"latest"}`,
+			`unsupported plan format version "latest"`,
+		},
+		"missing format version": {
+			`{"resource_changes":[]}`,
+			`unsupported plan format version ""`,
+		},
+		"invalid json": {
+			`{"format_version":`,
+			`invalid plan json`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := Parse([]byte(test.src))
+			if test.wantErr != "" {
+				if err == nil {
+					t.Fatalf("succeeded; want error containing %q", test.wantErr)
+				}
+				if !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("wrong error %q; want error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if got.ResourceChanges == nil {
+				t.Errorf("ResourceChanges is nil; want empty")
+			}
+			if got.OutputChanges == nil {
+				t.Errorf("OutputChanges is nil; want empty")
+			}
+		})
+	}
+}
+
+func TestParseWithOptions(t *testing.T) {
+	tests := map[string]struct {
+		src     string
+		opts    ParseOptions
+		wantErr string
+	}{
+		"0.1 within range": {
+			`{"format_version":"0.1","resource_changes":[{"address":"test_thing.a","mode":"managed","change":{"actions":["create"]}}]}`,
+			ParseOptions{MinFormatVersion: "0.1", MaxFormatVersion: "0.2"},
+			``,
+		},
+		"0.2 within range": {
+			`{"format_version":"0.2","plan_mode":"normal"}`,
+			ParseOptions{MinFormatVersion: "0.1", MaxFormatVersion: "0.2"},
+			``,
+		},
+		"later version within range": {
+			`{"format_version":"0.3","from_the_future":true}`,
+			ParseOptions{MaxFormatVersion: "0.3"},
+			``,
+		},
+		"below minimum": {
+			`{"format_version":"0.1"}`,
+			ParseOptions{MinFormatVersion: "0.2"},
+			`unsupported plan format version "0.1"; only versions "0.2" to "0.2" are supported`,
+		},
+		"above maximum": {
+			`{"format_version":"0.2"}`,
+			ParseOptions{MaxFormatVersion: "0.1"},
+			`unsupported plan format version "0.2"; only versions "0.0" to "0.1" are supported`,
+		},
+		"later major version": {
+			`{"format_version":"1.0"}`,
+			ParseOptions{MaxFormatVersion: "0.9"},
+			`unsupported plan format version "1.0"`,
+		},
+		"malformed option": {
+			`{"format_version":"0.2"}`,
+			ParseOptions{MinFormatVersion: "zero"},
+			`invalid format version "zero" in options`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseWithOptions([]byte(test.src), test.opts)
+			if test.wantErr != "" {
+				if err == nil {
+					t.Fatalf("succeeded; want error containing %q", test.wantErr)
+				}
+				if !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("wrong error %q; want error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got.ResourceChanges == nil {
+				t.Errorf("ResourceChanges is nil; want empty")
+			}
+		})
+	}
+}
+
+func TestResourceModeMarshalJSON(t *testing.T) {
+	for _, mode := range []ResourceMode{ManagedResourceMode, DataResourceMode} {
+		got, err := json.Marshal(mode)
+		if err != nil {
+			t.Fatalf("unexpected error marshaling %q: %s", mode, err)
+		}
+		if want := `"` + string(mode) + `"`; string(got) != want {
+			t.Errorf("wrong result %s; want %s", got, want)
+		}
+	}
+
+	if _, err := json.Marshal(ResourceMode("manged")); err == nil {
+		t.Error("marshaling invalid mode succeeded; want error")
+	}
+
+	// An unset mode is omitted rather than rejected.
+	got, err := json.Marshal(Resource{Address: "test_thing.a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"address":"test_thing.a"}`; string(got) != want {
+		t.Errorf("wrong result %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// configDocument is the json document produced by MarshallConfig.
+type configDocument struct {
+	FormatVersion string `json:"format_version"`
+	Config        Config `json:"configuration"`
+}
+
+// changesDocument is the json document produced by MarshallChanges.
+type changesDocument struct {
+	FormatVersion   string           `json:"format_version"`
+	ResourceChanges []ResourceChange `json:"resource_changes,omitempty"`
+	Errors          []PlanError      `json:"errors,omitempty"`
+}
+
+// MarshallConfig returns a json document containing only the "configuration"
+// property that Marshall would produce for the configuration in the given
+// snapshot, along with the format version. The schemas are used to find the
+// expressions within provider and resource configuration blocks, as for
+// Marshall, and may be nil if those are not needed.
+func MarshallConfig(c *configload.Snapshot, schemas *terraform.Schemas) ([]byte, error) {
+	config, sources, err := loadConfig(c)
+	if err != nil {
+		return nil, fmt.Errorf("error in loadConfig: %s", err)
+	}
+
+	var p Plan
+	p.marshalConfig(config, sources, schemas)
+
+	return json.Marshal(configDocument{
+		FormatVersion: FormatVersion,
+		Config:        p.Config,
+	})
+}
+
+// MarshallChanges returns a json document containing only the
+// "resource_changes" property that Marshall would produce for the given plan,
+// along with the format version and any errors.
+//
+// Since neither the prior state nor the configuration is given, the changes
+// don't explain replacements of tainted objects or mark attributes that are
+// sensitive only because of the input variables they refer to. The schemas
+// are required to decode the changes, as for Marshall.
+func MarshallChanges(p *plans.Plan, schemas *terraform.Schemas) ([]byte, error) {
+	var output Plan
+	if p != nil && p.Changes != nil {
+		if err := output.marshalResourceChanges(p.Changes, nil, nil, schemas); err != nil {
+			return nil, fmt.Errorf("error in marshalResourceChanges: %s", err)
+		}
+	}
+
+	return json.Marshal(changesDocument{
+		FormatVersion:   FormatVersion,
+		ResourceChanges: output.ResourceChanges,
+		Errors:          output.Errors,
+	})
+}
@@ -0,0 +1,103 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshallConfig(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+provider "test" {
+  region = "us-east-1"
+}
+
+resource "test_thing" "web" {
+  ami = "ami-123"
+}
+`,
+	})
+
+	got, err := MarshallConfig(snap, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := Marshall(snap, nil, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testTopLevelProperties(t, got, []string{"configuration", "format_version"})
+	assertJSONEqual(t, doc["format_version"], []byte(`"0.2"`))
+	assertJSONEqual(t, doc["configuration"], testTopLevelProperties(t, full, nil)["configuration"])
+}
+
+func TestMarshallChanges(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Create,
+					cty.NullVal(testThingType),
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.UnknownVal(cty.String),
+						"ami": cty.StringVal("ami-123"),
+					}),
+				),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("10.0.0.1")),
+			},
+		},
+	}
+
+	got, err := MarshallChanges(plan, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testTopLevelProperties(t, got, []string{"format_version", "resource_changes"})
+	assertJSONEqual(t, doc["resource_changes"], testTopLevelProperties(t, full, nil)["resource_changes"])
+
+	// Any changes that can't be decoded are reported as for Marshall.
+	got, err = MarshallChanges(plan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTopLevelProperties(t, got, []string{"errors", "format_version", "resource_changes"})
+}
+
+// testTopLevelProperties decodes the properties of the given json object,
+// failing the test if the names of the properties are not those given,
+// unless want is nil.
+func testTopLevelProperties(t *testing.T, src []byte, want []string) map[string]json.RawMessage {
+	t.Helper()
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(src, &doc); err != nil {
+		t.Fatalf("invalid json: %s\n%s", err, src)
+	}
+	if want == nil {
+		return doc
+	}
+
+	var got []string
+	for name := range doc {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong properties\ngot:  %#v\nwant: %#v", got, want)
+	}
+	return doc
+}
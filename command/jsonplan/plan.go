@@ -0,0 +1,1071 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statefile"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/version"
+)
+
+// FormatVersion represents the version of the json format and will be
+// incremented for any change to this format that requires changes to a
+// consuming parser.
+const FormatVersion = "0.2"
+
+// PriorStateVersion is the version of the state file format used for the
+// prior state within plans of the current format version. The prior state is
+// written by the statefile package, exactly as Terraform itself would write
+// the state file. Version 4 of the state file format is used by all of the
+// format versions so far, 0.1 and 0.2.
+const PriorStateVersion = 4
+
+// Plan is the top-level representation of the json format of a plan. It
+// includes the complete config and current state.
+type Plan struct {
+	FormatVersion string `json:"format_version,omitempty"`
+
+	// TerraformVersion is the version of Terraform that produced the plan
+	// json, and Timestamp is the time at which it did so, in RFC3339 format.
+	// Since plans are usually rendered just after they are created, the
+	// timestamp normally also reflects when the plan was created. Both are
+	// absent in documents of format version 0.1.
+	TerraformVersion string `json:"terraform_version,omitempty"`
+	Timestamp        string `json:"timestamp,omitempty"`
+
+	// PriorState is the state that the plan was created against, in the state
+	// file format, whose "version" property is always PriorStateVersion. It
+	// is omitted if the prior state is empty, such as when planning a new
+	// configuration for the first time.
+	PriorState json.RawMessage `json:"prior_state,omitempty"`
+
+	// PlanMode is "destroy" for a plan to destroy all of the objects in the
+	// prior state, "refresh-only" for a plan that only updates the state to
+	// match the remote objects, and "normal" otherwise.
+	PlanMode string `json:"plan_mode,omitempty"`
+
+	Config Config `json:"configuration,omitempty"`
+
+	// ConfigHash is a hash of the configuration source, which is the same for
+	// any two plans of the same configuration. It changes if any module's
+	// source code changes, other than by reformatting, or if a different
+	// version of any module is selected. Omitted if the configuration is not
+	// available.
+	ConfigHash string `json:"config_hash,omitempty"`
+
+	PlannedValues   Values `json:"planned_values,omitempty"`
+	ProposedUnknown Values `json:"proposed_unknown,omitempty"`
+
+	// ResourceChanges are sorted by module address, then by resource mode,
+	// type, name and instance key, with the changes for any deposed objects
+	// of an instance following the change for its current object.
+	ResourceChanges []ResourceChange `json:"resource_changes,omitempty"`
+
+	// OutputChanges are keyed by output name. encoding/json writes map keys
+	// in sorted order, so they always appear sorted by name in the json.
+	OutputChanges map[string]OutputChange `json:"output_changes,omitempty"`
+
+	// ResourceDrift describes the changes made outside of Terraform to the
+	// objects in the prior state, as detected when refreshing it, given in
+	// the same order as ResourceChanges. Drift is distinct from the planned
+	// changes, and is only included when MarshallOptions.RecordedState is
+	// given.
+	ResourceDrift []ResourceChange `json:"resource_drift,omitempty"`
+
+	// Errors describes any parts of the plan that could not be rendered. The
+	// affected objects are either rendered only partially or omitted.
+	Errors []PlanError `json:"errors,omitempty"`
+
+	// LifecycleViolations describes each resource change that would destroy
+	// an object whose configuration sets the prevent_destroy lifecycle
+	// argument, which Terraform refuses to apply. Requires the
+	// configuration.
+	LifecycleViolations []PlanError `json:"lifecycle_violations,omitempty"`
+
+	// RelevantAttributes lists the attributes of root module resources that
+	// the changing outputs depend on, so that the output changes can be
+	// correlated with the resource changes that caused them. Requires the
+	// configuration.
+	RelevantAttributes []ResourceAttr `json:"relevant_attributes,omitempty"`
+
+	// index is built on the first call to ResourceChange, Resource or
+	// ModuleOf. It reflects the resource changes and planned values as they
+	// were at that point.
+	index *planIndex
+}
+
+func newPlan() *Plan {
+	return &Plan{
+		FormatVersion:    FormatVersion,
+		TerraformVersion: version.String(),
+		Timestamp:        time.Now().UTC().Format(time.RFC3339),
+		index:            new(planIndex),
+	}
+}
+
+// Change is the representation of a proposed change for an object.
+type Change struct {
+	// Actions are the actions that will be taken on the object selected by the
+	// properties below. Valid actions values are:
+	//    ["no-op"]
+	//    ["create"]
+	//    ["read"]
+	//    ["update"]
+	//    ["delete", "create"]
+	//    ["create", "delete"]
+	//    ["delete"]
+	// The two "replace" actions are represented in this way to allow callers to
+	// e.g. just scan the list for "delete" to recognize all three situations
+	// where the object will be deleted, allowing for any new deletion
+	// combinations that might be added in future.
+	Actions []string `json:"actions,omitempty"`
+
+	// Before and After are representations of the object value both before and
+	// after the action. For ["create"] and ["delete"] actions, either "before"
+	// or "after" is unset (respectively). For ["no-op"], the before and after
+	// values are identical. The "after" value will be incomplete if there are
+	// values within it that won't be known until after apply: any unknown
+	// values are omitted or set to null, making them indistinguishable from
+	// absent values.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+
+	// AfterUnknown describes which parts of the After value won't be known
+	// until after apply. It mirrors the shape of the After value, with true
+	// in place of any value that is unknown. Known attributes of objects and
+	// maps are omitted, while known elements of sequences are set to false
+	// so that the elements line up with those of the value. A wholly-known
+	// value is represented as false.
+	AfterUnknown json.RawMessage `json:"after_unknown,omitempty"`
+
+	// BeforeSensitive and AfterSensitive describe which parts of the Before
+	// and After values are sensitive, so that callers can redact them. Each
+	// mirrors the shape of the corresponding value, with true at each
+	// sensitive attribute. Attributes that are not sensitive are omitted,
+	// and an absent value is represented as false. An attribute is sensitive
+	// if the schema says so or, for AfterSensitive, if its expression in the
+	// configuration refers to an input variable declared as sensitive.
+	BeforeSensitive json.RawMessage `json:"before_sensitive,omitempty"`
+	AfterSensitive  json.RawMessage `json:"after_sensitive,omitempty"`
+
+	// BeforeDiff and AfterDiff are set instead of Before and After for
+	// updates when the plan is marshaled with MarshallOptions.DiffOnly. Each
+	// contains only the parts of the corresponding value that differ from
+	// the other: objects keep just the attributes that changed, so that
+	// each changed value remains at the same path, while any other value
+	// that changed, including a list, is included whole. The sensitivity
+	// shapes above apply to them as to the full values.
+	BeforeDiff json.RawMessage `json:"before_diff,omitempty"`
+	AfterDiff  json.RawMessage `json:"after_diff,omitempty"`
+
+	// BeforeType and AfterType describe the types of the Before and After
+	// values when the plan is marshaled with MarshallOptions.IncludeTypes.
+	// For an object, each mirrors the object with the type of each of its
+	// attributes in place of the attribute's value; any other value is
+	// replaced by its type as a whole. Types are given in the json encoding
+	// of cty types, such as "number" or ["list","string"]. Each is omitted
+	// if the corresponding value is absent.
+	BeforeType json.RawMessage `json:"before_type,omitempty"`
+	AfterType  json.RawMessage `json:"after_type,omitempty"`
+
+	// decoded caches the decoded Before and After values for BeforeValue,
+	// AfterValue, AttributeBefore and AttributeAfter.
+	decoded *decodedValues
+}
+
+// IsReplace returns true if the change replaces the object, by both deleting
+// it and creating a new one in either order.
+func (c Change) IsReplace() bool {
+	return c.ReplaceOrder() != ""
+}
+
+// ReplaceOrder returns "delete-first" if the change replaces the object by
+// deleting it before creating its replacement, or "create-first" if the
+// replacement is created first. The result is empty if the change is not a
+// replacement.
+func (c Change) ReplaceOrder() string {
+	if len(c.Actions) != 2 {
+		return ""
+	}
+	switch {
+	case c.Actions[0] == "delete" && c.Actions[1] == "create":
+		return "delete-first"
+	case c.Actions[0] == "create" && c.Actions[1] == "delete":
+		return "create-first"
+	default:
+		return ""
+	}
+}
+
+// IsDestroy returns true if the change deletes the object, including as part
+// of a replacement.
+func (c Change) IsDestroy() bool {
+	for _, action := range c.Actions {
+		if action == "delete" {
+			return true
+		}
+	}
+	return false
+}
+
+// Symbol returns the symbol that Terraform's own plan output uses for the
+// change's actions: "+" for a create, "-" for a delete, "~" for an update,
+// "-/+" or "+/-" for a replacement that deletes or creates first
+// respectively, "<=" for a read, and " " for no-op. The result is empty for
+// any other combination of actions.
+func (c Change) Symbol() string {
+	switch c.ReplaceOrder() {
+	case "delete-first":
+		return "-/+"
+	case "create-first":
+		return "+/-"
+	}
+	if len(c.Actions) != 1 {
+		return ""
+	}
+	switch c.Actions[0] {
+	case "create":
+		return "+"
+	case "delete":
+		return "-"
+	case "update":
+		return "~"
+	case "read":
+		return "<="
+	case "no-op":
+		return " "
+	default:
+		return ""
+	}
+}
+
+// OutputChange is the representation of a change to a root module output
+// value.
+type OutputChange struct {
+	Change
+
+	// References lists the references in the output's expression, as for
+	// Expression. Omitted if the configuration is not available or if the
+	// expression has no references.
+	References []string `json:"references,omitempty"`
+}
+
+// Output is the representation of a resolved output value. The value of a
+// sensitive output is omitted.
+type Output struct {
+	Sensitive bool            `json:"sensitive,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+// Marshall returns the json encoding of a terraform plan.
+//
+// The given schemas must include the schemas for all of the resource types
+// that have changes in the given plan, since the planned values cannot be
+// decoded without them.
+func Marshall(
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+) ([]byte, error) {
+	return MarshallWithOptions(c, p, s, schemas, MarshallOptions{})
+}
+
+// MarshallOptions are the options for MarshallWithOptions. The zero value
+// gives the same result as Marshall.
+type MarshallOptions struct {
+	// Targets limits the plan to the parts that concern the given module and
+	// resource addresses and address patterns, as described for
+	// MarshallFiltered. If empty, the plan is not filtered.
+	Targets []string
+
+	// OmitNoOp causes resource changes whose only action is "no-op" to be
+	// left out of the resource changes, which can greatly reduce the size of
+	// plans for large configurations. The planned values remain complete
+	// unless OmitNoOpPlannedValues is also set.
+	OmitNoOp bool
+
+	// OmitNoOpPlannedValues causes resource instances with "no-op" changes
+	// to be left out of the planned values and proposed unknown values too.
+	OmitNoOpPlannedValues bool
+
+	// ProviderVersions gives the versions of the provider plugins selected
+	// for the configuration, keyed by provider name, which are reported as
+	// the resolved versions of the provider configurations. Providers that
+	// are not included have no resolved version.
+	ProviderVersions map[string]string
+
+	// Destroy indicates that the plan was created to destroy all of the
+	// objects in the prior state, as for "terraform plan -destroy". The plan
+	// itself doesn't record this.
+	Destroy bool
+
+	// RefreshOnly indicates that the plan was created only to update the
+	// state to match the remote objects, as for "terraform plan
+	// -refresh-only", so that its changes are given by the resource drift
+	// rather than the resource changes. It can't be combined with Destroy.
+	RefreshOnly bool
+
+	// RecordedState is the state as it was recorded before refreshing. If
+	// given, the differences between it and the refreshed prior state that
+	// the plan was created against are reported as resource drift.
+	RecordedState *states.State
+
+	// MaxValueBytes, if positive, limits the size of each primitive value
+	// within the before and after values of the resource and output changes.
+	// Any value larger than this is replaced by an object describing it, as
+	// described for TruncatedValue. The planned values are not affected.
+	MaxValueBytes int
+
+	// DiffOnly causes each resource change with the update action to have
+	// a BeforeDiff and AfterDiff, describing only the parts of the object
+	// that change, in place of its full before and after values. This
+	// reduces the size of plans that update large objects.
+	DiffOnly bool
+
+	// ProviderDefaults causes each update and replacement among the resource
+	// changes to list its ProviderDefaultAttributes, so that changes that
+	// originate from the provider rather than from the configuration can be
+	// told apart, as by ResourceChange.ChangedPaths.
+	ProviderDefaults bool
+
+	// IncludeTypes causes each resource change and output change to have a
+	// BeforeType and AfterType, describing the types of its values, for
+	// consumers that would otherwise have to infer them from the json.
+	IncludeTypes bool
+
+	// Timestamp is the time recorded as the timestamp of the plan. If zero,
+	// the current time is used. Setting it allows the same plan to be
+	// marshaled to exactly the same json more than once.
+	Timestamp time.Time
+}
+
+// MarshallWithOptions is a variant of Marshall that accepts options. Options
+// may be combined freely.
+func MarshallWithOptions(
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+	opts MarshallOptions,
+) ([]byte, error) {
+	output, _, err := marshallToPlan(c, p, s, schemas, true, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := json.Marshal(output)
+	return ret, err
+}
+
+// MarshallIndent is a variant of Marshall that indents the result for
+// readability, as for json.MarshalIndent. The result is otherwise identical
+// to that of Marshall, including the order of object properties.
+func MarshallIndent(
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+	prefix, indent string,
+) ([]byte, error) {
+	src, err := Marshall(c, p, s, schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, src, prefix, indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshallToPlan is a variant of Marshall that returns the json
+// representation of a terraform plan as a Plan value, rather than encoding
+// it.
+func MarshallToPlan(
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+) (*Plan, error) {
+	output, _, err := marshallToPlan(c, p, s, schemas, true, MarshallOptions{})
+	return output, err
+}
+
+// marshallToPlan implements MarshallToPlan, optionally leaving out the
+// resource changes for callers that will marshal them separately. It also
+// returns the loaded configuration, if any, which such callers need in order
+// to do so.
+func marshallToPlan(
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+	resourceChanges bool,
+	opts MarshallOptions,
+) (*Plan, *configs.Config, error) {
+	output := newPlan()
+	if !opts.Timestamp.IsZero() {
+		output.Timestamp = opts.Timestamp.UTC().Format(time.RFC3339)
+	}
+
+	targets, err := parseTargets(opts.Targets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output.PriorState, err = marshalPriorState(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in marshalPriorState: %s", err)
+	}
+
+	output.PlanMode = "normal"
+	switch {
+	case opts.Destroy && opts.RefreshOnly:
+		return nil, nil, fmt.Errorf("a plan can't be both a destroy plan and a refresh-only plan")
+	case opts.RefreshOnly:
+		output.PlanMode = "refresh-only"
+	case opts.Destroy:
+		output.PlanMode = "destroy"
+	}
+
+	config, sources, err := loadConfig(c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in loadConfig: %s", err)
+	}
+	output.marshalConfig(config, sources, schemas)
+	var vars map[string]plans.DynamicValue
+	if p != nil {
+		vars = p.VariableValues
+	}
+	output.marshalModuleCallValues(config, vars)
+	for i, pc := range output.Config.ProviderConfigs {
+		output.Config.ProviderConfigs[i].ResolvedVersion = opts.ProviderVersions[pc.Name]
+	}
+	output.ConfigHash = configHash(c)
+
+	if opts.RecordedState != nil {
+		err = output.marshalResourceDrift(opts.RecordedState, s, config, schemas)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in marshalResourceDrift: %s", err)
+		}
+	}
+
+	if p != nil && p.Changes != nil {
+		changes := p.Changes
+		if !targets.empty() {
+			changes = filterChanges(changes, config, targets)
+		}
+
+		if resourceChanges {
+			rcs := changes
+			if opts.OmitNoOp {
+				rcs = withoutNoOpResourceChanges(rcs)
+			}
+			err = output.marshalResourceChanges(rcs, config, s, schemas)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error in marshalResourceChanges: %s", err)
+			}
+		}
+
+		err = output.marshalOutputChanges(changes, config)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in marshalOutputChanges: %s", err)
+		}
+		output.marshalRelevantAttributes(config)
+
+		if opts.IncludeTypes {
+			err = output.annotateValueTypes(changes, schemas)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error in annotateValueTypes: %s", err)
+			}
+		}
+
+		if opts.OmitNoOpPlannedValues {
+			changes = withoutNoOpResourceChanges(changes)
+		}
+		err = output.marshalPlannedValues(changes, config, s, schemas)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in marshalPlannedValues: %s", err)
+		}
+		if !targets.empty() {
+			output.filterDeposed(targets)
+		}
+	}
+
+	if opts.ProviderDefaults {
+		output.markProviderDefaults(config, schemas)
+	}
+
+	if opts.DiffOnly {
+		err = output.diffOnlyChangeValues()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in diffOnlyChangeValues: %s", err)
+		}
+	}
+
+	if opts.MaxValueBytes > 0 {
+		err = output.truncateChangeValues(opts.MaxValueBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in truncateChangeValues: %s", err)
+		}
+	}
+
+	return output, config, nil
+}
+
+// withoutNoOpResourceChanges returns a copy of the given changes without the
+// resource changes whose action is plans.NoOp.
+func withoutNoOpResourceChanges(changes *plans.Changes) *plans.Changes {
+	ret := &plans.Changes{
+		Outputs: changes.Outputs,
+	}
+	for _, rc := range changes.Resources {
+		if rc.Action != plans.NoOp {
+			ret.Resources = append(ret.Resources, rc)
+		}
+	}
+	return ret
+}
+
+// marshalPriorState returns the prior state in the current state file
+// serialization format, or nil if there is no prior state to report.
+func marshalPriorState(s *states.State) (json.RawMessage, error) {
+	if s.Empty() {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	err := statefile.Write(statefile.New(s, "", 0), &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+// marshalResourceChanges populates the resource changes of the plan.
+func (p *Plan) marshalResourceChanges(changes *plans.Changes, config *configs.Config, s *states.State, schemas *terraform.Schemas) error {
+	if changes == nil {
+		// Nothing to do!
+		return nil
+	}
+	for _, rc := range sortedResourceChanges(changes.Resources) {
+		r, err := marshalResourceChange(rc, config, s, schemas)
+		if perr, ok := err.(PlanError); ok {
+			p.Errors = append(p.Errors, perr)
+		} else if err != nil {
+			return err
+		}
+		p.ResourceChanges = append(p.ResourceChanges, r)
+
+		if v, ok := preventDestroyViolation(rc, config); ok {
+			p.LifecycleViolations = append(p.LifecycleViolations, v)
+		}
+	}
+
+	return nil
+}
+
+// sortedResourceChanges returns a copy of the given changes in the order
+// described for Plan.ResourceChanges, so that the result does not depend on
+// the order in which the changes were planned.
+func sortedResourceChanges(changes []*plans.ResourceInstanceChangeSrc) []*plans.ResourceInstanceChangeSrc {
+	ret := make([]*plans.ResourceInstanceChangeSrc, len(changes))
+	copy(ret, changes)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		switch {
+		case a.Addr.Less(b.Addr):
+			return true
+		case b.Addr.Less(a.Addr):
+			return false
+		default:
+			// The current object, with no deposed key, sorts first.
+			return a.DeposedKey < b.DeposedKey
+		}
+	})
+	return ret
+}
+
+// marshalResourceChange returns the representation of a single resource
+// change. The given prior state, if any, is used to explain why objects are to
+// be replaced, and the given configuration, if any, to find attributes that
+// are sensitive because of the input variables they refer to.
+//
+// If the schema for the resource is not available then the result describes
+// only the address and actions of the change, and the returned error is a
+// PlanError that the caller should report in the plan's Errors.
+func marshalResourceChange(rc *plans.ResourceInstanceChangeSrc, config *configs.Config, s *states.State, schemas *terraform.Schemas) (ResourceChange, error) {
+	var r ResourceChange
+	addr := rc.Addr
+
+	if !addr.Module.IsRoot() {
+		r.ModuleAddress = addr.Module.String()
+	}
+	r.Address = addr.String()
+	r.Mode = marshalResourceMode(addr.Resource.Resource.Mode)
+	r.Type = addr.Resource.Resource.Type
+	r.Name = addr.Resource.Resource.Name
+	r.Index = marshalInstanceKey(addr.Resource.Key)
+	r.ProviderName = rc.ProviderAddr.ProviderConfig.Type
+	if rc.DeposedKey != states.NotDeposed {
+		r.DeposedKey = rc.DeposedKey.String()
+	}
+	r.ProviderChanged = providerChanged(rc, s)
+
+	providerName := r.ProviderName
+	schema := schemaForResource(schemas, providerName, addr.Resource.Resource)
+	if schema == nil {
+		var err error
+		r.Change.Actions, err = actionString(rc.Action)
+		if err != nil {
+			return r, fmt.Errorf("error marshaling change for %s: %s", r.Address, err)
+		}
+		r.InPlace = rc.Action == plans.Update
+		return r, missingSchemaError(r.Address, providerName, r.Type)
+	}
+
+	changeV, err := rc.Decode(schema.ImpliedType())
+	if err != nil {
+		return r, err
+	}
+
+	r.Change, err = marshalChange(changeV.Action, changeV.Before, changeV.After)
+	if err != nil {
+		return r, fmt.Errorf("error marshaling change for %s: %s", r.Address, err)
+	}
+
+	r.InPlace = changeV.Action == plans.Update
+
+	r.UnknownCount, err = countUnknown(r.Change.AfterUnknown)
+	if err != nil {
+		return r, fmt.Errorf("error counting unknown values for %s: %s", r.Address, err)
+	}
+
+	r.Change.BeforeSensitive, err = marshalSensitiveValues(changeV.Before, schema, nil)
+	if err != nil {
+		return r, fmt.Errorf("error marshaling sensitive values for %s: %s", r.Address, err)
+	}
+	r.Change.AfterSensitive, err = marshalSensitiveValues(changeV.After, schema, configSensitiveAttrs(addr, config, schema))
+	if err != nil {
+		return r, fmt.Errorf("error marshaling sensitive values for %s: %s", r.Address, err)
+	}
+
+	if r.Change.IsReplace() {
+		r.ReplacePaths, err = marshalPaths(rc.RequiredReplace)
+		if err != nil {
+			return r, fmt.Errorf("error marshaling replace paths for %s: %s", r.Address, err)
+		}
+		r.ActionReason = replaceReason(rc, s)
+		r.CreateBeforeDestroy = configCreateBeforeDestroy(addr, config)
+	}
+	if rc.Action == plans.Read {
+		// Data sources are read during planning whenever possible, so a
+		// read in the plan is always one deferred until apply because its
+		// configuration includes values that are not yet known.
+		r.ActionReason = "read_because_config_unknown"
+	}
+	r.TriggeredByModuleInput = triggeredByModuleInput(addr, changeV.Before, changeV.After, config, schema)
+
+	return r, nil
+}
+
+// configCreateBeforeDestroy returns true if the configuration of the given
+// managed resource instance sets the create_before_destroy lifecycle
+// argument. The result is false if the configuration is not available.
+func configCreateBeforeDestroy(addr addrs.AbsResourceInstance, config *configs.Config) bool {
+	if config == nil {
+		return false
+	}
+	modCfg := config.DescendentForInstance(addr.Module)
+	if modCfg == nil {
+		return false
+	}
+	rc := modCfg.Module.ResourceByAddr(addr.Resource.Resource)
+	return rc != nil && rc.Managed != nil && rc.Managed.CreateBeforeDestroy
+}
+
+// countUnknown returns the number of unknown values described by the given
+// AfterUnknown value.
+func countUnknown(afterUnknown json.RawMessage) (int, error) {
+	if len(afterUnknown) == 0 {
+		return 0, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(afterUnknown, &v); err != nil {
+		return 0, err
+	}
+	return countTrue(v), nil
+}
+
+// marshalOutputChanges populates the output changes of the plan from the given
+// changes. The given configuration, which may be nil, is used to find the
+// references in each output's expression.
+func (p *Plan) marshalOutputChanges(changes *plans.Changes, config *configs.Config) error {
+	if changes == nil {
+		// Nothing to do!
+		return nil
+	}
+
+	p.OutputChanges = make(map[string]OutputChange, len(changes.Outputs))
+	for _, oc := range changes.Outputs {
+		// Only root module outputs are externally visible, and so only those
+		// survive a round-trip through a plan file.
+		if !oc.Addr.Module.IsRoot() {
+			continue
+		}
+
+		changeV, err := oc.Decode()
+		if err != nil {
+			return err
+		}
+
+		c, err := marshalChange(changeV.Action, changeV.Before, changeV.After)
+		if err != nil {
+			return fmt.Errorf("error marshaling change for %s: %s", oc.Addr, err)
+		}
+
+		// An output value is either sensitive as a whole or not at all, so
+		// its sensitivity is just a boolean. The values of sensitive outputs
+		// are redacted altogether.
+		c.BeforeSensitive = marshalBool(oc.Sensitive && c.Before != nil)
+		c.AfterSensitive = marshalBool(oc.Sensitive && changeV.After != cty.NilVal && !changeV.After.IsNull())
+		if oc.Sensitive {
+			c.Before = nil
+			c.After = nil
+		}
+
+		var refs []string
+		if config != nil {
+			if output, ok := config.Module.Outputs[oc.Addr.OutputValue.Name]; ok {
+				refs = marshalExpression(output.Expr).References
+			}
+		}
+
+		p.OutputChanges[oc.Addr.OutputValue.Name] = OutputChange{
+			Change:     c,
+			References: refs,
+		}
+	}
+
+	return nil
+}
+
+// replaceReason returns the reason that the object of the given replace
+// change is to be replaced, or the empty string if no particular reason is
+// known.
+func replaceReason(rc *plans.ResourceInstanceChangeSrc, s *states.State) string {
+	if rc.DeposedKey == states.NotDeposed && currentObjectTainted(rc.Addr, s) {
+		return "replace_because_tainted"
+	}
+	if !rc.RequiredReplace.Empty() {
+		return "replace_because_cannot_update"
+	}
+	return ""
+}
+
+// currentObjectTainted returns true if the current object of the given
+// resource instance is tainted in the given state, which may be nil.
+func currentObjectTainted(addr addrs.AbsResourceInstance, s *states.State) bool {
+	if s == nil {
+		return false
+	}
+	is := s.ResourceInstance(addr)
+	return is != nil && is.Current != nil && is.Current.Status == states.ObjectTainted
+}
+
+// providerChanged returns true if the object of the given change exists in the
+// given prior state and its resource is recorded there as belonging to a
+// different provider configuration than the one the change is planned with.
+func providerChanged(rc *plans.ResourceInstanceChangeSrc, s *states.State) bool {
+	if s == nil {
+		return false
+	}
+	rs := s.Resource(rc.Addr.ContainingResource())
+	if rs == nil {
+		return false
+	}
+	is := rs.Instances[rc.Addr.Resource.Key]
+	if is == nil || is.GetGeneration(rc.DeposedKey.Generation()) == nil {
+		return false
+	}
+	return rs.ProviderConfig.String() != rc.ProviderAddr.String()
+}
+
+// marshalPaths returns the json encoding of the given set of paths, sorted so
+// that the result is deterministic, or nil if the set is empty.
+func marshalPaths(paths cty.PathSet) (json.RawMessage, error) {
+	if paths.Empty() {
+		return nil, nil
+	}
+
+	ret := make([]json.RawMessage, 0, len(paths.List()))
+	for _, path := range paths.List() {
+		steps := make([]interface{}, 0, len(path))
+		for _, step := range path {
+			switch step := step.(type) {
+			case cty.GetAttrStep:
+				steps = append(steps, step.Name)
+			case cty.IndexStep:
+				switch {
+				case step.Key.Type() == cty.String:
+					steps = append(steps, step.Key.AsString())
+				case step.Key.Type() == cty.Number:
+					steps = append(steps, json.Number(step.Key.AsBigFloat().Text('f', -1)))
+				default:
+					return nil, fmt.Errorf("unsupported index key type %s", step.Key.Type().FriendlyName())
+				}
+			}
+		}
+		raw, err := json.Marshal(steps)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, raw)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return string(ret[i]) < string(ret[j])
+	})
+	raw, err := json.Marshal(ret)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(raw), nil
+}
+
+// marshalChange produces the json representation of a change with the given
+// action and before and after values.
+func marshalChange(action plans.Action, before, after cty.Value) (Change, error) {
+	ret := Change{decoded: new(decodedValues)}
+	var err error
+
+	ret.Actions, err = actionString(action)
+	if err != nil {
+		return ret, err
+	}
+
+	ret.Before, err = marshalValue(before)
+	if err != nil {
+		return ret, fmt.Errorf("error marshaling before value: %s", err)
+	}
+
+	ret.After, err = marshalValue(omitUnknowns(after))
+	if err != nil {
+		return ret, fmt.Errorf("error marshaling after value: %s", err)
+	}
+
+	afterUnknown := unknownAsBool(after)
+	ret.AfterUnknown, err = ctyjson.Marshal(afterUnknown, afterUnknown.Type())
+	if err != nil {
+		return ret, fmt.Errorf("error marshaling unknown values: %s", err)
+	}
+
+	return ret, nil
+}
+
+// marshalValue returns the json encoding of the given value, or nil if the
+// value is absent. The given value must be wholly known.
+func marshalValue(val cty.Value) (json.RawMessage, error) {
+	if val == cty.NilVal || val.IsNull() {
+		return nil, nil
+	}
+
+	ret, err := ctyjson.Marshal(val, val.Type())
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(ret), nil
+}
+
+func marshalBool(b bool) json.RawMessage {
+	return json.RawMessage(strconv.FormatBool(b))
+}
+
+// omitUnknowns recursively walks the src cty.Value and returns a new cty.Value,
+// omitting any unknowns.
+//
+// Unknown elements of a sequence are replaced by nulls, so that the
+// remaining elements keep the same positions as their counterparts in the
+// result of unknownAsBool. The result is cty.NilVal if the given value is
+// itself unknown.
+func omitUnknowns(val cty.Value) cty.Value {
+	if val == cty.NilVal || val.IsNull() {
+		return val
+	}
+	if !val.IsKnown() {
+		return cty.NilVal
+	}
+	if val.IsWhollyKnown() {
+		return val
+	}
+
+	ty := val.Type()
+	switch {
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		var vals []cty.Value
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			newVal := omitUnknowns(v)
+			if newVal == cty.NilVal {
+				newVal = cty.NullVal(v.Type())
+			}
+			vals = append(vals, newVal)
+		}
+		if len(vals) == 0 {
+			return cty.EmptyTupleVal
+		}
+		return cty.TupleVal(vals)
+
+	case ty.IsMapType() || ty.IsObjectType():
+		vals := make(map[string]cty.Value)
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			newVal := omitUnknowns(v)
+			if newVal != cty.NilVal {
+				vals[k.AsString()] = newVal
+			}
+		}
+		return cty.ObjectVal(vals)
+	}
+
+	return val
+}
+
+// unknownAsBool returns a value of the same shape as the given value, with
+// true in place of each unknown value.
+//
+// Within objects and maps, the known attributes are omitted altogether,
+// while known elements of sequences are replaced by false so that element
+// positions are preserved. The result is false if the given value is
+// wholly known.
+func unknownAsBool(val cty.Value) cty.Value {
+	switch {
+	case val == cty.NilVal || val.IsNull():
+		return cty.False
+	case !val.IsKnown():
+		return cty.True
+	case val.IsWhollyKnown():
+		return cty.False
+	}
+
+	ty := val.Type()
+	switch {
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		vals := make([]cty.Value, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			vals = append(vals, unknownAsBool(v))
+		}
+		return cty.TupleVal(vals)
+
+	case ty.IsMapType() || ty.IsObjectType():
+		vals := make(map[string]cty.Value)
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			vAsBool := unknownAsBool(v)
+			if !vAsBool.RawEquals(cty.False) {
+				vals[k.AsString()] = vAsBool
+			}
+		}
+		return cty.ObjectVal(vals)
+	}
+
+	// Should never get here, since any value that is not a collection or
+	// structural type is either known or unknown.
+	return cty.False
+}
+
+// actionString returns the json representation of the given action.
+func actionString(action plans.Action) ([]string, error) {
+	switch action {
+	case plans.NoOp:
+		return []string{"no-op"}, nil
+	case plans.Create:
+		return []string{"create"}, nil
+	case plans.Read:
+		return []string{"read"}, nil
+	case plans.Update:
+		return []string{"update"}, nil
+	case plans.DeleteThenCreate:
+		return []string{"delete", "create"}, nil
+	case plans.CreateThenDelete:
+		return []string{"create", "delete"}, nil
+	case plans.Delete:
+		return []string{"delete"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported change action %s", action)
+	}
+}
+
+func marshalResourceMode(mode addrs.ResourceMode) ResourceMode {
+	switch mode {
+	case addrs.ManagedResourceMode:
+		return ManagedResourceMode
+	case addrs.DataResourceMode:
+		return DataResourceMode
+	default:
+		// Should never happen, since the above is exhaustive.
+		panic(fmt.Sprintf("unsupported resource mode %s", mode))
+	}
+}
+
+// marshalInstanceKey returns the json encoding of the given instance key, or
+// nil if there is no key.
+func marshalInstanceKey(key addrs.InstanceKey) json.RawMessage {
+	switch tk := key.(type) {
+	case addrs.IntKey:
+		return json.RawMessage(strconv.Itoa(int(tk)))
+	case addrs.StringKey:
+		// Marshaling a string can't fail.
+		ret, _ := json.Marshal(string(tk))
+		return json.RawMessage(ret)
+	default:
+		return nil
+	}
+}
+
+// schemaVersionForResource returns the version of the schema for the given
+// resource, belonging to the provider of the given type. Only managed resource
+// types have versioned schemas, so the result is always zero for data
+// resources, and also if no version is known.
+func schemaVersionForResource(schemas *terraform.Schemas, providerType string, addr addrs.Resource) uint64 {
+	if schemas == nil || addr.Mode != addrs.ManagedResourceMode {
+		return 0
+	}
+	ps := schemas.ProviderSchema(providerType)
+	if ps == nil {
+		return 0
+	}
+	return ps.ResourceTypeSchemaVersions[addr.Type]
+}
+
+// schemaForResource returns the schema for the given resource, belonging to
+// the provider of the given type, or nil if no such schema is available.
+func schemaForResource(schemas *terraform.Schemas, providerType string, addr addrs.Resource) *configschema.Block {
+	if schemas == nil {
+		return nil
+	}
+	ps := schemas.ProviderSchema(providerType)
+	if ps == nil {
+		return nil
+	}
+	return ps.SchemaForResourceAddr(addr)
+}
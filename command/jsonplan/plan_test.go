@@ -0,0 +1,1727 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statefile"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/version"
+)
+
+func TestMarshall(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Create,
+					cty.NullVal(testThingType),
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.UnknownVal(cty.String),
+						"ami": cty.StringVal("ami-123"),
+					}),
+				),
+				testResourceChange(t, "db", addrs.IntKey(0), plans.Update,
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.StringVal("i-abc"),
+						"ami": cty.StringVal("ami-123"),
+					}),
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.StringVal("i-abc"),
+						"ami": cty.StringVal("ami-456"),
+					}),
+				),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("10.0.0.1")),
+			},
+		},
+	}
+
+	got, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := `{
+		"format_version": "0.2",
+		"plan_mode": "normal",
+		"configuration": {"root_module": {}},
+		"planned_values": {
+			"outputs": {
+				"ip": {"value": "10.0.0.1"}
+			},
+			"root_module": {
+				"resources": [
+					{
+						"address": "test_thing.db[0]",
+						"index": 0,
+						"mode": "managed",
+						"type": "test_thing",
+						"name": "db",
+						"provider_name": "test",
+						"provider_config_key": "test",
+						"values": {"id": "i-abc", "ami": "ami-456"},
+						"sensitive_values": {}
+					},
+					{
+						"address": "test_thing.web",
+						"mode": "managed",
+						"type": "test_thing",
+						"name": "web",
+						"provider_name": "test",
+						"provider_config_key": "test",
+						"values": {"ami": "ami-123"},
+						"sensitive_values": {}
+					}
+				]
+			}
+		},
+		"proposed_unknown": {
+			"root_module": {
+				"resources": [
+					{
+						"address": "test_thing.db[0]",
+						"index": 0,
+						"mode": "managed",
+						"type": "test_thing",
+						"name": "db",
+						"provider_name": "test",
+						"provider_config_key": "test",
+						"values": {}
+					},
+					{
+						"address": "test_thing.web",
+						"mode": "managed",
+						"type": "test_thing",
+						"name": "web",
+						"provider_name": "test",
+						"provider_config_key": "test",
+						"values": {"id": true}
+					}
+				]
+			}
+		},
+		"resource_changes": [
+			{
+				"address": "test_thing.db[0]",
+				"mode": "managed",
+				"type": "test_thing",
+				"name": "db",
+				"index": 0,
+				"provider_name": "test",
+				"change": {
+					"actions": ["update"],
+					"before": {"id": "i-abc", "ami": "ami-123"},
+					"after": {"id": "i-abc", "ami": "ami-456"},
+					"after_unknown": false,
+					"before_sensitive": {},
+					"after_sensitive": {}
+				},
+				"in_place": true
+			},
+			{
+				"address": "test_thing.web",
+				"mode": "managed",
+				"type": "test_thing",
+				"name": "web",
+				"provider_name": "test",
+				"change": {
+					"actions": ["create"],
+					"after": {"ami": "ami-123"},
+					"after_unknown": {"id": true},
+					"before_sensitive": false,
+					"after_sensitive": {}
+				},
+				"unknown_count": 1
+			}
+		],
+		"output_changes": {
+			"ip": {
+				"actions": ["create"],
+				"after": "10.0.0.1",
+				"after_unknown": false,
+				"before_sensitive": false,
+				"after_sensitive": false
+			}
+		}
+	}`
+	assertJSONEqual(t, withoutMetadata(t, got), []byte(want))
+}
+
+func TestMarshall_metadata(t *testing.T) {
+	before := time.Now().UTC().Truncate(time.Second)
+	got, err := MarshallToPlan(nil, &plans.Plan{}, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().UTC()
+
+	if got, want := got.TerraformVersion, version.String(); got != want {
+		t.Errorf("wrong terraform version %q; want %q", got, want)
+	}
+	ts, err := time.Parse(time.RFC3339, got.Timestamp)
+	if err != nil {
+		t.Fatalf("invalid timestamp: %s", err)
+	}
+	if ts.Before(before) || ts.After(after) {
+		t.Errorf("timestamp %s is not between %s and %s", ts, before, after)
+	}
+
+	src, err := MarshallWithOptions(nil, &plans.Plan{}, nil, testSchemas(), MarshallOptions{
+		Timestamp: time.Date(2018, 10, 24, 9, 30, 0, 0, time.FixedZone("PDT", -7*60*60)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.Timestamp, "2018-10-24T16:30:00Z"; got != want {
+		t.Errorf("wrong timestamp %q; want %q", got, want)
+	}
+}
+
+func TestMarshallIndent(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.IntKey(0), plans.Update, before, after),
+				testModuleResourceChange(t, addrs.RootModuleInstance.Child("net", addrs.NoKey), "subnet", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("10.0.0.1")),
+			},
+		},
+	}
+
+	compact, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	indented, err := MarshallIndent(nil, plan, nil, testSchemas(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(indented, []byte("\n  \"format_version\": \"0.2\",\n")) {
+		t.Errorf("result is not indented as requested:\n%s", indented)
+	}
+
+	// Apart from the metadata, which varies between runs, the compacted form
+	// of the indented result must match the compact result exactly, which
+	// also shows that the properties appear in the same order.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, indented); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := withoutMetadata(t, buf.Bytes()), withoutMetadata(t, compact); !bytes.Equal(got, want) {
+		t.Errorf("indented result differs from compact result\ngot:  %s\nwant: %s", got, want)
+	}
+
+	assertJSONEqual(t, withoutMetadata(t, indented), withoutMetadata(t, compact))
+}
+
+func TestMarshallToPlan(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.StringKey("a"), plans.Delete,
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.StringVal("i-abc"),
+						"ami": cty.StringVal("ami-123"),
+					}),
+					cty.NullVal(testThingType),
+				),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := &Plan{
+		FormatVersion:    FormatVersion,
+		TerraformVersion: version.String(),
+		Timestamp:        got.Timestamp, // covered by TestMarshall_metadata
+		PlanMode:         "normal",
+		ResourceChanges: []ResourceChange{
+			{
+				Address:      `test_thing.web["a"]`,
+				Mode:         ManagedResourceMode,
+				Type:         "test_thing",
+				Name:         "web",
+				Index:        json.RawMessage(`"a"`),
+				ProviderName: "test",
+				Change: Change{
+					Actions: []string{"delete"},
+					Before:  []byte(`{"ami":"ami-123","id":"i-abc"}`),
+
+					AfterUnknown:    []byte(`false`),
+					BeforeSensitive: []byte(`{}`),
+					AfterSensitive:  []byte(`false`),
+					decoded:         new(decodedValues),
+				},
+			},
+		},
+		OutputChanges: map[string]OutputChange{},
+		index:         new(planIndex),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	// Marshall must produce the encoding of the same value.
+	src, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	wantSrc, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, withoutMetadata(t, src), withoutMetadata(t, wantSrc))
+}
+
+func TestMarshall_outputChanges(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "new", plans.Create, cty.NilVal, cty.StringVal("lb.example.com")),
+				testOutputChange(t, "changed", plans.Update, cty.StringVal("a.example.com"), cty.StringVal("b.example.com")),
+				testOutputChange(t, "unknown", plans.Update, cty.StringVal("a.example.com"), cty.UnknownVal(cty.String)),
+				testOutputChange(t, "removed", plans.Delete, cty.StringVal("gone"), cty.NilVal),
+				testOutputChangeSensitive(t, "secret", plans.Update, cty.StringVal("hunter2"), cty.StringVal("hunter3"), true),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := json.Marshal(p.OutputChanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+		"new": {
+			"actions": ["create"],
+			"after": "lb.example.com",
+			"after_unknown": false,
+			"before_sensitive": false,
+			"after_sensitive": false
+		},
+		"changed": {
+			"actions": ["update"],
+			"before": "a.example.com",
+			"after": "b.example.com",
+			"after_unknown": false,
+			"before_sensitive": false,
+			"after_sensitive": false
+		},
+		"unknown": {
+			"actions": ["update"],
+			"before": "a.example.com",
+			"after_unknown": true,
+			"before_sensitive": false,
+			"after_sensitive": false
+		},
+		"removed": {
+			"actions": ["delete"],
+			"before": "gone",
+			"after_unknown": false,
+			"before_sensitive": false,
+			"after_sensitive": false
+		},
+		"secret": {
+			"actions": ["update"],
+			"after_unknown": false,
+			"before_sensitive": true,
+			"after_sensitive": true
+		}
+	}`
+	assertJSONEqual(t, got, []byte(want))
+
+	// The sensitive value must not appear in the planned values either.
+	if got, want := p.PlannedValues.Outputs["secret"], (Output{Sensitive: true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong planned value for secret\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestMarshall_outputChangesOrder(t *testing.T) {
+	var outputs []*plans.OutputChangeSrc
+	for _, name := range []string{"zeta", "beta", "alpha", "gamma", "delta", "epsilon"} {
+		outputs = append(outputs, testOutputChange(t, name, plans.Create, cty.NilVal, cty.StringVal(name)))
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Outputs: outputs,
+		},
+	}
+
+	opts := MarshallOptions{Timestamp: time.Now()}
+	first, err := MarshallWithOptions(nil, plan, nil, testSchemas(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := MarshallWithOptions(nil, plan, nil, testSchemas(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, first) {
+			t.Fatalf("output differs between runs\nfirst: %s\ngot:   %s", first, got)
+		}
+	}
+
+	last := -1
+	for _, name := range []string{"alpha", "beta", "delta", "epsilon", "gamma", "zeta"} {
+		idx := bytes.Index(first, []byte(`"`+name+`":{`))
+		if idx < 0 {
+			t.Fatalf("no output change for %q in\n%s", name, first)
+		}
+		if idx < last {
+			t.Errorf("output change for %q is out of order in\n%s", name, first)
+		}
+		last = idx
+	}
+}
+
+func TestMarshall_outputReferences(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "name" {}
+
+resource "aws_instance" "web" {
+}
+
+output "ip" {
+  value = aws_instance.web.public_ip
+}
+
+output "greeting" {
+  value = "Hello, ${var.name}"
+}
+
+output "constant" {
+  value = "hello"
+}
+`,
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.UnknownVal(cty.String)),
+				testOutputChange(t, "greeting", plans.Create, cty.NilVal, cty.StringVal("Hello, world")),
+				testOutputChange(t, "constant", plans.Create, cty.NilVal, cty.StringVal("hello")),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"ip":       {"aws_instance.web.public_ip", "aws_instance.web"},
+		"greeting": {"var.name"},
+		"constant": nil,
+	}
+	for name, wantRefs := range want {
+		if got := p.OutputChanges[name].References; !reflect.DeepEqual(got, wantRefs) {
+			t.Errorf("wrong references for %s\ngot:  %#v\nwant: %#v", name, got, wantRefs)
+		}
+	}
+
+	// Without the configuration, the references are unknown.
+	p, err = MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.OutputChanges["ip"].References; got != nil {
+		t.Errorf("unexpected references without configuration: %#v", got)
+	}
+}
+
+func TestMarshallWithOptions_omitNoOp(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-456"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "created", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testResourceChange(t, "unchanged", addrs.NoKey, plans.NoOp, before, before),
+				testResourceChange(t, "updated", addrs.NoKey, plans.Update, before, after),
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		opts              MarshallOptions
+		wantChanges       []string
+		wantPlannedValues []string
+	}{
+		"default": {
+			MarshallOptions{},
+			[]string{"test_thing.created", "test_thing.unchanged", "test_thing.updated"},
+			[]string{"test_thing.created", "test_thing.unchanged", "test_thing.updated"},
+		},
+		"omit no-op changes": {
+			MarshallOptions{OmitNoOp: true},
+			[]string{"test_thing.created", "test_thing.updated"},
+			[]string{"test_thing.created", "test_thing.unchanged", "test_thing.updated"},
+		},
+		"omit no-op changes and planned values": {
+			MarshallOptions{OmitNoOp: true, OmitNoOpPlannedValues: true},
+			[]string{"test_thing.created", "test_thing.updated"},
+			[]string{"test_thing.created", "test_thing.updated"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			src, err := MarshallWithOptions(nil, plan, nil, testSchemas(), test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotChanges []string
+			for _, rc := range got.ResourceChanges {
+				gotChanges = append(gotChanges, rc.Address)
+			}
+			if !reflect.DeepEqual(gotChanges, test.wantChanges) {
+				t.Errorf("wrong resource changes\ngot:  %#v\nwant: %#v", gotChanges, test.wantChanges)
+			}
+
+			for _, values := range []Values{got.PlannedValues, got.ProposedUnknown} {
+				var gotValues []string
+				for _, r := range values.RootModule.Resources {
+					gotValues = append(gotValues, r.Address)
+				}
+				if !reflect.DeepEqual(gotValues, test.wantPlannedValues) {
+					t.Errorf("wrong planned values\ngot:  %#v\nwant: %#v", gotValues, test.wantPlannedValues)
+				}
+			}
+		})
+	}
+}
+
+func TestMarshallWithOptions_combined(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-456"),
+	})
+	netModule := addrs.RootModuleInstance.Child("net", addrs.NoKey)
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Update, before, after),
+				testModuleResourceChange(t, netModule, "unchanged", addrs.NoKey, plans.NoOp, before, before),
+				testModuleResourceChange(t, netModule, "updated", addrs.NoKey, plans.Update, before, after),
+			},
+		},
+	}
+
+	src, err := MarshallWithOptions(nil, plan, nil, testSchemas(), MarshallOptions{
+		Targets:  []string{"module.net"},
+		OmitNoOp: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotChanges []string
+	for _, rc := range got.ResourceChanges {
+		gotChanges = append(gotChanges, rc.Address)
+	}
+	wantChanges := []string{"module.net.test_thing.updated"}
+	if !reflect.DeepEqual(gotChanges, wantChanges) {
+		t.Errorf("wrong resource changes\ngot:  %#v\nwant: %#v", gotChanges, wantChanges)
+	}
+
+	// The planned values are filtered by target, but still include the
+	// no-op change.
+	if got := len(got.PlannedValues.RootModule.Resources); got != 0 {
+		t.Errorf("wrong number of root module planned values %d; want 0", got)
+	}
+	if got := len(got.PlannedValues.RootModule.ChildModules); got != 1 {
+		t.Fatalf("wrong number of child modules %d; want 1", got)
+	}
+	if got := len(got.PlannedValues.RootModule.ChildModules[0].Resources); got != 2 {
+		t.Errorf("wrong number of module.net planned values %d; want 2", got)
+	}
+}
+
+func TestMarshallWithOptions_planMode(t *testing.T) {
+	tests := map[string]struct {
+		opts MarshallOptions
+		want string
+	}{
+		"normal": {
+			MarshallOptions{},
+			"normal",
+		},
+		"destroy": {
+			MarshallOptions{Destroy: true},
+			"destroy",
+		},
+		"refresh-only": {
+			MarshallOptions{RefreshOnly: true},
+			"refresh-only",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			src, err := MarshallWithOptions(nil, &plans.Plan{}, nil, testSchemas(), test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.PlanMode != test.want {
+				t.Errorf("wrong plan mode %q; want %q", got.PlanMode, test.want)
+			}
+		})
+	}
+
+	t.Run("destroy and refresh-only", func(t *testing.T) {
+		_, err := MarshallWithOptions(nil, &plans.Plan{}, nil, testSchemas(), MarshallOptions{
+			Destroy:     true,
+			RefreshOnly: true,
+		})
+		if err == nil {
+			t.Fatal("succeeded; want error")
+		}
+	})
+}
+
+func TestMarshall_priorState(t *testing.T) {
+	state := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(
+			addrs.Resource{
+				Mode: addrs.ManagedResourceMode,
+				Type: "test_thing",
+				Name: "web",
+			}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+			&states.ResourceInstanceObjectSrc{
+				Status:    states.ObjectReady,
+				AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+			},
+			addrs.ProviderConfig{
+				Type: "test",
+			}.Absolute(addrs.RootModuleInstance),
+		)
+	})
+
+	got, err := Marshall(nil, &plans.Plan{}, state, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var p Plan
+	if err := json.Unmarshal(got, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	var prior struct {
+		Version   int `json:"version"`
+		Resources []struct {
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Instances []struct {
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(p.PriorState, &prior); err != nil {
+		t.Fatalf("invalid prior state: %s\n%s", err, p.PriorState)
+	}
+	if prior.Version != PriorStateVersion {
+		t.Errorf("wrong prior state version %d; want %d", prior.Version, PriorStateVersion)
+	}
+	if len(prior.Resources) != 1 || len(prior.Resources[0].Instances) != 1 {
+		t.Fatalf("wrong prior state resources\n%s", p.PriorState)
+	}
+	if got, want := prior.Resources[0].Instances[0].Attributes["ami"], "ami-123"; got != want {
+		t.Errorf("wrong ami %#v; want %#v", got, want)
+	}
+
+	// The prior state must also be readable as a state file, which checks
+	// it against the state file format.
+	f, err := statefile.Read(bytes.NewReader(p.PriorState))
+	if err != nil {
+		t.Fatalf("prior state is not a valid state file: %s", err)
+	}
+	if !f.State.Equal(state) {
+		t.Errorf("wrong prior state\ngot:  %s\nwant: %s", spew.Sdump(f.State), spew.Sdump(state))
+	}
+}
+
+func TestMarshall_emptyPriorState(t *testing.T) {
+	for name, state := range map[string]*states.State{"nil": nil, "empty": states.NewState()} {
+		t.Run(name, func(t *testing.T) {
+			got, err := Marshall(nil, &plans.Plan{}, state, testSchemas())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(got, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if raw, ok := fields["prior_state"]; ok {
+				t.Errorf("unexpected prior_state %s", raw)
+			}
+		})
+	}
+}
+
+func TestMarshall_replaceReasons(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+
+	forceNew := testResourceChange(t, "web", addrs.NoKey, plans.DeleteThenCreate, before, after)
+	forceNew.RequiredReplace = cty.NewPathSet(
+		cty.Path{}.GetAttr("ami"),
+		cty.Path{}.GetAttr("tags").Index(cty.StringVal("Name")),
+		cty.Path{}.GetAttr("disk").Index(cty.NumberIntVal(0)),
+	)
+	tainted := testResourceChange(t, "db", addrs.NoKey, plans.CreateThenDelete, before, before)
+	update := testResourceChange(t, "app", addrs.NoKey, plans.Update, before, after)
+
+	state := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(
+			tainted.Addr,
+			&states.ResourceInstanceObjectSrc{
+				Status:    states.ObjectTainted,
+				AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+			},
+			tainted.ProviderAddr,
+		)
+	})
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{forceNew, tainted, update},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, state, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(map[string]ResourceChange)
+	for _, rc := range got.ResourceChanges {
+		changes[rc.Address] = rc
+	}
+
+	web := changes["test_thing.web"]
+	assertJSONEqual(t, web.ReplacePaths, []byte(`[["ami"], ["disk", 0], ["tags", "Name"]]`))
+	if got, want := web.ActionReason, "replace_because_cannot_update"; got != want {
+		t.Errorf("wrong action reason for test_thing.web %q; want %q", got, want)
+	}
+
+	db := changes["test_thing.db"]
+	if db.ReplacePaths != nil {
+		t.Errorf("unexpected replace paths for test_thing.db: %s", db.ReplacePaths)
+	}
+	if got, want := db.ActionReason, "replace_because_tainted"; got != want {
+		t.Errorf("wrong action reason for test_thing.db %q; want %q", got, want)
+	}
+
+	app := changes["test_thing.app"]
+	if app.ReplacePaths != nil || app.ActionReason != "" {
+		t.Errorf("unexpected replacement details for test_thing.app: %s %q", app.ReplacePaths, app.ActionReason)
+	}
+}
+
+func TestMarshall_createBeforeDestroy(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_thing" "web" {
+  ami = "ami-456"
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+resource "test_thing" "db" {
+  ami = "ami-456"
+}
+`,
+	})
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.CreateThenDelete, before, after),
+				testResourceChange(t, "db", addrs.NoKey, plans.DeleteThenCreate, before, after),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web, ok := p.ResourceChange("test_thing.web")
+	if !ok {
+		t.Fatal("no change for test_thing.web")
+	}
+	if !web.CreateBeforeDestroy || web.Change.ReplaceOrder() != "create-first" {
+		t.Errorf("wrong replacement for test_thing.web: create_before_destroy %t, actions %q", web.CreateBeforeDestroy, web.Change.Actions)
+	}
+
+	db, ok := p.ResourceChange("test_thing.db")
+	if !ok {
+		t.Fatal("no change for test_thing.db")
+	}
+	if db.CreateBeforeDestroy || db.Change.ReplaceOrder() != "delete-first" {
+		t.Errorf("wrong replacement for test_thing.db: create_before_destroy %t, actions %q", db.CreateBeforeDestroy, db.Change.Actions)
+	}
+}
+
+func TestMarshall_providerChanged(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	east := addrs.ProviderConfig{Type: "test", Alias: "us_east"}.Absolute(addrs.RootModuleInstance)
+	west := addrs.ProviderConfig{Type: "test", Alias: "us_west"}.Absolute(addrs.RootModuleInstance)
+
+	moved := testResourceChange(t, "moved", addrs.NoKey, plans.DeleteThenCreate, before, after)
+	moved.ProviderAddr = west
+	stayed := testResourceChange(t, "stayed", addrs.NoKey, plans.NoOp, before, before)
+	stayed.ProviderAddr = east
+	created := testResourceChange(t, "created", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after)
+	created.ProviderAddr = west
+
+	state := states.BuildState(func(s *states.SyncState) {
+		for _, rc := range []*plans.ResourceInstanceChangeSrc{moved, stayed} {
+			s.SetResourceInstanceCurrent(
+				rc.Addr,
+				&states.ResourceInstanceObjectSrc{
+					Status:    states.ObjectReady,
+					AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+				},
+				east,
+			)
+		}
+	})
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{moved, stayed, created},
+		},
+	}
+	p, err := MarshallToPlan(nil, plan, state, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"test_thing.created": false,
+		"test_thing.moved":   true,
+		"test_thing.stayed":  false,
+	}
+	for addr, want := range want {
+		rc, ok := p.ResourceChange(addr)
+		if !ok {
+			t.Fatalf("no change for %s", addr)
+		}
+		if rc.ProviderChanged != want {
+			t.Errorf("wrong provider_changed for %s %t; want %t", addr, rc.ProviderChanged, want)
+		}
+	}
+}
+
+func TestMarshall_inPlace(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-456"),
+	})
+
+	tests := map[string]struct {
+		action plans.Action
+		before cty.Value
+		want   bool
+	}{
+		"update": {
+			plans.Update,
+			before,
+			true,
+		},
+		"replace": {
+			plans.DeleteThenCreate,
+			before,
+			false,
+		},
+		"create": {
+			plans.Create,
+			cty.NullVal(testThingType),
+			false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := &plans.Plan{
+				Changes: &plans.Changes{
+					Resources: []*plans.ResourceInstanceChangeSrc{
+						testResourceChange(t, "web", addrs.NoKey, test.action, test.before, after),
+					},
+				},
+			}
+			p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.ResourceChanges[0].InPlace; got != test.want {
+				t.Errorf("wrong in_place %t; want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMarshall_preventDestroy(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_thing" "db" {
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "test_thing" "web" {
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "test_thing" "cache" {
+}
+`,
+	})
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-456"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "db", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType)),
+				testResourceChange(t, "web", addrs.NoKey, plans.Update, before, after),
+				testResourceChange(t, "cache", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType)),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PlanError{
+		{
+			Address: "test_thing.db",
+			Summary: "Instance cannot be destroyed",
+			Detail:  "Resource test_thing.db has lifecycle.prevent_destroy set, but the plan calls for this resource to be destroyed. To avoid this error and continue with the plan, either disable lifecycle.prevent_destroy or reduce the scope of the plan using the -target flag.",
+		},
+	}
+	if !reflect.DeepEqual(p.LifecycleViolations, want) {
+		t.Errorf("wrong lifecycle violations\ngot:  %#v\nwant: %#v", p.LifecycleViolations, want)
+	}
+	if len(p.Errors) != 0 {
+		t.Errorf("unexpected errors: %#v", p.Errors)
+	}
+}
+
+func TestMarshall_deferredRead(t *testing.T) {
+	schemas := testSchemas()
+	schemas.Providers["test"].DataSources = map[string]*configschema.Block{
+		"test_thing": testThingSchema,
+	}
+
+	current := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+
+	// A data source whose configuration depends on a value that won't be
+	// known until apply is read then, rather than during planning.
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.UnknownVal(cty.String),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.DataResourceMode,
+			Type: "test_thing",
+			Name: "lookup",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Read,
+			Before: cty.NullVal(testThingType),
+			After:  after,
+		},
+	}
+	read, err := rc.Encode(testThingType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				read,
+				testResourceChange(t, "web", addrs.NoKey, plans.NoOp, current, current),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(map[string]ResourceChange)
+	for _, rc := range got.ResourceChanges {
+		changes[rc.Address] = rc
+	}
+
+	lookup := changes["data.test_thing.lookup"]
+	if got, want := lookup.Change.Actions, []string{"read"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong actions for data.test_thing.lookup %#v; want %#v", got, want)
+	}
+	if got, want := lookup.ActionReason, "read_because_config_unknown"; got != want {
+		t.Errorf("wrong action reason for data.test_thing.lookup %q; want %q", got, want)
+	}
+
+	if web := changes["test_thing.web"]; web.ActionReason != "" {
+		t.Errorf("unexpected action reason for test_thing.web %q", web.ActionReason)
+	}
+}
+
+func TestMarshall_unknownCount(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":  {Type: cty.String, Computed: true},
+			"ami": {Type: cty.String, Optional: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"network": {
+				Nesting: configschema.NestingSingle,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"ip": {Type: cty.String, Computed: true},
+					},
+					BlockTypes: map[string]*configschema.NestedBlock{
+						"interface": {
+							Nesting: configschema.NestingList,
+							Block: configschema.Block{
+								Attributes: map[string]*configschema.Attribute{
+									"name": {Type: cty.String, Optional: true},
+									"mac":  {Type: cty.String, Computed: true},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_nested"] = schema
+	ty := schema.ImpliedType()
+
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+		"network": cty.ObjectVal(map[string]cty.Value{
+			"ip": cty.UnknownVal(cty.String),
+			"interface": cty.ListVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{
+					"name": cty.StringVal("eth0"),
+					"mac":  cty.UnknownVal(cty.String),
+				}),
+			}),
+		}),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_nested",
+			Name: "web",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Create,
+			Before: cty.NullVal(ty),
+			After:  after,
+		},
+	}
+	create, err := rc.Encode(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				create,
+				testResourceChange(t, "db", addrs.NoKey, plans.Create, cty.NullVal(testThingType), known),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, rc := range got.ResourceChanges {
+		counts[rc.Address] = rc.UnknownCount
+	}
+	want := map[string]int{
+		"test_nested.web": 3,
+		"test_thing.db":   0,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("wrong unknown counts %#v; want %#v", counts, want)
+	}
+}
+
+func TestMarshall_moduleAddresses(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	nested := addrs.RootModuleInstance.Child("a", addrs.NoKey).Child("b", addrs.NoKey)
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "root", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, nested, "nested", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+		},
+	}
+
+	src, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var raw struct {
+		ResourceChanges []map[string]interface{} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(src, &raw); err != nil {
+		t.Fatal(err)
+	}
+	modules := make(map[string]interface{})
+	for _, rc := range raw.ResourceChanges {
+		addr, _ := rc["address"].(string)
+		if got, ok := rc["module_address"]; ok {
+			modules[addr] = got
+		}
+	}
+	want := map[string]interface{}{
+		"module.a.module.b.test_thing.nested": "module.a.module.b",
+	}
+	if !reflect.DeepEqual(modules, want) {
+		t.Errorf("wrong module addresses %#v; want %#v", modules, want)
+	}
+
+	got, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var planned []string
+	got.WalkModules(func(addr string, m *Module) error {
+		planned = append(planned, addr)
+		return nil
+	})
+	if want := []string{"", "module.a", "module.a.module.b"}; !reflect.DeepEqual(planned, want) {
+		t.Errorf("wrong planned module addresses %#v; want %#v", planned, want)
+	}
+}
+
+func TestMarshall_deposedObjects(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+
+	current := testResourceChange(t, "web", addrs.NoKey, plans.CreateThenDelete, before, after)
+	deposed1 := testResourceChange(t, "web", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType))
+	deposed1.DeposedKey = states.DeposedKey("00000001")
+	deposed2 := testResourceChange(t, "web", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType))
+	deposed2.DeposedKey = states.DeposedKey("00000002")
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{current, deposed1, deposed2},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotKeys []string
+	for _, rc := range got.ResourceChanges {
+		if rc.Address != "test_thing.web" {
+			t.Errorf("unexpected change for %s", rc.Address)
+		}
+		gotKeys = append(gotKeys, rc.DeposedKey)
+	}
+	wantKeys := []string{"", "00000001", "00000002"}
+	if !reflect.DeepEqual(gotKeys, wantKeys) {
+		t.Errorf("wrong deposed keys %#v; want %#v", gotKeys, wantKeys)
+	}
+
+	// Deposed objects are always deleted, so none of them appear in the
+	// planned values.
+	if got := len(got.PlannedValues.RootModule.Resources); got != 1 {
+		t.Errorf("wrong number of planned resources %d; want 1", got)
+	}
+}
+
+func TestMarshall_stableOrder(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	child := addrs.RootModuleInstance.Child("child", addrs.NoKey)
+
+	var changes []*plans.ResourceInstanceChangeSrc
+	for _, name := range []string{"b", "a"} {
+		for _, key := range []addrs.InstanceKey{addrs.IntKey(10), addrs.IntKey(2), addrs.IntKey(0)} {
+			changes = append(changes,
+				testResourceChange(t, name, key, plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, child, name, key, plans.Create, cty.NullVal(testThingType), after),
+			)
+		}
+	}
+	prior := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	deposed := testResourceChange(t, "a", addrs.IntKey(0), plans.Delete, prior, cty.NullVal(testThingType))
+	deposed.DeposedKey = states.DeposedKey("00000001")
+	changes = append(changes, deposed)
+
+	snap := testSnapshot(map[string]string{
+		"": `
+provider "test" {
+  alias = "z"
+}
+provider "test" {
+}
+provider "test" {
+  alias = "a"
+}
+`,
+	})
+
+	var want []byte
+	opts := MarshallOptions{Timestamp: time.Now()}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		shuffled := make([]*plans.ResourceInstanceChangeSrc, len(changes))
+		copy(shuffled, changes)
+		rnd.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		plan := &plans.Plan{
+			Changes: &plans.Changes{Resources: shuffled},
+		}
+		got, err := MarshallWithOptions(snap, plan, nil, testSchemas(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want == nil {
+			want = got
+		} else if !bytes.Equal(got, want) {
+			t.Fatalf("run %d produced different output\ngot:  %s\nwant: %s", i, got, want)
+		}
+	}
+
+	var p Plan
+	if err := json.Unmarshal(want, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotChanges []string
+	for _, rc := range p.ResourceChanges {
+		gotChanges = append(gotChanges, rc.Address+" "+rc.DeposedKey)
+	}
+	wantChanges := []string{
+		"test_thing.a[0] ",
+		"test_thing.a[0] 00000001",
+		"test_thing.a[2] ",
+		"test_thing.a[10] ",
+		"test_thing.b[0] ",
+		"test_thing.b[2] ",
+		"test_thing.b[10] ",
+		"module.child.test_thing.a[0] ",
+		"module.child.test_thing.a[2] ",
+		"module.child.test_thing.a[10] ",
+		"module.child.test_thing.b[0] ",
+		"module.child.test_thing.b[2] ",
+		"module.child.test_thing.b[10] ",
+	}
+	if !reflect.DeepEqual(gotChanges, wantChanges) {
+		t.Errorf("wrong resource change order\ngot:  %#v\nwant: %#v", gotChanges, wantChanges)
+	}
+
+	var gotPlanned []string
+	for _, r := range p.PlannedValues.RootModule.Resources {
+		gotPlanned = append(gotPlanned, r.Address)
+	}
+	wantPlanned := []string{
+		"test_thing.a[0]",
+		"test_thing.a[2]",
+		"test_thing.a[10]",
+		"test_thing.b[0]",
+		"test_thing.b[2]",
+		"test_thing.b[10]",
+	}
+	if !reflect.DeepEqual(gotPlanned, wantPlanned) {
+		t.Errorf("wrong planned resource order\ngot:  %#v\nwant: %#v", gotPlanned, wantPlanned)
+	}
+
+	var gotProviders []string
+	for _, pc := range p.Config.ProviderConfigs {
+		gotProviders = append(gotProviders, pc.Name+"."+pc.Alias)
+	}
+	wantProviders := []string{"test.", "test.a", "test.z"}
+	if !reflect.DeepEqual(gotProviders, wantProviders) {
+		t.Errorf("wrong provider config order\ngot:  %#v\nwant: %#v", gotProviders, wantProviders)
+	}
+}
+
+func TestMarshall_missingSchema(t *testing.T) {
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Create,
+					cty.NullVal(testThingType),
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.UnknownVal(cty.String),
+						"ami": cty.StringVal("ami-123"),
+					}),
+				),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, &terraform.Schemas{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The change is still reported as far as possible, without its values.
+	wantChanges := []ResourceChange{
+		{
+			Address:      "test_thing.web",
+			Mode:         ManagedResourceMode,
+			Type:         "test_thing",
+			Name:         "web",
+			ProviderName: "test",
+			Change: Change{
+				Actions: []string{"create"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got.ResourceChanges, wantChanges) {
+		t.Errorf("wrong resource changes\ngot:  %#v\nwant: %#v", got.ResourceChanges, wantChanges)
+	}
+	if got.PlannedValues.RootModule.Resources != nil {
+		t.Errorf("unexpected planned values %#v", got.PlannedValues.RootModule.Resources)
+	}
+
+	if len(got.Errors) != 1 {
+		t.Fatalf("wrong number of errors %d; want 1\n%#v", len(got.Errors), got.Errors)
+	}
+	if got, want := got.Errors[0].Address, "test_thing.web"; got != want {
+		t.Errorf("wrong error address %q; want %q", got, want)
+	}
+	if got, want := got.Errors[0].Summary, "Missing resource type schema"; got != want {
+		t.Errorf("wrong error summary %q; want %q", got, want)
+	}
+}
+
+func TestUnknownAsBool(t *testing.T) {
+	tests := map[string]struct {
+		Input cty.Value
+		Want  cty.Value
+	}{
+		"null": {
+			cty.NullVal(cty.String),
+			cty.False,
+		},
+		"known primitive": {
+			cty.StringVal("hello"),
+			cty.False,
+		},
+		"unknown primitive": {
+			cty.UnknownVal(cty.String),
+			cty.True,
+		},
+		"unknown list": {
+			cty.UnknownVal(cty.List(cty.String)),
+			cty.True,
+		},
+		"wholly known object": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.StringVal("hello"),
+			}),
+			cty.False,
+		},
+		"object with unknown attribute": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.StringVal("hello"),
+				"b": cty.UnknownVal(cty.String),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"b": cty.True,
+			}),
+		},
+		"list with unknown element": {
+			cty.ListVal([]cty.Value{
+				cty.StringVal("hello"),
+				cty.UnknownVal(cty.String),
+			}),
+			cty.TupleVal([]cty.Value{
+				cty.False,
+				cty.True,
+			}),
+		},
+		"set with computed attribute": {
+			cty.SetVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{
+					"name": cty.StringVal("web"),
+					"id":   cty.UnknownVal(cty.String),
+				}),
+			}),
+			cty.TupleVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{
+					"id": cty.True,
+				}),
+			}),
+		},
+		"nested object": {
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.ObjectVal(map[string]cty.Value{
+					"b": cty.ListVal([]cty.Value{
+						cty.UnknownVal(cty.String),
+					}),
+					"c": cty.StringVal("hello"),
+				}),
+				"d": cty.StringVal("hello"),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"a": cty.ObjectVal(map[string]cty.Value{
+					"b": cty.TupleVal([]cty.Value{cty.True}),
+				}),
+			}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := unknownAsBool(test.Input)
+			if !got.RawEquals(test.Want) {
+				t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestMarshallChange_unknownInSet(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"rule": cty.SetVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{
+				"name": cty.StringVal("web"),
+				"id":   cty.UnknownVal(cty.String),
+			}),
+		}),
+	})
+
+	got, err := marshalChange(plans.Create, cty.NullVal(after.Type()), after)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	assertJSONEqual(t, got.After, []byte(`{"rule": [{"name": "web"}]}`))
+	assertJSONEqual(t, got.AfterUnknown, []byte(`{"rule": [{"id": true}]}`))
+}
+
+var testThingType = testThingSchema.ImpliedType()
+
+func TestChangeActions(t *testing.T) {
+	tests := map[plans.Action]struct {
+		Replace      bool
+		ReplaceOrder string
+		Destroy      bool
+		Symbol       string
+	}{
+		plans.NoOp:             {false, "", false, " "},
+		plans.Create:           {false, "", false, "+"},
+		plans.Read:             {false, "", false, "<="},
+		plans.Update:           {false, "", false, "~"},
+		plans.DeleteThenCreate: {true, "delete-first", true, "-/+"},
+		plans.CreateThenDelete: {true, "create-first", true, "+/-"},
+		plans.Delete:           {false, "", true, "-"},
+	}
+
+	for action, test := range tests {
+		t.Run(action.String(), func(t *testing.T) {
+			actions, err := actionString(action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := Change{Actions: actions}
+
+			if got := c.IsReplace(); got != test.Replace {
+				t.Errorf("wrong IsReplace for %q: got %t, want %t", actions, got, test.Replace)
+			}
+			if got := c.ReplaceOrder(); got != test.ReplaceOrder {
+				t.Errorf("wrong ReplaceOrder for %q: got %q, want %q", actions, got, test.ReplaceOrder)
+			}
+			if got := c.IsDestroy(); got != test.Destroy {
+				t.Errorf("wrong IsDestroy for %q: got %t, want %t", actions, got, test.Destroy)
+			}
+			if got := c.Symbol(); got != test.Symbol {
+				t.Errorf("wrong Symbol for %q: got %q, want %q", actions, got, test.Symbol)
+			}
+		})
+	}
+
+	for _, actions := range [][]string{nil, {"update", "update"}, {"explode"}} {
+		if got := (Change{Actions: actions}).Symbol(); got != "" {
+			t.Errorf("wrong Symbol for %q: got %q, want \"\"", actions, got)
+		}
+	}
+}
+
+var testThingSchema = &configschema.Block{
+	Attributes: map[string]*configschema.Attribute{
+		"id":  {Type: cty.String, Computed: true},
+		"ami": {Type: cty.String, Optional: true},
+	},
+}
+
+func testSchemas() *terraform.Schemas {
+	return &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				Provider: &configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"region": {Type: cty.String, Optional: true},
+					},
+				},
+				ResourceTypes: map[string]*configschema.Block{
+					"test_thing": testThingSchema,
+				},
+			},
+		},
+	}
+}
+
+// testResourceChange returns the encoded change for the root module
+// test_thing resource of the given name and instance key.
+func testResourceChange(t testing.TB, name string, key addrs.InstanceKey, action plans.Action, before, after cty.Value) *plans.ResourceInstanceChangeSrc {
+	t.Helper()
+	return testModuleResourceChange(t, addrs.RootModuleInstance, name, key, action, before, after)
+}
+
+// testModuleResourceChange returns the encoded change for the test_thing
+// resource of the given name and instance key within the given module.
+func testModuleResourceChange(t testing.TB, module addrs.ModuleInstance, name string, key addrs.InstanceKey, action plans.Action, before, after cty.Value) *plans.ResourceInstanceChangeSrc {
+	t.Helper()
+
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_thing",
+			Name: name,
+		}.Instance(key).Absolute(module),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(module),
+		Change: plans.Change{
+			Action: action,
+			Before: before,
+			After:  after,
+		},
+	}
+
+	ret, err := rc.Encode(before.Type())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// testOutputChange returns the encoded change for the root module output of
+// the given name.
+func testOutputChange(t *testing.T, name string, action plans.Action, before, after cty.Value) *plans.OutputChangeSrc {
+	t.Helper()
+	return testOutputChangeSensitive(t, name, action, before, after, false)
+}
+
+// testOutputChangeSensitive is a variant of testOutputChange that can mark
+// the output as sensitive.
+func testOutputChangeSensitive(t *testing.T, name string, action plans.Action, before, after cty.Value, sensitive bool) *plans.OutputChangeSrc {
+	t.Helper()
+
+	oc := &plans.OutputChange{
+		Addr: addrs.OutputValue{Name: name}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: action,
+			Before: before,
+			After:  after,
+		},
+		Sensitive: sensitive,
+	}
+
+	ret, err := oc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// withoutMetadata returns the given plan json without its terraform_version
+// and timestamp properties, which vary between builds and runs, after
+// checking that they are present.
+func withoutMetadata(t *testing.T, src []byte) []byte {
+	t.Helper()
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(src, &doc); err != nil {
+		t.Fatalf("invalid plan json: %s\n%s", err, src)
+	}
+	for _, name := range []string{"terraform_version", "timestamp"} {
+		if _, ok := doc[name]; !ok {
+			t.Errorf("plan json has no %q property", name)
+		}
+		delete(doc, name)
+	}
+
+	ret, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// assertJSONEqual fails the test if the two given json documents do not
+// decode to the same value.
+func assertJSONEqual(t *testing.T, got, want []byte) {
+	t.Helper()
+
+	var gotV, wantV interface{}
+	if err := json.Unmarshal(got, &gotV); err != nil {
+		t.Fatalf("invalid result json: %s\n%s", err, got)
+	}
+	if err := json.Unmarshal(want, &wantV); err != nil {
+		t.Fatalf("invalid expected json: %s\n%s", err, want)
+	}
+
+	if !reflect.DeepEqual(gotV, wantV) {
+		t.Fatalf("wrong result\ngot:  %s\nwant: %s", got, want)
+	}
+}
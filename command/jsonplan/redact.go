@@ -0,0 +1,162 @@
+package jsonplan
+
+import (
+	"encoding/json"
+)
+
+// RedactedValue is the placeholder that Redact substitutes for each sensitive
+// value.
+const RedactedValue = "(sensitive value)"
+
+// Redact returns a copy of the plan in which each sensitive value within the
+// before and after values of the resource and output changes and of the
+// resource drift, and within the planned values of resources, is replaced by
+// RedactedValue. Which values are sensitive is decided only by the changes'
+// BeforeSensitive and AfterSensitive shapes, and the planned values of a
+// resource by their SensitiveValues, or by the AfterSensitive of the
+// resource's change for documents that predate them, so all other values are
+// left as they are. The structure of each value is preserved, so redacted
+// values remain at the same paths.
+//
+// The prior state doesn't describe which of its values are sensitive, and so
+// the copy has none. The configuration is left as it is, since the constant
+// values of sensitive arguments are already omitted from it. The plan itself
+// is not modified.
+func (p *Plan) Redact() *Plan {
+	ret := *p
+	ret.PriorState = nil
+	ret.index = new(planIndex)
+
+	afterSensitive := make(map[string]json.RawMessage, len(p.ResourceChanges))
+	if p.ResourceChanges != nil {
+		ret.ResourceChanges = make([]ResourceChange, len(p.ResourceChanges))
+		for i, rc := range p.ResourceChanges {
+			rc.Change = redactChange(rc.Change)
+			ret.ResourceChanges[i] = rc
+
+			if rc.DeposedKey == "" {
+				afterSensitive[rc.Address] = rc.Change.AfterSensitive
+			}
+		}
+	}
+
+	if p.ResourceDrift != nil {
+		ret.ResourceDrift = make([]ResourceChange, len(p.ResourceDrift))
+		for i, rc := range p.ResourceDrift {
+			rc.Change = redactChange(rc.Change)
+			ret.ResourceDrift[i] = rc
+		}
+	}
+
+	if p.OutputChanges != nil {
+		ret.OutputChanges = make(map[string]OutputChange, len(p.OutputChanges))
+		for name, oc := range p.OutputChanges {
+			oc.Change = redactChange(oc.Change)
+			ret.OutputChanges[name] = oc
+		}
+	}
+
+	ret.PlannedValues.RootModule = redactModule(p.PlannedValues.RootModule, afterSensitive)
+
+	return &ret
+}
+
+func redactChange(c Change) Change {
+	c.decoded = new(decodedValues)
+	c.Before = redactValue(c.Before, c.BeforeSensitive)
+	c.After = redactValue(c.After, c.AfterSensitive)
+	c.BeforeDiff = redactValue(c.BeforeDiff, c.BeforeSensitive)
+	c.AfterDiff = redactValue(c.AfterDiff, c.AfterSensitive)
+	return c
+}
+
+func redactModule(m Module, sensitive map[string]json.RawMessage) Module {
+	ret := m
+
+	if m.Resources != nil {
+		ret.Resources = make([]Resource, len(m.Resources))
+		for i, r := range m.Resources {
+			shape := r.SensitiveValues
+			if shape == nil {
+				shape = sensitive[r.Address]
+			}
+			r.Values = redactValue(r.Values, shape)
+			ret.Resources[i] = r
+		}
+	}
+
+	if m.Deposed != nil {
+		ret.Deposed = make([]Resource, len(m.Deposed))
+		for i, r := range m.Deposed {
+			r.Values = redactValue(r.Values, r.SensitiveValues)
+			ret.Deposed[i] = r
+		}
+	}
+
+	if m.ChildModules != nil {
+		ret.ChildModules = make([]Module, len(m.ChildModules))
+		for i, child := range m.ChildModules {
+			ret.ChildModules[i] = redactModule(child, sensitive)
+		}
+	}
+
+	return ret
+}
+
+// redactValue returns the given json value with each part marked as true in the
+// given sensitivity shape replaced by RedactedValue. Absent and null values
+// are returned unchanged, since they reveal nothing. If either the value or
+// the shape can't be decoded then the value is omitted entirely, rather than
+// risking revealing any part of it.
+func redactValue(raw, sensitive json.RawMessage) json.RawMessage {
+	if len(raw) == 0 || len(sensitive) == 0 {
+		return raw
+	}
+
+	var v, shape interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(sensitive, &shape); err != nil {
+		return nil
+	}
+	if !containsTrue(shape) {
+		return raw
+	}
+
+	ret, err := json.Marshal(redact(v, shape))
+	if err != nil {
+		return nil
+	}
+	return ret
+}
+
+func redact(v, shape interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch shape := shape.(type) {
+	case bool:
+		if shape {
+			return RedactedValue
+		}
+	case []interface{}:
+		if elems, ok := v.([]interface{}); ok {
+			for i := range elems {
+				if i < len(shape) {
+					elems[i] = redact(elems[i], shape[i])
+				}
+			}
+		}
+	case map[string]interface{}:
+		if attrs, ok := v.(map[string]interface{}); ok {
+			for name, attrShape := range shape {
+				if attr, ok := attrs[name]; ok {
+					attrs[name] = redact(attr, attrShape)
+				}
+			}
+		}
+	}
+	return v
+}
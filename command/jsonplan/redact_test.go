@@ -0,0 +1,234 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestPlanRedact(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":        {Type: cty.String, Computed: true},
+			"ami":       {Type: cty.String, Optional: true},
+			"public_ip": {Type: cty.String, Optional: true},
+			"password":  {Type: cty.String, Optional: true, Sensitive: true},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_db"] = schema
+	ty := schema.ImpliedType()
+
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":        cty.StringVal("db-1"),
+		"ami":       cty.StringVal("ami-123"),
+		"public_ip": cty.StringVal("203.0.113.10"),
+		"password":  cty.StringVal("hunter2"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":        cty.StringVal("db-1"),
+		"ami":       cty.StringVal("ami-123"),
+		"public_ip": cty.StringVal("203.0.113.10"),
+		"password":  cty.StringVal("hunter3"),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_db",
+			Name: "main",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Update,
+			Before: before,
+			After:  after,
+		},
+	}
+	update, err := rc.Encode(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{update},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("203.0.113.10")),
+				testOutputChangeSensitive(t, "secret", plans.Update, cty.StringVal("hunter2"), cty.StringVal("hunter3"), true),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, ok := p.ResourceChanges[0].Change.AttributeAfter("password")
+	if !ok || original != "hunter3" {
+		t.Fatalf("wrong password before redacting %#v", original)
+	}
+
+	got := p.Redact()
+
+	change := got.ResourceChanges[0].Change
+	assertJSONEqual(t, change.Before, []byte(`{"id":"db-1","ami":"ami-123","public_ip":"203.0.113.10","password":"(sensitive value)"}`))
+	assertJSONEqual(t, change.After, []byte(`{"id":"db-1","ami":"ami-123","public_ip":"203.0.113.10","password":"(sensitive value)"}`))
+
+	r, ok := got.Resource("test_db.main")
+	if !ok {
+		t.Fatal("no planned values for test_db.main")
+	}
+	assertJSONEqual(t, r.Values, []byte(`{"id":"db-1","ami":"ami-123","public_ip":"203.0.113.10","password":"(sensitive value)"}`))
+
+	assertJSONEqual(t, got.OutputChanges["ip"].After, []byte(`"203.0.113.10"`))
+	if secret := got.OutputChanges["secret"]; secret.Before != nil || secret.After != nil {
+		t.Errorf("sensitive output has values %s and %s", secret.Before, secret.After)
+	}
+
+	// The original plan is left as it was.
+	if v, _ := p.ResourceChanges[0].Change.AttributeAfter("password"); v != "hunter3" {
+		t.Errorf("original plan was modified; password is now %#v", v)
+	}
+	if r, _ := p.Resource("test_db.main"); r != nil {
+		if v, _ := lookupValuePath(r.Values, []string{"password"}); v != "hunter3" {
+			t.Errorf("original planned values were modified; password is now %#v", v)
+		}
+	}
+}
+
+func TestPlanRedact_configuration(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_db" "main" {
+  ami      = "ami-123"
+  password = "hunter2"
+}
+`,
+	})
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"ami":      {Type: cty.String, Optional: true},
+			"password": {Type: cty.String, Optional: true, Sensitive: true},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_db"] = schema
+	ty := schema.ImpliedType()
+
+	create, err := (&plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_db",
+			Name: "main",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Create,
+			Before: cty.NullVal(ty),
+			After: cty.ObjectVal(map[string]cty.Value{
+				"ami":      cty.StringVal("ami-123"),
+				"password": cty.StringVal("hunter2"),
+			}),
+		},
+	}).Encode(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{create},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exprs := p.Config.RootModule.Resources[0].Expressions
+	assertJSONEqual(t, exprs["ami"].ConstantValue, []byte(`"ami-123"`))
+	if got := exprs["password"]; got.ConstantValue != nil || got.Raw != "" {
+		t.Errorf("configuration reveals the sensitive password: %s %q", got.ConstantValue, got.Raw)
+	}
+
+	src, err := json.Marshal(p.Redact())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(src, []byte("hunter2")) {
+		t.Errorf("redacted plan reveals the sensitive password:\n%s", src)
+	}
+}
+
+func TestPlanRedact_resourceDrift(t *testing.T) {
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_db": {
+						Attributes: map[string]*configschema.Attribute{
+							"id":       {Type: cty.String, Computed: true},
+							"password": {Type: cty.String, Optional: true, Sensitive: true},
+						},
+					},
+				},
+			},
+		},
+	}
+	addr := addrs.Resource{
+		Mode: addrs.ManagedResourceMode,
+		Type: "test_db",
+		Name: "main",
+	}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance)
+	provider := addrs.ProviderConfig{Type: "test"}.Absolute(addrs.RootModuleInstance)
+	object := func(attrs string) *states.ResourceInstanceObjectSrc {
+		return &states.ResourceInstanceObjectSrc{
+			Status:    states.ObjectReady,
+			AttrsJSON: []byte(attrs),
+		}
+	}
+
+	recorded := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(addr, object(`{"id":"db-1","password":"hunter2"}`), provider)
+	})
+	refreshed := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(addr, object(`{"id":"db-1","password":"hunter3"}`), provider)
+	})
+
+	src, err := MarshallWithOptions(nil, &plans.Plan{Changes: plans.NewChanges()}, refreshed, schemas, MarshallOptions{
+		RecordedState: recorded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.ResourceDrift) != 1 {
+		t.Fatalf("wrong number of drifted resources %d; want 1", len(p.ResourceDrift))
+	}
+
+	got := p.Redact()
+
+	change := got.ResourceDrift[0].Change
+	assertJSONEqual(t, change.Before, []byte(`{"id":"db-1","password":"(sensitive value)"}`))
+	assertJSONEqual(t, change.After, []byte(`{"id":"db-1","password":"(sensitive value)"}`))
+
+	// The original plan is left as it was.
+	if v, _ := p.ResourceDrift[0].Change.AttributeAfter("password"); v != "hunter3" {
+		t.Errorf("original plan was modified; password is now %#v", v)
+	}
+}
@@ -0,0 +1,91 @@
+package jsonplan
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/lang"
+)
+
+// unknownReferences returns, for each top-level attribute of the given planned
+// value that is not wholly known, the references within the attribute's
+// expression in the configuration to values that may not be known until
+// after apply: the attributes of resources and the outputs of module calls,
+// including those reached through local values. The references are relative
+// to the module containing the resource, as for Expression.References, and
+// are sorted.
+//
+// Attributes whose expressions refer to none of these, such as those that
+// are wholly computed by the provider, are omitted. The result is nil if
+// there are none, or if the configuration is not available.
+func unknownReferences(addr addrs.AbsResourceInstance, after cty.Value, config *configs.Config, schema *configschema.Block) map[string][]string {
+	if config == nil || after == cty.NilVal || after.IsNull() || after.IsWhollyKnown() || !after.IsKnown() {
+		return nil
+	}
+	modCfg := config.DescendentForInstance(addr.Module)
+	if modCfg == nil {
+		return nil
+	}
+	rc := modCfg.Module.ResourceByAddr(addr.Resource.Resource)
+	if rc == nil || rc.Config == nil {
+		return nil
+	}
+
+	// As in configSensitiveAttrs, we need the raw expressions.
+	content, _, _ := rc.Config.PartialContent(hcldec.ImpliedSchema(schema.DecoderSpec()))
+	if content == nil {
+		return nil
+	}
+
+	var ret map[string][]string
+	for name, attr := range content.Attributes {
+		if !after.Type().HasAttribute(name) || after.GetAttr(name).IsWhollyKnown() {
+			continue
+		}
+
+		seen := make(map[string]bool)
+		deferredReferences(attr.Expr, modCfg.Module, make(map[string]bool), seen)
+		if len(seen) == 0 {
+			continue
+		}
+		refs := make([]string, 0, len(seen))
+		for ref := range seen {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+
+		if ret == nil {
+			ret = make(map[string][]string)
+		}
+		ret[name] = refs
+	}
+	return ret
+}
+
+// deferredReferences adds to refs each reference within the given expression
+// to a resource or module call output, following references to the local
+// values of the given module. Local values already in visited are skipped,
+// so that cycles are not followed.
+func deferredReferences(expr hcl.Expression, mod *configs.Module, visited, refs map[string]bool) {
+	found, _ := lang.ReferencesInExpr(expr)
+	for _, ref := range found {
+		switch subject := ref.Subject.(type) {
+		case addrs.Resource, addrs.ResourceInstance, addrs.ModuleCallOutput, addrs.ModuleCallInstance:
+			refs[ref.Subject.String()+traversalString(ref.Remaining)] = true
+		case addrs.LocalValue:
+			if visited[subject.Name] {
+				continue
+			}
+			visited[subject.Name] = true
+			if l, ok := mod.Locals[subject.Name]; ok {
+				deferredReferences(l.Expr, mod, visited, refs)
+			}
+		}
+	}
+}
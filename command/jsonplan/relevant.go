@@ -0,0 +1,126 @@
+package jsonplan
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/lang"
+)
+
+// ResourceAttr identifies an attribute of a resource in the root module that
+// the value of a changing output depends on.
+type ResourceAttr struct {
+	// Resource is the address of the resource or resource instance, as it is
+	// referred to in the configuration, such as "aws_instance.web" or
+	// "aws_instance.web[0]".
+	Resource string `json:"resource"`
+
+	// Attribute is the path to the attribute within the resource's value.
+	// Each step is either the name of an attribute, a map key or a list
+	// index, such as ["network_interface", 0, "private_ip"].
+	Attribute []interface{} `json:"attribute"`
+}
+
+// marshalRelevantAttributes populates the relevant attributes of the plan with
+// the resource attributes referred to by the expressions of the outputs with
+// changes other than no-op changes, including those reached through local
+// values, sorted by resource and then by attribute path. It must be called
+// after marshalOutputChanges.
+func (p *Plan) marshalRelevantAttributes(config *configs.Config) {
+	if config == nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for name, oc := range p.OutputChanges {
+		if a := oc.Change.Actions; len(a) == 1 && a[0] == "no-op" {
+			continue
+		}
+		output, ok := config.Module.Outputs[name]
+		if !ok {
+			continue
+		}
+
+		var refs []*addrs.Reference
+		localReferences(output.Expr, config.Module, make(map[string]bool), &refs)
+		for _, ref := range refs {
+			switch ref.Subject.(type) {
+			case addrs.Resource, addrs.ResourceInstance:
+			default:
+				continue
+			}
+			attr := ResourceAttr{
+				Resource:  ref.Subject.String(),
+				Attribute: attributePath(ref.Remaining),
+			}
+			if len(attr.Attribute) == 0 {
+				continue
+			}
+			key := attr.Resource + traversalString(ref.Remaining)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			p.RelevantAttributes = append(p.RelevantAttributes, attr)
+		}
+	}
+
+	sort.Slice(p.RelevantAttributes, func(i, j int) bool {
+		a, b := p.RelevantAttributes[i], p.RelevantAttributes[j]
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		return fmt.Sprint(a.Attribute...) < fmt.Sprint(b.Attribute...)
+	})
+}
+
+// localReferences adds to refs each reference within the given expression,
+// following references to the local values of the given module as for
+// deferredReferences.
+func localReferences(expr hcl.Expression, mod *configs.Module, visited map[string]bool, refs *[]*addrs.Reference) {
+	found, _ := lang.ReferencesInExpr(expr)
+	for _, ref := range found {
+		l, ok := ref.Subject.(addrs.LocalValue)
+		if !ok {
+			*refs = append(*refs, ref)
+			continue
+		}
+		if visited[l.Name] {
+			continue
+		}
+		visited[l.Name] = true
+		if lc, ok := mod.Locals[l.Name]; ok {
+			localReferences(lc.Expr, mod, visited, refs)
+		}
+	}
+}
+
+// attributePath returns the steps of the given traversal as described for
+// ResourceAttr.Attribute, stopping at the first step whose key isn't known.
+func attributePath(traversal hcl.Traversal) []interface{} {
+	var ret []interface{}
+	for _, step := range traversal {
+		switch step := step.(type) {
+		case hcl.TraverseAttr:
+			ret = append(ret, step.Name)
+		case hcl.TraverseIndex:
+			switch {
+			case step.Key.Type() == cty.String && step.Key.IsKnown():
+				ret = append(ret, step.Key.AsString())
+			case step.Key.Type() == cty.Number && step.Key.IsKnown():
+				i, _ := step.Key.AsBigFloat().Int64()
+				ret = append(ret, int(i))
+			default:
+				return ret
+			}
+		default:
+			return ret
+		}
+	}
+	return ret
+}
@@ -0,0 +1,62 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshall_relevantAttributes(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "aws_instance" "web" {
+}
+
+resource "aws_instance" "db" {
+  count = 2
+}
+
+locals {
+  db_ip = aws_instance.db[0].network_interface[0].private_ip
+}
+
+output "web_ip" {
+  value = aws_instance.web.private_ip
+}
+
+output "db_ip" {
+  value = local.db_ip
+}
+
+output "web_id" {
+  value = aws_instance.web.id
+}
+`,
+	})
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "web_ip", plans.Update, cty.StringVal("10.0.0.1"), cty.StringVal("10.0.0.2")),
+				testOutputChange(t, "db_ip", plans.Create, cty.NilVal, cty.StringVal("10.0.1.1")),
+				testOutputChange(t, "web_id", plans.NoOp, cty.StringVal("i-abc"), cty.StringVal("i-abc")),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ResourceAttr{
+		{Resource: "aws_instance.db[0]", Attribute: []interface{}{"network_interface", 0, "private_ip"}},
+		{Resource: "aws_instance.web", Attribute: []interface{}{"private_ip"}},
+	}
+	if !reflect.DeepEqual(got.RelevantAttributes, want) {
+		t.Errorf("wrong relevant attributes\ngot:  %#v\nwant: %#v", got.RelevantAttributes, want)
+	}
+}
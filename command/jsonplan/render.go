@@ -0,0 +1,445 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/colorstring"
+)
+
+// RenderOptions are options for RenderText.
+type RenderOptions struct {
+	// Color causes the output to include terminal color codes for the
+	// change symbols and headings.
+	Color bool
+}
+
+// RenderText writes a human-readable description of the resource changes in
+// the given plan to the given writer, in the style of the output of
+// "terraform plan", followed by a summary of the number of changes.
+//
+// Since the plan doesn't include the resource schemas, nested blocks are
+// rendered in the same way as object attributes, and attributes that are
+// null both before and after the change are omitted. Sensitive values are
+// shown as "(sensitive value)", and values that won't be known until after
+// apply as "(known after apply)". Changes whose only action is "no-op" are
+// not shown.
+func RenderText(p *Plan, w io.Writer, opts RenderOptions) error {
+	r := &textRenderer{
+		color: &colorstring.Colorize{
+			Colors:  colorstring.DefaultColors,
+			Disable: !opts.Color,
+		},
+	}
+
+	var changes []ResourceChange
+	for _, rc := range p.ResourceChanges {
+		if a := rc.Change.Actions; len(a) == 1 && a[0] == "no-op" {
+			continue
+		}
+		changes = append(changes, rc)
+	}
+
+	if len(changes) == 0 {
+		r.buf.WriteString(r.color.Color("[reset][bold][green]No changes. Infrastructure is up-to-date.[reset]\n"))
+	} else {
+		r.buf.WriteString("Terraform will perform the following actions:\n")
+		for _, rc := range changes {
+			r.buf.WriteString("\n")
+			if err := r.writeResourceChange(rc); err != nil {
+				return fmt.Errorf("error rendering %s: %s", rc.Address, err)
+			}
+		}
+
+		s := p.Summary()
+		r.buf.WriteString(r.color.Color(fmt.Sprintf(
+			"\n[reset][bold]Plan:[reset] %d to add, %d to change, %d to destroy.\n",
+			s.Create+s.Replace, s.Update, s.Delete+s.Replace,
+		)))
+	}
+
+	_, err := w.Write(r.buf.Bytes())
+	return err
+}
+
+type textRenderer struct {
+	buf   bytes.Buffer
+	color *colorstring.Colorize
+}
+
+func (r *textRenderer) writeResourceChange(rc ResourceChange) error {
+	addr := rc.Address
+	if rc.DeposedKey != "" {
+		addr = fmt.Sprintf("%s (deposed object %s)", addr, rc.DeposedKey)
+	}
+
+	c := rc.Change
+	symbol := c.Symbol()
+	switch symbol {
+	case "+":
+		r.buf.WriteString(r.color.Color(fmt.Sprintf("[bold]  # %s[reset] will be created", addr)))
+	case "<=":
+		r.buf.WriteString(r.color.Color(fmt.Sprintf("[bold]  # %s[reset] will be read during apply", addr)))
+	case "~":
+		r.buf.WriteString(r.color.Color(fmt.Sprintf("[bold]  # %s[reset] will be updated in-place", addr)))
+	case "-/+", "+/-":
+		r.buf.WriteString(r.color.Color(fmt.Sprintf("[bold]  # %s[reset] must be [bold][red]replaced", addr)))
+	case "-":
+		r.buf.WriteString(r.color.Color(fmt.Sprintf("[bold]  # %s[reset] will be [bold][red]destroyed", addr)))
+	default:
+		return fmt.Errorf("unsupported actions %q", c.Actions)
+	}
+	r.buf.WriteString(r.color.Color("[reset]\n"))
+
+	r.buf.WriteString(fmt.Sprintf("%3s", "")[len(symbol):])
+	r.writeSymbol(symbol)
+	if rc.Mode == DataResourceMode {
+		r.buf.WriteString(fmt.Sprintf(" data %q %q {\n", rc.Type, rc.Name))
+	} else {
+		r.buf.WriteString(fmt.Sprintf(" resource %q %q {\n", rc.Type, rc.Name))
+	}
+
+	var before, after map[string]interface{}
+	var unknown, beforeSensitive, afterSensitive interface{}
+	for _, v := range []struct {
+		raw  json.RawMessage
+		dest interface{}
+	}{
+		{c.Before, &before},
+		{c.After, &after},
+		{c.AfterUnknown, &unknown},
+		{c.BeforeSensitive, &beforeSensitive},
+		{c.AfterSensitive, &afterSensitive},
+	} {
+		if len(v.raw) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(v.raw))
+		dec.UseNumber()
+		if err := dec.Decode(v.dest); err != nil {
+			return err
+		}
+	}
+
+	r.writeObjectDiff(before, after, unknown, beforeSensitive, afterSensitive, 6)
+	r.buf.WriteString("    }\n")
+	return nil
+}
+
+// writeSymbol writes the given change symbol, as returned by Change.Symbol,
+// in color.
+func (r *textRenderer) writeSymbol(symbol string) {
+	for _, ch := range symbol {
+		switch ch {
+		case '+':
+			r.buf.WriteString(r.color.Color("[green]+[reset]"))
+		case '-':
+			r.buf.WriteString(r.color.Color("[red]-[reset]"))
+		case '~':
+			r.buf.WriteString(r.color.Color("[yellow]~[reset]"))
+		case '<', '=':
+			r.buf.WriteString(r.color.Color("[cyan]" + string(ch) + "[reset]"))
+		default:
+			r.buf.WriteRune(ch)
+		}
+	}
+}
+
+// writeObjectDiff writes a line for each attribute of the given objects, at
+// the given indent, aligning their values. The unknown and sensitive arguments
+// are the corresponding parts of the AfterUnknown, BeforeSensitive and
+// AfterSensitive shapes.
+func (r *textRenderer) writeObjectDiff(before, after map[string]interface{}, unknown, beforeSensitive, afterSensitive interface{}, indent int) {
+	names := make(map[string]bool)
+	for name, v := range before {
+		if v != nil {
+			names[name] = true
+		}
+	}
+	for name, v := range after {
+		if v != nil {
+			names[name] = true
+		}
+	}
+	if u, ok := unknown.(map[string]interface{}); ok {
+		for name, v := range u {
+			if v == true {
+				names[name] = true
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	nameLen := 0
+	for name := range names {
+		sorted = append(sorted, name)
+		if n := len(displayKey(name)); n > nameLen {
+			nameLen = n
+		}
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		key := displayKey(name)
+		bv, av := before[name], after[name]
+		unk := shapeAttr(unknown, name)
+		bs, as := shapeAttr(beforeSensitive, name), shapeAttr(afterSensitive, name)
+		symbol := valueDiffSymbol(bv, av, unk)
+
+		r.buf.WriteString(strings.Repeat(" ", indent))
+		r.writeSymbol(symbol)
+		r.buf.WriteString(" ")
+		r.buf.WriteString(key)
+		r.buf.WriteString(strings.Repeat(" ", nameLen-len(key)))
+		r.buf.WriteString(" = ")
+		r.writeValueDiff(symbol, bv, av, unk, bs, as, indent+2)
+		r.buf.WriteString("\n")
+	}
+}
+
+// writeValueDiff writes the change from before to after, whose symbol is as
+// returned by valueDiffSymbol, continuing the current line.
+func (r *textRenderer) writeValueDiff(symbol string, before, after, unknown, beforeSensitive, afterSensitive interface{}, indent int) {
+	switch {
+	case shapeTrue(beforeSensitive) || shapeTrue(afterSensitive):
+		r.buf.WriteString("(sensitive value)")
+		return
+	case symbol == "+" || symbol == " ":
+		r.writeValue(symbol, after, unknown, afterSensitive, indent)
+		return
+	case symbol == "-":
+		r.writeValue(symbol, before, nil, beforeSensitive, indent)
+		r.buf.WriteString(" -> null")
+		return
+	}
+
+	if !shapeTrue(unknown) {
+		switch b := before.(type) {
+		case map[string]interface{}:
+			if a, ok := after.(map[string]interface{}); ok {
+				r.buf.WriteString("{\n")
+				r.writeObjectDiff(b, a, unknown, beforeSensitive, afterSensitive, indent+2)
+				r.buf.WriteString(strings.Repeat(" ", indent))
+				r.buf.WriteString("}")
+				return
+			}
+		case []interface{}:
+			if a, ok := after.([]interface{}); ok {
+				r.writeListDiff(b, a, unknown, beforeSensitive, afterSensitive, indent)
+				return
+			}
+		}
+	}
+
+	r.writeValue(" ", before, nil, beforeSensitive, indent)
+	r.buf.WriteString(" -> ")
+	r.writeValue(" ", after, unknown, afterSensitive, indent)
+}
+
+// writeListDiff writes the changes between the elements of the given lists,
+// which correspond by index.
+func (r *textRenderer) writeListDiff(before, after []interface{}, unknown, beforeSensitive, afterSensitive interface{}, indent int) {
+	r.buf.WriteString("[\n")
+	n := len(before)
+	if len(after) > n {
+		n = len(after)
+	}
+	for i := 0; i < n; i++ {
+		var bv, av interface{}
+		if i < len(before) {
+			bv = before[i]
+		}
+		if i < len(after) {
+			av = after[i]
+		}
+		unk := shapeElem(unknown, i)
+		bs, as := shapeElem(beforeSensitive, i), shapeElem(afterSensitive, i)
+		symbol := valueDiffSymbol(bv, av, unk)
+		if i >= len(before) {
+			symbol = "+"
+		} else if i >= len(after) {
+			symbol = "-"
+		}
+
+		r.buf.WriteString(strings.Repeat(" ", indent+2))
+		r.writeSymbol(symbol)
+		r.buf.WriteString(" ")
+		if symbol == "-" {
+			r.writeValue(symbol, bv, nil, bs, indent+2)
+		} else {
+			r.writeValueDiff(symbol, bv, av, unk, bs, as, indent+2)
+		}
+		r.buf.WriteString(",\n")
+	}
+	r.buf.WriteString(strings.Repeat(" ", indent))
+	r.buf.WriteString("]")
+}
+
+// writeValue writes the given value, continuing the current line. The lines
+// of a multi-line value are marked with the given symbol.
+func (r *textRenderer) writeValue(symbol string, v, unknown, sensitive interface{}, indent int) {
+	if shapeTrue(unknown) {
+		r.buf.WriteString("(known after apply)")
+		return
+	}
+	if shapeTrue(sensitive) {
+		r.buf.WriteString("(sensitive value)")
+		return
+	}
+
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(tv))
+		for name := range tv {
+			names = append(names, name)
+		}
+		if u, ok := unknown.(map[string]interface{}); ok {
+			for name, uv := range u {
+				if _, exists := tv[name]; !exists && uv == true {
+					names = append(names, name)
+				}
+			}
+		}
+		if len(names) == 0 {
+			r.buf.WriteString("{}")
+			return
+		}
+		sort.Strings(names)
+		nameLen := 0
+		for _, name := range names {
+			if n := len(displayKey(name)); n > nameLen {
+				nameLen = n
+			}
+		}
+
+		r.buf.WriteString("{\n")
+		for _, name := range names {
+			key := displayKey(name)
+			r.buf.WriteString(strings.Repeat(" ", indent+2))
+			r.writeSymbol(symbol)
+			r.buf.WriteString(" ")
+			r.buf.WriteString(key)
+			r.buf.WriteString(strings.Repeat(" ", nameLen-len(key)))
+			r.buf.WriteString(" = ")
+			r.writeValue(symbol, tv[name], shapeAttr(unknown, name), shapeAttr(sensitive, name), indent+4)
+			r.buf.WriteString("\n")
+		}
+		r.buf.WriteString(strings.Repeat(" ", indent))
+		r.buf.WriteString("}")
+
+	case []interface{}:
+		if len(tv) == 0 {
+			r.buf.WriteString("[]")
+			return
+		}
+		r.buf.WriteString("[\n")
+		for i, elem := range tv {
+			r.buf.WriteString(strings.Repeat(" ", indent+2))
+			r.writeSymbol(symbol)
+			r.buf.WriteString(" ")
+			r.writeValue(symbol, elem, shapeElem(unknown, i), shapeElem(sensitive, i), indent+2)
+			r.buf.WriteString(",\n")
+		}
+		r.buf.WriteString(strings.Repeat(" ", indent))
+		r.buf.WriteString("]")
+
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(tv); err != nil {
+			// Can't happen for a decoded json value.
+			r.buf.WriteString("(invalid value)")
+			return
+		}
+		r.buf.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	}
+}
+
+// valueDiffSymbol returns the symbol for the change from before to after of a
+// value that is absent when nil.
+func valueDiffSymbol(before, after, unknown interface{}) string {
+	switch {
+	case before == nil:
+		return "+"
+	case after == nil && !shapeTrue(unknown):
+		return "-"
+	case !containsTrue(unknown) && jsonValuesEqual(before, after):
+		return " "
+	default:
+		return "~"
+	}
+}
+
+func jsonValuesEqual(a, b interface{}) bool {
+	as, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bs, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(as, bs)
+}
+
+// displayKey returns the given attribute name or map key as it should be
+// shown: as-is if it is a valid identifier, and quoted otherwise.
+func displayKey(name string) string {
+	if !validIdentifier(name) {
+		return fmt.Sprintf("%q", name)
+	}
+	return name
+}
+
+func validIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, ch := range name {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch == '_':
+		case i > 0 && (ch >= '0' && ch <= '9' || ch == '-'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// shapeAttr and shapeElem return the part of the given shape, such as an
+// AfterUnknown or AfterSensitive value, that describes the given attribute
+// or element. A shape that is a single boolean applies to every part.
+func shapeAttr(shape interface{}, name string) interface{} {
+	switch s := shape.(type) {
+	case map[string]interface{}:
+		return s[name]
+	case bool:
+		return s
+	default:
+		return nil
+	}
+}
+
+func shapeElem(shape interface{}, i int) interface{} {
+	switch s := shape.(type) {
+	case []interface{}:
+		if i < len(s) {
+			return s[i]
+		}
+		return nil
+	case bool:
+		return s
+	default:
+		return nil
+	}
+}
+
+func shapeTrue(shape interface{}) bool {
+	b, ok := shape.(bool)
+	return ok && b
+}
@@ -0,0 +1,142 @@
+package jsonplan
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestRenderText(t *testing.T) {
+	changes := plans.NewChanges()
+	changes.Resources = []*plans.ResourceInstanceChangeSrc{
+		testResourceChange(t, "created", addrs.NoKey, plans.Create,
+			cty.NullVal(testThingType),
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.UnknownVal(cty.String),
+				"ami": cty.StringVal("ami-123"),
+			}),
+		),
+		testResourceChange(t, "updated", addrs.NoKey, plans.Update,
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.StringVal("i-abc"),
+				"ami": cty.StringVal("ami-123"),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.StringVal("i-abc"),
+				"ami": cty.StringVal("ami-456"),
+			}),
+		),
+		testResourceChange(t, "replaced", addrs.IntKey(0), plans.DeleteThenCreate,
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.StringVal("i-def"),
+				"ami": cty.StringVal("ami-123"),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.UnknownVal(cty.String),
+				"ami": cty.StringVal("ami-789"),
+			}),
+		),
+		testResourceChange(t, "unchanged", addrs.NoKey, plans.NoOp,
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.StringVal("i-ghi"),
+				"ami": cty.StringVal("ami-123"),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.StringVal("i-ghi"),
+				"ami": cty.StringVal("ami-123"),
+			}),
+		),
+	}
+	p, err := MarshallToPlan(nil, &plans.Plan{Changes: changes}, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, color := range []bool{false, true} {
+		name := "plain"
+		if color {
+			name = "color"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := RenderText(p, &buf, RenderOptions{Color: color}); err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := ioutil.ReadFile(filepath.Join("testdata", "render", name+".txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("wrong output\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderText_noChanges(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderText(&Plan{}, &buf, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "No changes. Infrastructure is up-to-date.\n"; got != want {
+		t.Errorf("wrong output %q; want %q", got, want)
+	}
+}
+
+func TestRenderText_nested(t *testing.T) {
+	p := &Plan{
+		ResourceChanges: []ResourceChange{
+			{
+				Address: "test_thing.nested",
+				Mode:    ManagedResourceMode,
+				Type:    "test_thing",
+				Name:    "nested",
+				Change: Change{
+					Actions:         []string{"update"},
+					Before:          []byte(`{"id":"i-abc","tags":{"env":"prod","team":"a"},"ports":[80,443],"password":"old"}`),
+					After:           []byte(`{"id":"i-abc","tags":{"env":"staging","team":"a"},"ports":[80,8443,9000],"password":"new"}`),
+					AfterUnknown:    []byte(`{}`),
+					BeforeSensitive: []byte(`{"password":true}`),
+					AfterSensitive:  []byte(`{"password":true}`),
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := RenderText(p, &buf, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`Terraform will perform the following actions:`,
+		``,
+		`  # test_thing.nested will be updated in-place`,
+		`  ~ resource "test_thing" "nested" {`,
+		`        id       = "i-abc"`,
+		`      ~ password = (sensitive value)`,
+		`      ~ ports    = [`,
+		`            80,`,
+		`          ~ 443 -> 8443,`,
+		`          + 9000,`,
+		`        ]`,
+		`      ~ tags     = {`,
+		`          ~ env  = "prod" -> "staging"`,
+		`            team = "a"`,
+		`        }`,
+		`    }`,
+		``,
+		`Plan: 0 to add, 1 to change, 0 to destroy.`,
+		``,
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Errorf("wrong output\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
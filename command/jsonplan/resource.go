@@ -0,0 +1,207 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ResourceMode distinguishes between managed resources and data resources.
+type ResourceMode string
+
+const (
+	ManagedResourceMode ResourceMode = "managed"
+	DataResourceMode    ResourceMode = "data"
+)
+
+// MarshalJSON implements json.Marshaler, returning an error if the mode is
+// not one of the known modes.
+func (m ResourceMode) MarshalJSON() ([]byte, error) {
+	if !m.valid() {
+		return nil, fmt.Errorf("invalid resource mode %q", string(m))
+	}
+	return json.Marshal(string(m))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, returning an error if the mode
+// is not one of the known modes.
+func (m *ResourceMode) UnmarshalJSON(src []byte) error {
+	var s string
+	if err := json.Unmarshal(src, &s); err != nil {
+		return err
+	}
+	if !ResourceMode(s).valid() {
+		return fmt.Errorf("invalid resource mode %q", s)
+	}
+	*m = ResourceMode(s)
+	return nil
+}
+
+func (m ResourceMode) valid() bool {
+	switch m {
+	case ManagedResourceMode, DataResourceMode:
+		return true
+	default:
+		return false
+	}
+}
+
+// Resource is the representation of a resource in the json plan
+type Resource struct {
+	// Address is the absolute resource address
+	Address string `json:"address,omitempty"`
+
+	// Mode can be "managed" or "data"
+	Mode ResourceMode `json:"mode,omitempty"`
+
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Index is the instance key of the resource: a number for a resource
+	// using `count`, or a string for a resource using `for_each`. Omitted for
+	// a resource not using either.
+	Index json.RawMessage `json:"index,omitempty"`
+
+	// ProviderName allows the property "type" to be interpreted unambiguously
+	// in the unusual situation where a provider offers a resource type whose
+	// name does not start with its own name, such as the "googlebeta" provider
+	// offering "google_compute_instance".
+	ProviderName string `json:"provider_name,omitempty"`
+
+	// ProviderConfigKey identifies the provider configuration that will
+	// manage this resource, such as "aws.us_west" for an aliased
+	// configuration or "module.net:aws" for a configuration within a child
+	// module. It matches the key of the corresponding entry in the
+	// configuration's provider configurations, as given by
+	// ProviderConfig.Key, unless the provider is used without any
+	// configuration block.
+	ProviderConfigKey string `json:"provider_config_key,omitempty"`
+
+	// SchemaVersion indicates which version of the resource type schema the
+	// "values" property conforms to.
+	SchemaVersion uint64 `json:"schema_version,omitempty"`
+
+	// Tainted is set if the current object of the resource instance is
+	// tainted in the prior state, which is usually why it is to be replaced.
+	// It describes the object as it is before the plan is applied.
+	Tainted bool `json:"tainted,omitempty"`
+
+	// DeposedKey identifies the deposed object that this describes, for an
+	// entry in a module's Deposed objects. Omitted otherwise.
+	DeposedKey string `json:"deposed,omitempty"`
+
+	// Values is the JSON representation of the attribute values of the
+	// resource, whose structure depends on the resource type schema. Any
+	// unknown values are omitted or set to null, making them indistinguishable
+	// from absent values.
+	Values json.RawMessage `json:"values,omitempty"`
+
+	// SensitiveValues describes which parts of Values are sensitive, as for
+	// the AfterSensitive of the resource's change, so that callers can
+	// redact them. It is included only in the planned values of a plan.
+	SensitiveValues json.RawMessage `json:"sensitive_values,omitempty"`
+
+	// UnknownReferences maps the name of each top-level attribute whose
+	// planned value won't be known until after apply to the references in
+	// its configuration, such as "aws_subnet.a.id", through which it will
+	// be resolved. Attributes that are computed by the provider alone are
+	// not included. Like SensitiveValues this is included only in the
+	// planned values of a plan, and only if the configuration is available.
+	UnknownReferences map[string][]string `json:"unknown_references,omitempty"`
+}
+
+// ResourceChange is a description of an individual change action that
+// Terraform plans to use to move from the prior state to a new state matching
+// the configuration.
+type ResourceChange struct {
+	// Address is the absolute resource address
+	Address string `json:"address,omitempty"`
+
+	// ModuleAddress is the module portion of the above address. Omitted if the
+	// instance is in the root module.
+	ModuleAddress string `json:"module_address,omitempty"`
+
+	// "managed" or "data"
+	Mode ResourceMode `json:"mode,omitempty"`
+
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Index is the instance key, as for Resource.
+	Index json.RawMessage `json:"index,omitempty"`
+
+	// ProviderName is the type of the provider of the configuration that the
+	// change is planned with, as for Resource. Unlike the planned values, it
+	// is recorded for every change, including deletions.
+	ProviderName string `json:"provider_name,omitempty"`
+
+	// DeposedKey, if set, indicates that this action applies to a "deposed"
+	// object of the given instance rather than to its "current" object, and
+	// identifies which of the instance's deposed objects it applies to.
+	// Omitted for changes to the current object.
+	DeposedKey string `json:"deposed,omitempty"`
+
+	// Change describes the change that will be made to this object
+	Change Change `json:"change,omitempty"`
+
+	// ReplacePaths lists the paths of the attributes whose changes forced
+	// the object to be replaced rather than updated in-place. Each path is an
+	// array of steps, with attribute names and string keys given as strings
+	// and list indices as numbers. Omitted if the change is not a replacement
+	// or if no particular attribute caused it.
+	ReplacePaths json.RawMessage `json:"replace_paths,omitempty"`
+
+	// ActionReason gives a reason for the change action in situations where
+	// it would not otherwise be obvious from the change itself, such as
+	// "replace_because_tainted" for the replacement of a tainted object or
+	// "replace_because_cannot_update" when the changes of the attributes in
+	// ReplacePaths cannot be made in-place. A data source read, which is only
+	// planned when the read must wait until apply, has the reason
+	// "read_because_config_unknown". Omitted otherwise.
+	ActionReason string `json:"action_reason,omitempty"`
+
+	// UnknownCount is the number of values within the change's After value
+	// that won't be known until after apply, counting each true in its
+	// AfterUnknown. A wholly-unknown collection or nested object counts once.
+	// Omitted if all of the values are known.
+	UnknownCount int `json:"unknown_count,omitempty"`
+
+	// TriggeredByModuleInput is true if the change is to an object in a
+	// child module and appears to be caused by a change to one of the
+	// module's input variables, rather than by a direct edit of the
+	// module's configuration. This is a heuristic: it is set if any of the
+	// attributes that change have expressions referring to input variables
+	// that the module call sets. Requires the configuration.
+	TriggeredByModuleInput bool `json:"triggered_by_module_input,omitempty"`
+
+	// CreateBeforeDestroy is true for a replacement of a managed resource
+	// whose configuration sets the create_before_destroy lifecycle
+	// argument, so that the replacement object is created before the
+	// existing object is destroyed. Terraform may also create the
+	// replacement first for other reasons, such as when a dependent resource
+	// sets the argument, and so the order of the change's actions is the
+	// definitive description of what will happen. Requires the
+	// configuration.
+	CreateBeforeDestroy bool `json:"create_before_destroy,omitempty"`
+
+	// ProviderChanged is true if the prior state records the resource as
+	// belonging to a different provider configuration than the one the
+	// change is planned with, such as when the provider argument moves it
+	// to a provider configuration for another region. Requires the prior
+	// state.
+	ProviderChanged bool `json:"provider_changed,omitempty"`
+
+	// InPlace is true if the change updates the existing object in place,
+	// which is exactly when its actions are ["update"]. It is false for
+	// replacements and for every other action.
+	InPlace bool `json:"in_place,omitempty"`
+
+	// ProviderDefaultAttributes lists the top-level attributes of an updated
+	// or replaced object whose values are decided by the provider alone,
+	// being both optional and computed according to the schema and not set
+	// in the configuration. A change to one of these, such as to the
+	// "tags_all" of a provider that merges in default tags, doesn't come from
+	// a change to the configuration. Included only when the plan is marshaled with
+	// MarshallOptions.ProviderDefaults, and only if the configuration is
+	// available.
+	ProviderDefaultAttributes []string `json:"provider_default_attributes,omitempty"`
+}
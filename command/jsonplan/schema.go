@@ -0,0 +1,13 @@
+package jsonplan
+
+//go:generate go run schema_generate.go
+
+// Schema returns a JSON Schema document describing the json format of a plan,
+// as produced by Marshall, at the current FormatVersion.
+//
+// The schema describes only the properties of the current format version and
+// doesn't allow any others, so it may reject documents produced by later
+// releases that Parse would accept.
+func Schema() []byte {
+	return []byte(schemaJSON)
+}
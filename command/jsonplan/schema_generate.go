@@ -0,0 +1,43 @@
+//go:build ignore
+// +build ignore
+
+// Schema generate is a small program that copies the JSON Schema document in
+// schema.json into schema_json.go, so that it will be compiled into the
+// jsonplan package.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+)
+
+const (
+	source = "schema.json"
+	target = "schema_json.go"
+)
+
+func main() {
+	src, err := ioutil.ReadFile(source)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %s", source, err)
+	}
+	if bytes.IndexByte(src, '`') >= 0 {
+		log.Fatalf("%s must not contain backquotes", source)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// This file is automatically generated by schema_generate.go -- Do not edit!\n\n")
+	fmt.Fprintf(&buf, "package jsonplan\n\n")
+	fmt.Fprintf(&buf, "const schemaJSON = `%s`\n", src)
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("Failed to format %s: %s", target, err)
+	}
+	if err := ioutil.WriteFile(target, out, 0644); err != nil {
+		log.Fatalf("Failed to write %s: %s", target, err)
+	}
+}
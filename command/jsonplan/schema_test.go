@@ -0,0 +1,345 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+)
+
+func TestSchema_formatVersion(t *testing.T) {
+	var doc struct {
+		Properties struct {
+			FormatVersion struct {
+				Enum []string `json:"enum"`
+			} `json:"format_version"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(Schema(), &doc); err != nil {
+		t.Fatalf("schema is not valid json: %s", err)
+	}
+	if got, want := doc.Properties.FormatVersion.Enum, []string{FormatVersion}; !reflect.DeepEqual(got, want) {
+		t.Errorf("schema describes format versions %#v; want %#v", got, want)
+	}
+}
+
+func TestSchema_generated(t *testing.T) {
+	want, err := ioutil.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Schema(); string(got) != string(want) {
+		t.Errorf("schema_json.go is out of date; run go generate to update it from schema.json")
+	}
+}
+
+func TestSchema_validate(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+terraform {
+  required_providers {
+    test = "~> 1.0"
+  }
+}
+
+variable "ami" {}
+
+provider "test" {
+  region = "us-east-1"
+}
+
+resource "test_thing" "web" {
+  count = 2
+  ami   = var.ami
+}
+
+resource "test_thing" "db" {
+  ami = "ami-123"
+}
+
+data "test_thing" "lookup" {
+}
+
+module "net" {
+  source = "./net"
+  ami    = test_thing.db.id
+}
+
+variable "zones" {}
+
+module "replicas" {
+  source     = "./replicas"
+  count      = 2
+  depends_on = [module.net]
+}
+
+module "zonal" {
+  source   = "./zonal"
+  for_each = var.zones
+}
+
+output "web_ids" {
+  value = test_thing.web.*.id
+}
+`,
+		"net": `
+variable "ami" {}
+
+resource "test_thing" "subnet" {
+  ami = var.ami
+}
+`,
+		"replicas": ``,
+		"zonal":    ``,
+	})
+	zones, err := plans.NewDynamicValue(cty.MapVal(map[string]cty.Value{
+		"us-east-1a": cty.StringVal("10.0.1.0/24"),
+	}), cty.DynamicPseudoType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+
+	replace := testResourceChange(t, "db", addrs.NoKey, plans.DeleteThenCreate, before, after)
+	replace.RequiredReplace = cty.NewPathSet(
+		cty.Path{}.GetAttr("ami"),
+		cty.Path{}.GetAttr("disk").Index(cty.NumberIntVal(0)),
+	)
+	deposed := testResourceChange(t, "db", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType))
+	deposed.DeposedKey = states.DeposedKey("00000001")
+
+	plan := &plans.Plan{
+		VariableValues: map[string]plans.DynamicValue{
+			"zones": zones,
+		},
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.IntKey(0), plans.Create, cty.NullVal(testThingType), after),
+				testResourceChange(t, "web", addrs.IntKey(1), plans.NoOp, before, before),
+				replace,
+				deposed,
+				testModuleResourceChange(t, addrs.RootModuleInstance.Child("net", addrs.NoKey), "subnet", addrs.NoKey, plans.Update, before, after),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "web_ids", plans.Create, cty.NilVal, cty.UnknownVal(cty.List(cty.String))),
+				testOutputChangeSensitive(t, "secret", plans.Update, cty.StringVal("a"), cty.StringVal("b"), true),
+			},
+		},
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(Schema(), &schema); err != nil {
+		t.Fatalf("schema is not valid json: %s", err)
+	}
+
+	// The plan is rendered both with and without schemas so that the errors
+	// list is covered too.
+	for _, withSchemas := range []bool{true, false} {
+		t.Run(fmt.Sprintf("schemas %t", withSchemas), func(t *testing.T) {
+			schemas := testSchemas()
+			if !withSchemas {
+				schemas = nil
+			}
+			src, err := Marshall(snap, plan, nil, schemas)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The module calls must include the evaluated count and for_each
+			// so that their properties are validated too.
+			for _, prop := range []string{`"count_value"`, `"for_each_keys"`, `"depends_on"`} {
+				if !bytes.Contains(src, []byte(prop)) {
+					t.Errorf("plan has no %s to validate", prop)
+				}
+			}
+
+			var doc interface{}
+			if err := json.Unmarshal(src, &doc); err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range validateJSONSchema(schema, schema, doc, "") {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+func TestSchema_invalid(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(Schema(), &schema); err != nil {
+		t.Fatalf("schema is not valid json: %s", err)
+	}
+
+	tests := map[string]string{
+		"unknown property":   `{"format_version":"0.2","surprise":true}`,
+		"unknown action":     `{"format_version":"0.2","resource_changes":[{"address":"test_thing.a","change":{"actions":["destroy"]}}]}`,
+		"invalid mode":       `{"format_version":"0.2","planned_values":{"root_module":{"resources":[{"mode":"manged"}]}}}`,
+		"invalid index":      `{"format_version":"0.2","planned_values":{"root_module":{"child_modules":[{"resources":[{"index":1.5}]}]}}}`,
+		"missing version":    `{}`,
+		"wrong version":      `{"format_version":"9.9"}`,
+		"missing summary":    `{"format_version":"0.2","errors":[{"address":"test_thing.a"}]}`,
+		"malformed position": `{"format_version":"0.2","configuration":{"root_module":{"resources":[{"expressions":{"ami":{"source":{"start":{},"end":{}}}}}]}}}`,
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			var doc interface{}
+			if err := json.Unmarshal([]byte(src), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if problems := validateJSONSchema(schema, schema, doc, ""); len(problems) == 0 {
+				t.Error("document is valid; want problems")
+			}
+		})
+	}
+}
+
+// validateJSONSchema returns a description of each way in which the given
+// decoded json value does not conform to the given JSON Schema, which must be
+// part of the given root schema document.
+//
+// This supports only the subset of JSON Schema used by the document returned
+// by Schema.
+func validateJSONSchema(root, schema map[string]interface{}, val interface{}, path string) []string {
+	var problems []string
+	problemf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("at %q: ", path)+fmt.Sprintf(format, args...))
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root
+		for _, name := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			def, _ = def[name].(map[string]interface{})
+		}
+		if def == nil {
+			problemf("unresolvable reference %q", ref)
+			return problems
+		}
+		return validateJSONSchema(root, def, val, path)
+	}
+
+	if types, ok := schema["type"]; ok {
+		var allowed []interface{}
+		switch types := types.(type) {
+		case []interface{}:
+			allowed = types
+		default:
+			allowed = []interface{}{types}
+		}
+		match := false
+		for _, typ := range allowed {
+			if jsonSchemaTypeMatches(typ.(string), val) {
+				match = true
+			}
+		}
+		if !match {
+			problemf("value %#v is not of type %v", val, types)
+			return problems
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		match := false
+		for _, v := range enum {
+			if reflect.DeepEqual(v, val) {
+				match = true
+			}
+		}
+		if !match {
+			problemf("value %#v is not one of %v", val, enum)
+		}
+	}
+
+	if min, ok := schema["minimum"].(float64); ok {
+		if n, ok := val.(float64); ok && n < min {
+			problemf("value %v is less than %v", n, min)
+		}
+	}
+
+	if obj, ok := val.(map[string]interface{}); ok {
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := obj[name.(string)]; !ok {
+					problemf("missing required property %q", name)
+				}
+			}
+		}
+
+		props, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := props[name].(map[string]interface{}); ok {
+				problems = append(problems, validateJSONSchema(root, prop, obj[name], path+"/"+name)...)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problemf("unexpected property %q", name)
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateJSONSchema(root, additional, obj[name], path+"/"+name)...)
+			}
+		}
+	}
+
+	if arr, ok := val.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, v := range arr {
+				problems = append(problems, validateJSONSchema(root, items, v, fmt.Sprintf("%s/%d", path, i))...)
+			}
+		}
+	}
+
+	return problems
+}
+
+func jsonSchemaTypeMatches(typ string, val interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := val.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := val.([]interface{})
+		return ok
+	case "string":
+		_, ok := val.(string)
+		return ok
+	case "boolean":
+		_, ok := val.(bool)
+		return ok
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	case "integer":
+		n, ok := val.(float64)
+		return ok && n == math.Trunc(n)
+	case "null":
+		return val == nil
+	default:
+		return false
+	}
+}
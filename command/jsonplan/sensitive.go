@@ -0,0 +1,222 @@
+package jsonplan
+
+import (
+	"encoding/json"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/lang"
+)
+
+// marshalSensitiveValues returns the json encoding of the sensitivity shape
+// of the given value, as described by sensitiveAsBool, additionally marking
+// the given top-level attributes as sensitive.
+func marshalSensitiveValues(val cty.Value, schema *configschema.Block, attrs map[string]bool) (json.RawMessage, error) {
+	sensitive := sensitiveAsBool(val, schema)
+	if len(attrs) != 0 && sensitive.Type().IsObjectType() {
+		vals := sensitive.AsValueMap()
+		if vals == nil {
+			vals = make(map[string]cty.Value)
+		}
+		for name := range attrs {
+			vals[name] = cty.True
+		}
+		sensitive = cty.ObjectVal(vals)
+	}
+	ret, err := ctyjson.Marshal(sensitive, sensitive.Type())
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(ret), nil
+}
+
+// sensitiveAsBool returns a value describing which parts of the given value,
+// which must conform to the given schema, are sensitive.
+//
+// The result mirrors the shape of the given object value, but includes only
+// the attributes that the schema marks as sensitive, each set to true, and
+// those nested blocks that themselves contain sensitive attributes. Where a
+// nested block type produces a sequence of blocks, every block in the
+// sequence is represented, using an empty object for those that contain no
+// sensitive attributes, so that the elements line up with those of the
+// value. An absent value is represented as false.
+func sensitiveAsBool(val cty.Value, schema *configschema.Block) cty.Value {
+	if val == cty.NilVal || val.IsNull() {
+		return cty.False
+	}
+
+	vals := make(map[string]cty.Value)
+	for name, attrS := range schema.Attributes {
+		if attrS.Sensitive {
+			vals[name] = cty.True
+		}
+	}
+
+	if !val.IsKnown() {
+		// We can't see inside an unknown object to find any nested blocks,
+		// but their contents will not be known either.
+		return cty.ObjectVal(vals)
+	}
+
+	for name, blockS := range schema.BlockTypes {
+		blockV := val.GetAttr(name)
+		if blockV.IsNull() || !blockV.IsKnown() {
+			continue
+		}
+
+		switch blockS.Nesting {
+		case configschema.NestingSingle:
+			sensitive := sensitiveAsBool(blockV, &blockS.Block)
+			if hasSensitiveAttrs(sensitive) {
+				vals[name] = sensitive
+			}
+
+		case configschema.NestingList, configschema.NestingSet:
+			var elems []cty.Value
+			found := false
+			for it := blockV.ElementIterator(); it.Next(); {
+				_, elemV := it.Element()
+				sensitive := sensitiveAsBool(elemV, &blockS.Block)
+				found = found || hasSensitiveAttrs(sensitive)
+				elems = append(elems, sensitive)
+			}
+			if found {
+				vals[name] = cty.TupleVal(elems)
+			}
+
+		case configschema.NestingMap:
+			elems := make(map[string]cty.Value)
+			for it := blockV.ElementIterator(); it.Next(); {
+				k, elemV := it.Element()
+				sensitive := sensitiveAsBool(elemV, &blockS.Block)
+				if hasSensitiveAttrs(sensitive) {
+					elems[k.AsString()] = sensitive
+				}
+			}
+			if len(elems) > 0 {
+				vals[name] = cty.ObjectVal(elems)
+			}
+		}
+	}
+
+	return cty.ObjectVal(vals)
+}
+
+// hasSensitiveAttrs returns true if the given result of sensitiveAsBool
+// describes at least one sensitive attribute or nested block.
+func hasSensitiveAttrs(sensitive cty.Value) bool {
+	return sensitive.Type().IsObjectType() && len(sensitive.Type().AttributeTypes()) > 0
+}
+
+// configSensitiveAttrs returns the names of the top-level attributes, as
+// described by the given schema, in the configuration of the given resource
+// instance whose expressions refer to any input variable that is sensitive,
+// as described by sensitiveNamedValues, either directly or through local
+// values. The result is nil if there are none, or if the configuration is not
+// available.
+func configSensitiveAttrs(addr addrs.AbsResourceInstance, config *configs.Config, schema *configschema.Block) map[string]bool {
+	if config == nil {
+		return nil
+	}
+	modCfg := config.DescendentForInstance(addr.Module)
+	if modCfg == nil {
+		return nil
+	}
+	rc := modCfg.Module.ResourceByAddr(addr.Resource.Resource)
+	if rc == nil || rc.Config == nil {
+		return nil
+	}
+
+	sensitive := sensitiveNamedValues(modCfg)
+	if len(sensitive) == 0 {
+		return nil
+	}
+
+	// As in marshalExpressions, we need the raw expressions, so we use the
+	// low-level HCL API with the schema's implied body schema.
+	content, _, _ := rc.Config.PartialContent(hcldec.ImpliedSchema(schema.DecoderSpec()))
+	if content == nil {
+		return nil
+	}
+
+	var ret map[string]bool
+	for name, attr := range content.Attributes {
+		if refersToAny(attr.Expr, sensitive) {
+			if ret == nil {
+				ret = make(map[string]bool)
+			}
+			ret[name] = true
+		}
+	}
+	return ret
+}
+
+// sensitiveNamedValues returns the addresses of the input variables of the
+// given module that are declared as sensitive, or that are set by the module
+// call from an expression referring to a sensitive named value of the parent
+// module, along with those of any local values whose expressions refer to
+// them, directly or indirectly.
+func sensitiveNamedValues(modCfg *configs.Config) map[string]bool {
+	ret := make(map[string]bool)
+	for _, v := range modCfg.Module.Variables {
+		if v.Sensitive {
+			ret[addrs.InputVariable{Name: v.Name}.String()] = true
+		}
+	}
+
+	if modCfg.Parent != nil {
+		call, ok := modCfg.Parent.Module.ModuleCalls[modCfg.Path[len(modCfg.Path)-1]]
+		if ok && call.Config != nil {
+			parent := sensitiveNamedValues(modCfg.Parent)
+			callAttrs, _ := call.Config.JustAttributes()
+			for name, attr := range callAttrs {
+				if _, ok := modCfg.Module.Variables[name]; ok && refersToAny(attr.Expr, parent) {
+					ret[addrs.InputVariable{Name: name}.String()] = true
+				}
+			}
+		}
+	}
+
+	return withDependentLocals(modCfg.Module, ret)
+}
+
+// withDependentLocals adds to the given set of named value addresses those of
+// the local values of the given module whose expressions refer to any of
+// them, directly or indirectly, and returns it.
+func withDependentLocals(mod *configs.Module, names map[string]bool) map[string]bool {
+	if len(names) == 0 {
+		return names
+	}
+
+	// Local values may refer to one another, so we repeat until no further
+	// local values are found.
+	for changed := true; changed; {
+		changed = false
+		for _, l := range mod.Locals {
+			addr := l.Addr().String()
+			if !names[addr] && refersToAny(l.Expr, names) {
+				names[addr] = true
+				changed = true
+			}
+		}
+	}
+	return names
+}
+
+// refersToAny returns true if the given expression refers to any of the
+// named values with the given addresses.
+func refersToAny(expr hcl.Expression, names map[string]bool) bool {
+	refs, _ := lang.ReferencesInExpr(expr)
+	for _, ref := range refs {
+		if names[ref.Subject.String()] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,320 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMarshall_sensitiveValues(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id":       {Type: cty.String, Computed: true},
+			"password": {Type: cty.String, Optional: true, Sensitive: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"disk": {
+				Nesting: configschema.NestingList,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"size": {Type: cty.Number, Optional: true},
+						"key":  {Type: cty.String, Optional: true, Sensitive: true},
+					},
+				},
+			},
+			"network": {
+				Nesting: configschema.NestingSingle,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"name": {Type: cty.String, Optional: true},
+					},
+				},
+			},
+		},
+	}
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_instance": schema,
+				},
+			},
+		},
+	}
+
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":       cty.StringVal("i-abc"),
+		"password": cty.StringVal("hunter2"),
+		"disk": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{
+				"size": cty.NumberIntVal(10),
+				"key":  cty.StringVal("secret"),
+			}),
+		}),
+		"network": cty.ObjectVal(map[string]cty.Value{
+			"name": cty.StringVal("default"),
+		}),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":       cty.StringVal("i-abc"),
+		"password": cty.StringVal("hunter3"),
+		"disk": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{
+				"size": cty.NumberIntVal(10),
+				"key":  cty.StringVal("secret"),
+			}),
+			cty.ObjectVal(map[string]cty.Value{
+				"size": cty.NumberIntVal(20),
+				"key":  cty.NullVal(cty.String),
+			}),
+		}),
+		"network": cty.ObjectVal(map[string]cty.Value{
+			"name": cty.StringVal("default"),
+		}),
+	})
+
+	rc, err := (&plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_instance",
+			Name: "web",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Update,
+			Before: before,
+			After:  after,
+		},
+	}).Encode(schema.ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{rc},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := p.ResourceChanges[0].Change
+
+	assertJSONEqual(t, got.BeforeSensitive, []byte(`{
+		"password": true,
+		"disk": [{"key": true}]
+	}`))
+	assertJSONEqual(t, got.AfterSensitive, []byte(`{
+		"password": true,
+		"disk": [{"key": true}, {"key": true}]
+	}`))
+
+	// Each sensitive block in the mask must line up with a block of the
+	// same index in the value.
+	var afterV struct {
+		Disk []map[string]interface{} `json:"disk"`
+	}
+	var afterSensitiveV struct {
+		Disk []map[string]interface{} `json:"disk"`
+	}
+	if err := json.Unmarshal(got.After, &afterV); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(got.AfterSensitive, &afterSensitiveV); err != nil {
+		t.Fatal(err)
+	}
+	if len(afterV.Disk) != len(afterSensitiveV.Disk) {
+		t.Fatalf("mask has %d disks; value has %d", len(afterSensitiveV.Disk), len(afterV.Disk))
+	}
+	for i, disk := range afterSensitiveV.Disk {
+		for k := range disk {
+			if _, ok := afterV.Disk[i][k]; !ok {
+				t.Errorf("mask has disk[%d].%s, but the value does not", i, k)
+			}
+		}
+	}
+}
+
+func TestMarshall_sensitiveVariables(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "password" {
+  sensitive = true
+}
+
+variable "name" {
+}
+
+locals {
+  dsn    = "admin:${var.password}@db"
+  nested = "${local.dsn}/main"
+}
+
+resource "test_db" "main" {
+  name     = var.name
+  password = var.password
+  dsn      = local.nested
+}
+`,
+	})
+
+	// None of the attributes are sensitive according to the schema, so any
+	// sensitivity must come from the configuration.
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"name":     {Type: cty.String, Optional: true},
+			"password": {Type: cty.String, Optional: true},
+			"dsn":      {Type: cty.String, Optional: true},
+		},
+	}
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_db": schema,
+				},
+			},
+		},
+	}
+
+	after := cty.ObjectVal(map[string]cty.Value{
+		"name":     cty.StringVal("main"),
+		"password": cty.StringVal("hunter2"),
+		"dsn":      cty.StringVal("admin:hunter2@db/main"),
+	})
+	rc, err := (&plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_db",
+			Name: "main",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Create,
+			Before: cty.NullVal(schema.ImpliedType()),
+			After:  after,
+		},
+	}).Encode(schema.ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{rc},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := p.ResourceChanges[0].Change
+
+	assertJSONEqual(t, got.BeforeSensitive, []byte(`false`))
+	assertJSONEqual(t, got.AfterSensitive, []byte(`{
+		"password": true,
+		"dsn": true
+	}`))
+
+	// Without the configuration, nothing is known to be sensitive.
+	p, err = MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertJSONEqual(t, p.ResourceChanges[0].Change.AfterSensitive, []byte(`{}`))
+}
+
+func TestMarshall_sensitiveModuleVariables(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "password" {
+  sensitive = true
+}
+
+locals {
+  password = var.password
+}
+
+module "db" {
+  source   = "./db"
+  name     = "main"
+  password = local.password
+}
+`,
+		"db": `
+variable "name" {
+}
+
+variable "password" {
+}
+
+resource "test_db" "main" {
+  name     = var.name
+  password = var.password
+}
+`,
+	})
+
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"name":     {Type: cty.String, Optional: true},
+			"password": {Type: cty.String, Optional: true},
+		},
+	}
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_db": schema,
+				},
+			},
+		},
+	}
+
+	mod := addrs.RootModuleInstance.Child("db", addrs.NoKey)
+	rc, err := (&plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_db",
+			Name: "main",
+		}.Instance(addrs.NoKey).Absolute(mod),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Create,
+			Before: cty.NullVal(schema.ImpliedType()),
+			After: cty.ObjectVal(map[string]cty.Value{
+				"name":     cty.StringVal("main"),
+				"password": cty.StringVal("hunter2"),
+			}),
+		},
+	}).Encode(schema.ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{rc},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertJSONEqual(t, p.ResourceChanges[0].Change.AfterSensitive, []byte(`{
+		"password": true
+	}`))
+}
@@ -0,0 +1,159 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/hashicorp/terraform/states/statefile"
+)
+
+// ResourceStateDiff describes how the values of a resource instance differ
+// between the prior state and the planned values.
+type ResourceStateDiff struct {
+	Address string
+
+	// Before is the current object of the instance in the prior state and
+	// After is its planned values, as for Resource.Values. Each is nil if the
+	// instance doesn't exist on that side.
+	Before json.RawMessage
+	After  json.RawMessage
+
+	// ChangedAttributes lists the names of the top-level attributes whose
+	// values differ, or whose planned values are unknown, sorted by name.
+	ChangedAttributes []string
+}
+
+// StateDiff returns the differences between the values of each resource
+// instance in the prior state and in the planned values, sorted by address.
+// Unlike the resource changes, this is based only on the values trees, so it
+// also reveals attributes whose values have been recomputed by the provider
+// without any change in configuration.
+//
+// Instances whose values are identical are omitted, as are deposed objects
+// and objects recorded in the prior state in the legacy flatmap format. The
+// result is nil if the prior state is absent or can't be read.
+func (p *Plan) StateDiff() []ResourceStateDiff {
+	before := make(map[string]json.RawMessage)
+	if p.PriorState != nil {
+		f, err := statefile.Read(bytes.NewReader(p.PriorState))
+		if err != nil {
+			return nil
+		}
+		for _, ms := range f.State.Modules {
+			for _, rs := range ms.Resources {
+				for key, is := range rs.Instances {
+					if is.Current == nil || is.Current.AttrsJSON == nil {
+						continue
+					}
+					addr := rs.Addr.Instance(key).Absolute(ms.Addr)
+					before[addr.String()] = json.RawMessage(is.Current.AttrsJSON)
+				}
+			}
+		}
+	}
+
+	after := make(map[string]json.RawMessage)
+	p.WalkResources(func(r *Resource) error {
+		after[r.Address] = r.Values
+		return nil
+	})
+	unknowns := make(map[string]json.RawMessage)
+	walkModule(&p.ProposedUnknown.RootModule, func(_ string, m *Module) error {
+		for _, r := range m.Resources {
+			unknowns[r.Address] = r.Values
+		}
+		return nil
+	})
+
+	keys := make([]string, 0, len(before)+len(after))
+	for addr := range before {
+		keys = append(keys, addr)
+	}
+	for addr := range after {
+		if _, ok := before[addr]; !ok {
+			keys = append(keys, addr)
+		}
+	}
+	sort.Strings(keys)
+
+	var ret []ResourceStateDiff
+	for _, addr := range keys {
+		changed := changedAttributes(before[addr], after[addr], unknowns[addr])
+		if len(changed) == 0 {
+			continue
+		}
+		ret = append(ret, ResourceStateDiff{
+			Address:           addr,
+			Before:            before[addr],
+			After:             after[addr],
+			ChangedAttributes: changed,
+		})
+	}
+	return ret
+}
+
+// changedAttributes returns the sorted names of the top-level attributes that
+// differ between the given object values, or that are marked as unknown in the
+// given unknown values. Either value may be nil, in which case all of the
+// attributes of the other are included.
+func changedAttributes(before, after, unknown json.RawMessage) []string {
+	var b, a, u map[string]interface{}
+	// Values that aren't objects are treated as having no attributes.
+	decodeObject(before, &b)
+	decodeObject(after, &a)
+	decodeObject(unknown, &u)
+
+	var ret []string
+	for name, bv := range b {
+		av, ok := a[name]
+		if !ok || !jsonValuesEqual(bv, av) || containsUnknown(u[name]) {
+			ret = append(ret, name)
+		}
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			ret = append(ret, name)
+		}
+	}
+	for name, uv := range u {
+		_, inB := b[name]
+		_, inA := a[name]
+		if !inB && !inA && containsUnknown(uv) {
+			ret = append(ret, name)
+		}
+	}
+
+	sort.Strings(ret)
+	return ret
+}
+
+func decodeObject(raw json.RawMessage, m *map[string]interface{}) {
+	var v interface{}
+	if err := decodeValue(raw, &v); err != nil {
+		return
+	}
+	*m, _ = v.(map[string]interface{})
+}
+
+// containsUnknown returns true if the given unknown values, as described for
+// ProposedUnknown, mark any part of the value as unknown.
+func containsUnknown(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case []interface{}:
+		for _, ev := range v {
+			if containsUnknown(ev) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, ev := range v {
+			if containsUnknown(ev) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+)
+
+func TestPlanStateDiff(t *testing.T) {
+	prior := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	refreshed := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-def"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	replaced := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-456"),
+	})
+
+	recomputed := testResourceChange(t, "recomputed", addrs.NoKey, plans.NoOp, refreshed, refreshed)
+	unchanged := testResourceChange(t, "unchanged", addrs.NoKey, plans.NoOp, prior, prior)
+	replacedRC := testResourceChange(t, "replaced", addrs.NoKey, plans.DeleteThenCreate, prior, replaced)
+	deleted := testResourceChange(t, "deleted", addrs.NoKey, plans.Delete, prior, cty.NullVal(testThingType))
+	created := testResourceChange(t, "created", addrs.NoKey, plans.Create, cty.NullVal(testThingType), refreshed)
+
+	state := states.BuildState(func(s *states.SyncState) {
+		for _, rc := range []*plans.ResourceInstanceChangeSrc{recomputed, unchanged, replacedRC, deleted} {
+			s.SetResourceInstanceCurrent(
+				rc.Addr,
+				&states.ResourceInstanceObjectSrc{
+					Status:    states.ObjectReady,
+					AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+				},
+				rc.ProviderAddr,
+			)
+		}
+	})
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{recomputed, unchanged, replacedRC, deleted, created},
+		},
+	}
+	p, err := MarshallToPlan(nil, plan, state, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.StateDiff()
+	want := map[string][]string{
+		"test_thing.created":    {"ami", "id"},
+		"test_thing.deleted":    {"ami", "id"},
+		"test_thing.recomputed": {"id"},
+		"test_thing.replaced":   {"ami", "id"},
+	}
+	changed := make(map[string][]string)
+	for _, d := range got {
+		changed[d.Address] = d.ChangedAttributes
+	}
+	if !reflect.DeepEqual(changed, want) {
+		t.Fatalf("wrong changed attributes\ngot:  %#v\nwant: %#v", changed, want)
+	}
+
+	for _, d := range got {
+		switch d.Address {
+		case "test_thing.created":
+			if d.Before != nil {
+				t.Errorf("prior values for %s: %s", d.Address, d.Before)
+			}
+		case "test_thing.deleted":
+			if d.After != nil {
+				t.Errorf("planned values for %s: %s", d.Address, d.After)
+			}
+		case "test_thing.recomputed":
+			assertJSONEqual(t, d.Before, []byte(`{"id":"i-abc","ami":"ami-123"}`))
+			assertJSONEqual(t, d.After, []byte(`{"id":"i-def","ami":"ami-123"}`))
+		}
+	}
+}
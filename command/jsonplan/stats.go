@@ -0,0 +1,82 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Stats is a compact summary of the changes in a plan, as produced by
+// MarshallStats.
+type Stats struct {
+	FormatVersion string `json:"format_version"`
+
+	// Actions counts the resource changes by action, keyed by "create",
+	// "update", "delete", "replace", "read" and "no-op", as for
+	// ChangeSummary. Each action is included even if its count is zero.
+	Actions map[string]int `json:"actions"`
+
+	// Providers counts the resource changes by provider, including those for
+	// data resources, as for Plan.ProviderResourceCounts.
+	Providers map[string]int `json:"providers"`
+
+	// Modules counts the resource changes by the address of the module
+	// instance containing the resource, which is the empty string for the
+	// root module.
+	Modules map[string]int `json:"modules"`
+
+	// UnknownAttributes is the total of the UnknownCount of each resource
+	// change.
+	UnknownAttributes int `json:"unknown_attributes"`
+
+	// OutputChanges counts the output changes other than no-op changes.
+	OutputChanges int `json:"output_changes"`
+}
+
+// MarshallStats returns the json encoding of the Stats of the given plan,
+// which is much smaller than the plan itself. The schemas are required to
+// decode the changes, as for Marshall.
+func MarshallStats(p *plans.Plan, schemas *terraform.Schemas) ([]byte, error) {
+	output, _, err := marshallToPlan(nil, p, nil, schemas, true, MarshallOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := output.stats()
+	if err != nil {
+		return nil, fmt.Errorf("error in stats: %s", err)
+	}
+	return json.Marshal(ret)
+}
+
+func (p *Plan) stats() (Stats, error) {
+	summary := p.Summary()
+	ret := Stats{
+		FormatVersion: FormatVersion,
+		Actions: map[string]int{
+			"create":  summary.Create,
+			"update":  summary.Update,
+			"delete":  summary.Delete,
+			"replace": summary.Replace,
+			"read":    summary.Read,
+			"no-op":   summary.NoOp,
+		},
+		Providers:     p.ProviderResourceCounts(true),
+		Modules:       make(map[string]int),
+		OutputChanges: summary.Outputs,
+	}
+
+	for _, rc := range p.ResourceChanges {
+		addr, diags := addrs.ParseAbsResourceInstanceStr(rc.Address)
+		if diags.HasErrors() {
+			return ret, fmt.Errorf("invalid resource change address %q: %s", rc.Address, diags.Err())
+		}
+		ret.Modules[addr.Module.String()]++
+		ret.UnknownAttributes += rc.UnknownCount
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,94 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshallStats(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.UnknownVal(cty.String),
+	})
+	net := addrs.RootModuleInstance.Child("net", addrs.IntKey(0))
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testResourceChange(t, "db", addrs.NoKey, plans.DeleteThenCreate, before, after),
+				testResourceChange(t, "old", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType)),
+				testModuleResourceChange(t, net, "subnet", addrs.NoKey, plans.NoOp, before, before),
+				testModuleResourceChange(t, net, "route", addrs.NoKey, plans.Update, before, after),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("10.0.0.1")),
+				testOutputChange(t, "name", plans.NoOp, cty.StringVal("web"), cty.StringVal("web")),
+			},
+		},
+	}
+
+	src, err := MarshallStats(plan, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Stats
+	if err := json.Unmarshal(src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stats must agree with a tally of the full plan.
+	full, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{
+		FormatVersion: FormatVersion,
+		Actions:       make(map[string]int),
+		Providers:     make(map[string]int),
+		Modules:       make(map[string]int),
+	}
+	for _, action := range []string{"create", "update", "delete", "replace", "read", "no-op"} {
+		want.Actions[action] = 0
+	}
+	for _, rc := range full.ResourceChanges {
+		action := rc.Change.Actions[0]
+		if rc.Change.IsReplace() {
+			action = "replace"
+		}
+		want.Actions[action]++
+		want.Providers["test"]++
+		addr, err := ParseAddress(rc.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		module := ""
+		if len(addr.Module) != 0 {
+			module = "module.net[0]"
+		}
+		want.Modules[module]++
+		want.UnknownAttributes += rc.UnknownCount
+	}
+	for _, oc := range full.OutputChanges {
+		if oc.Actions[0] != "no-op" {
+			want.OutputChanges++
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong stats\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got.UnknownAttributes != 6 {
+		t.Errorf("wrong unknown attribute count %d; want 6", got.UnknownAttributes)
+	}
+}
@@ -0,0 +1,132 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/terraform/configs/configload"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// MarshallStream is a variant of Marshall that writes the json encoding of a
+// terraform plan to the given writer.
+//
+// The resource changes, which make up the bulk of a large plan, are marshaled
+// and written one at a time rather than all being held in memory at once. The
+// result is equivalent to that of Marshall, though the properties of the
+// top-level object may appear in a different order.
+func MarshallStream(
+	w io.Writer,
+	c *configload.Snapshot,
+	p *plans.Plan,
+	s *states.State,
+	schemas *terraform.Schemas,
+) error {
+	output, config, err := marshallToPlan(c, p, s, schemas, false, MarshallOptions{})
+	if err != nil {
+		return err
+	}
+
+	// Marshaling the resource changes may produce further errors and
+	// lifecycle violations, so these are written after them, at the end of
+	// the document.
+	errs := output.Errors
+	output.Errors = nil
+	var violations []PlanError
+
+	head, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+
+	// The head is always a non-empty object, since it includes at least the
+	// format version, so we can just replace its closing brace with the
+	// remaining properties.
+	head = bytes.TrimSuffix(head, []byte("}"))
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	if p != nil && p.Changes != nil && len(p.Changes.Resources) != 0 {
+		if _, err := io.WriteString(w, `,"resource_changes":[`); err != nil {
+			return err
+		}
+		for i, rc := range sortedResourceChanges(p.Changes.Resources) {
+			r, err := marshalResourceChange(rc, config, s, schemas)
+			if perr, ok := err.(PlanError); ok {
+				errs = append(errs, perr)
+			} else if err != nil {
+				return fmt.Errorf("error in marshalResourceChanges: %s", err)
+			}
+			if i > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+
+			if v, ok := preventDestroyViolation(rc, config); ok {
+				violations = append(violations, v)
+			}
+		}
+		if _, err := io.WriteString(w, "]"); err != nil {
+			return err
+		}
+	}
+
+	if len(violations) != 0 {
+		if _, err := io.WriteString(w, `,"lifecycle_violations":`); err != nil {
+			return err
+		}
+		if err := enc.Encode(violations); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) != 0 {
+		if _, err := io.WriteString(w, `,"errors":`); err != nil {
+			return err
+		}
+		if err := enc.Encode(errs); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "}")
+	return err
+}
+
+// MarshallResourceChangesJSONL writes the resource changes of the given plan
+// to the given writer in the JSON Lines format: each change is written as a
+// standalone json object on a line of its own, in the same form and order as
+// in the "resource_changes" property that Marshall would produce.
+//
+// As for MarshallChanges, the changes don't explain replacements of tainted
+// objects or mark attributes that are sensitive only because of the input
+// variables they refer to. Changes for resources whose schema isn't available
+// are written with only their addresses and actions.
+func MarshallResourceChangesJSONL(p *plans.Plan, w io.Writer, schemas *terraform.Schemas) error {
+	if p == nil || p.Changes == nil {
+		return nil
+	}
+
+	// The encoder terminates each value with a newline.
+	enc := json.NewEncoder(w)
+	for _, rc := range sortedResourceChanges(p.Changes.Resources) {
+		r, err := marshalResourceChange(rc, nil, nil, schemas)
+		if _, ok := err.(PlanError); !ok && err != nil {
+			return fmt.Errorf("error in marshalResourceChange: %s", err)
+		}
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package jsonplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMarshallStream(t *testing.T) {
+	tests := map[string]*plans.Plan{
+		"nil plan":   nil,
+		"no changes": {Changes: plans.NewChanges()},
+		"changes":    testLargePlan(t, 3),
+	}
+
+	for name, plan := range tests {
+		t.Run(name, func(t *testing.T) {
+			want, err := Marshall(nil, plan, nil, testSchemas())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := MarshallStream(&buf, nil, plan, nil, testSchemas()); err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSONEqual(t, withoutMetadata(t, buf.Bytes()), withoutMetadata(t, want))
+		})
+	}
+}
+
+func TestMarshallStream_missingSchema(t *testing.T) {
+	plan := testLargePlan(t, 2)
+
+	want, err := Marshall(nil, plan, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := MarshallStream(&buf, nil, plan, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	assertJSONEqual(t, withoutMetadata(t, buf.Bytes()), withoutMetadata(t, want))
+
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Errors) != 2 {
+		t.Errorf("wrong number of errors %d; want 2", len(got.Errors))
+	}
+}
+
+func TestMarshallStream_preventDestroy(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_thing" "db" {
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+`,
+	})
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "db", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType)),
+			},
+		},
+	}
+
+	want, err := Marshall(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := MarshallStream(&buf, snap, plan, nil, testSchemas()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertJSONEqual(t, withoutMetadata(t, buf.Bytes()), withoutMetadata(t, want))
+
+	got, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.LifecycleViolations) != 1 || got.LifecycleViolations[0].Address != "test_thing.db" {
+		t.Errorf("wrong lifecycle violations %#v; want one for test_thing.db", got.LifecycleViolations)
+	}
+}
+
+func TestMarshallResourceChangesJSONL(t *testing.T) {
+	tests := map[string]struct {
+		plan    *plans.Plan
+		schemas *terraform.Schemas
+	}{
+		"nil plan": {
+			nil,
+			testSchemas(),
+		},
+		"no changes": {
+			&plans.Plan{Changes: plans.NewChanges()},
+			testSchemas(),
+		},
+		"changes": {
+			testLargePlan(t, 3),
+			testSchemas(),
+		},
+		"missing schema": {
+			testLargePlan(t, 2),
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			want, err := MarshallToPlan(nil, test.plan, nil, test.schemas)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := MarshallResourceChangesJSONL(test.plan, &buf, test.schemas); err != nil {
+				t.Fatal(err)
+			}
+
+			var lines [][]byte
+			if buf.Len() != 0 {
+				if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+					t.Fatalf("output doesn't end with a newline:\n%s", buf.Bytes())
+				}
+				lines = bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+			}
+			if len(lines) != len(want.ResourceChanges) {
+				t.Fatalf("wrong number of lines %d; want %d\n%s", len(lines), len(want.ResourceChanges), buf.Bytes())
+			}
+
+			for i, line := range lines {
+				var got ResourceChange
+				if err := json.Unmarshal(line, &got); err != nil {
+					t.Fatalf("line %d is invalid: %s\n%s", i, err, line)
+				}
+				if got.Address != want.ResourceChanges[i].Address {
+					t.Errorf("wrong address on line %d %q; want %q", i, got.Address, want.ResourceChanges[i].Address)
+				}
+				if !reflect.DeepEqual(got.Change.Actions, want.ResourceChanges[i].Change.Actions) {
+					t.Errorf("wrong actions on line %d %#v; want %#v", i, got.Change.Actions, want.ResourceChanges[i].Change.Actions)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMarshall(b *testing.B) {
+	plan := testLargePlan(b, 5000)
+	schemas := testSchemas()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src, err := Marshall(nil, plan, nil, schemas)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ioutil.Discard.Write(src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshallStream(b *testing.B) {
+	plan := testLargePlan(b, 5000)
+	schemas := testSchemas()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := MarshallStream(ioutil.Discard, nil, plan, nil, schemas); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// testLargePlan returns a plan that creates n instances of a counted
+// test_thing resource.
+func testLargePlan(t testing.TB, n int) *plans.Plan {
+	changes := plans.NewChanges()
+	for i := 0; i < n; i++ {
+		changes.Resources = append(changes.Resources, testResourceChange(t, "web", addrs.IntKey(i), plans.Create,
+			cty.NullVal(testThingType),
+			cty.ObjectVal(map[string]cty.Value{
+				"id":  cty.UnknownVal(cty.String),
+				"ami": cty.StringVal("ami-123"),
+			}),
+		))
+	}
+	return &plans.Plan{Changes: changes}
+}
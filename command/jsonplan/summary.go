@@ -0,0 +1,120 @@
+package jsonplan
+
+import (
+	"github.com/hashicorp/terraform/addrs"
+)
+
+// ChangeSummary counts the changes in a plan by action.
+type ChangeSummary struct {
+	// Create, Update, Delete, Replace, Read and NoOp count the resource
+	// changes of each kind. A replacement is counted only once, as Replace,
+	// regardless of whether the new object is created before or after the
+	// old one is deleted.
+	Create  int
+	Update  int
+	Delete  int
+	Replace int
+	Read    int
+	NoOp    int
+
+	// Outputs counts the output changes other than no-op changes.
+	Outputs int
+}
+
+// Summary returns the number of changes of each kind in the plan.
+func (p *Plan) Summary() ChangeSummary {
+	var ret ChangeSummary
+
+	for _, rc := range p.ResourceChanges {
+		c := rc.Change
+		switch {
+		case c.IsReplace():
+			ret.Replace++
+		case len(c.Actions) != 1:
+			// Not a combination we know about, so not counted.
+		case c.Actions[0] == "create":
+			ret.Create++
+		case c.Actions[0] == "update":
+			ret.Update++
+		case c.Actions[0] == "delete":
+			ret.Delete++
+		case c.Actions[0] == "read":
+			ret.Read++
+		case c.Actions[0] == "no-op":
+			ret.NoOp++
+		}
+	}
+
+	for _, c := range p.OutputChanges {
+		if len(c.Actions) == 1 && c.Actions[0] == "no-op" {
+			continue
+		}
+		ret.Outputs++
+	}
+
+	return ret
+}
+
+// Destroys returns the addresses of the resource instances that the plan
+// will delete without replacing, in the order of the resource changes. The
+// deletion of a deposed object is not included, since its instance keeps its
+// current object.
+func (p *Plan) Destroys() []string {
+	var ret []string
+	for _, rc := range p.ResourceChanges {
+		if rc.DeposedKey != "" {
+			continue
+		}
+		if a := rc.Change.Actions; len(a) == 1 && a[0] == "delete" {
+			ret = append(ret, rc.Address)
+		}
+	}
+	return ret
+}
+
+// NoOpResources returns the addresses of the resource instances that the plan
+// leaves unchanged, in the order of the resource changes. Changes for deposed
+// objects are not included, since their addresses are those of the instances
+// that own them.
+func (p *Plan) NoOpResources() []string {
+	var ret []string
+	for _, rc := range p.ResourceChanges {
+		if rc.DeposedKey != "" {
+			continue
+		}
+		if a := rc.Change.Actions; len(a) == 1 && a[0] == "no-op" {
+			ret = append(ret, rc.Address)
+		}
+	}
+	return ret
+}
+
+// ProviderResourceCounts returns the number of resource changes in the plan
+// for each provider, keyed by provider name, regardless of their actions. The
+// changes for data resources are counted only if includeData is set.
+//
+// The provider of each change is the one it is planned with. Documents that
+// predate recording it in the change are read as far as possible: the
+// provider is then taken from the planned values of the resource instance, or
+// for changes that have none, such as deletions, is the default provider for
+// the resource type, which is the part of the type name before its first
+// underscore.
+func (p *Plan) ProviderResourceCounts(includeData bool) map[string]int {
+	ret := make(map[string]int)
+	for _, rc := range p.ResourceChanges {
+		if rc.Mode == DataResourceMode && !includeData {
+			continue
+		}
+
+		provider := rc.ProviderName
+		if provider == "" {
+			if r, ok := p.Resource(rc.Address); ok && r.ProviderName != "" {
+				provider = r.ProviderName
+			} else {
+				provider = addrs.Resource{Type: rc.Type}.DefaultProviderConfig().Type
+			}
+		}
+		ret[provider]++
+	}
+	return ret
+}
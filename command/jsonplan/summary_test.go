@@ -0,0 +1,187 @@
+package jsonplan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestPlanSummary(t *testing.T) {
+	change := func(actions ...string) ResourceChange {
+		return ResourceChange{Change: Change{Actions: actions}}
+	}
+	p := &Plan{
+		ResourceChanges: []ResourceChange{
+			change("create"),
+			change("create"),
+			change("create"),
+			change("update"),
+			change("delete"),
+			change("delete"),
+			change("delete", "create"),
+			change("create", "delete"),
+			change("read"),
+			change("no-op"),
+			change("no-op"),
+		},
+		OutputChanges: map[string]OutputChange{
+			"added":     {Change: Change{Actions: []string{"create"}}},
+			"changed":   {Change: Change{Actions: []string{"update"}}},
+			"unchanged": {Change: Change{Actions: []string{"no-op"}}},
+		},
+	}
+
+	got := p.Summary()
+	want := ChangeSummary{
+		Create:  3,
+		Update:  1,
+		Delete:  2,
+		Replace: 2,
+		Read:    1,
+		NoOp:    2,
+		Outputs: 2,
+	}
+	if got != want {
+		t.Errorf("wrong summary\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestPlanDestroys(t *testing.T) {
+	change := func(addr, deposed string, actions ...string) ResourceChange {
+		return ResourceChange{Address: addr, DeposedKey: deposed, Change: Change{Actions: actions}}
+	}
+	p := &Plan{
+		ResourceChanges: []ResourceChange{
+			change("test_thing.created", "", "create"),
+			change("test_thing.deleted[0]", "", "delete"),
+			change("test_thing.replaced", "", "delete", "create"),
+			change("test_thing.replaced_first", "", "create", "delete"),
+			change("test_thing.replaced_first", "00000001", "delete"),
+			change("module.net.test_thing.deleted", "", "delete"),
+		},
+	}
+
+	want := []string{"test_thing.deleted[0]", "module.net.test_thing.deleted"}
+	if got := p.Destroys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong destroys\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestPlanNoOpResources(t *testing.T) {
+	change := func(addr string, actions ...string) ResourceChange {
+		return ResourceChange{Address: addr, Change: Change{Actions: actions}}
+	}
+	p := &Plan{
+		ResourceChanges: []ResourceChange{
+			change("test_thing.created", "create"),
+			change("test_thing.unchanged[0]", "no-op"),
+			change("test_thing.updated", "update"),
+			change("data.test_thing.read", "read"),
+			change("module.net.test_thing.unchanged", "no-op"),
+			change("test_thing.replaced", "delete", "create"),
+		},
+	}
+
+	want := []string{"test_thing.unchanged[0]", "module.net.test_thing.unchanged"}
+	if got := p.NoOpResources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong no-op resources\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestPlanProviderResourceCounts(t *testing.T) {
+	change := func(mode ResourceMode, typ, name string, actions ...string) ResourceChange {
+		addr := typ + "." + name
+		if mode == DataResourceMode {
+			addr = "data." + addr
+		}
+		return ResourceChange{Address: addr, Mode: mode, Type: typ, Name: name, Change: Change{Actions: actions}}
+	}
+	p := &Plan{
+		PlannedValues: Values{
+			RootModule: Module{
+				Resources: []Resource{
+					{Address: "aws_instance.web", ProviderName: "aws"},
+					{Address: "aws_eip.web", ProviderName: "aws"},
+					{Address: "random_id.suffix", ProviderName: "random"},
+					{Address: "data.aws_ami.ubuntu", ProviderName: "aws"},
+					{Address: "legacy_thing.renamed", ProviderName: "aws"},
+				},
+			},
+		},
+		ResourceChanges: []ResourceChange{
+			change(ManagedResourceMode, "aws_instance", "web", "create"),
+			change(ManagedResourceMode, "aws_eip", "web", "no-op"),
+			change(ManagedResourceMode, "aws_s3_bucket", "old", "delete"),
+			change(ManagedResourceMode, "random_id", "suffix", "delete", "create"),
+			change(ManagedResourceMode, "legacy_thing", "renamed", "update"),
+			change(DataResourceMode, "aws_ami", "ubuntu", "read"),
+		},
+	}
+
+	tests := map[string]struct {
+		includeData bool
+		want        map[string]int
+	}{
+		"managed only": {
+			false,
+			map[string]int{"aws": 4, "random": 1},
+		},
+		"with data sources": {
+			true,
+			map[string]int{"aws": 5, "random": 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := p.ProviderResourceCounts(test.includeData)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wrong counts\ngot:  %#v\nwant: %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanProviderResourceCounts_recordedProvider(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+
+	// The deleted object has no planned values, and its provider is not the
+	// default one for its resource type, so only the change itself says
+	// which provider it belongs to.
+	deleted := testResourceChange(t, "old", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType))
+	deleted.ProviderAddr = addrs.ProviderConfig{Type: "other"}.Absolute(addrs.RootModuleInstance)
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Update, before, before),
+				deleted,
+			},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["other"] = schemas.Providers["test"]
+
+	p, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"test": 1, "other": 1}
+	if got := p.ProviderResourceCounts(false); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong counts\ngot:  %#v\nwant: %#v", got, want)
+	}
+	stats, err := p.stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats.Providers, want) {
+		t.Errorf("wrong provider stats\ngot:  %#v\nwant: %#v", stats.Providers, want)
+	}
+}
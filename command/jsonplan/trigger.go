@@ -0,0 +1,69 @@
+package jsonplan
+
+import (
+	"github.com/hashicorp/hcl2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configschema"
+)
+
+// triggeredByModuleInput returns true if the given change to a resource
+// instance in a child module appears to be caused by a change to the
+// module's inputs: that is, if any of the top-level attributes whose values
+// differ between before and after has an expression in the configuration
+// that refers to an input variable set by the module call, either directly
+// or through local values.
+//
+// This is only a heuristic, since the plan doesn't record the previous values
+// of the module's inputs. Only updates and replacements of existing objects
+// are considered, and the result is false if the configuration is not
+// available.
+func triggeredByModuleInput(addr addrs.AbsResourceInstance, before, after cty.Value, config *configs.Config, schema *configschema.Block) bool {
+	if addr.Module.IsRoot() || config == nil {
+		return false
+	}
+	if before == cty.NilVal || before.IsNull() || after == cty.NilVal || after.IsNull() {
+		return false
+	}
+
+	modCfg := config.DescendentForInstance(addr.Module)
+	if modCfg == nil || modCfg.Parent == nil {
+		return false
+	}
+	rc := modCfg.Module.ResourceByAddr(addr.Resource.Resource)
+	if rc == nil || rc.Config == nil {
+		return false
+	}
+	call, ok := modCfg.Parent.Module.ModuleCalls[modCfg.Path[len(modCfg.Path)-1]]
+	if !ok || call.Config == nil {
+		return false
+	}
+
+	inputs := make(map[string]bool)
+	callAttrs, _ := call.Config.JustAttributes()
+	for name := range callAttrs {
+		if _, ok := modCfg.Module.Variables[name]; ok {
+			inputs[addrs.InputVariable{Name: name}.String()] = true
+		}
+	}
+	inputs = withDependentLocals(modCfg.Module, inputs)
+	if len(inputs) == 0 {
+		return false
+	}
+
+	content, _, _ := rc.Config.PartialContent(hcldec.ImpliedSchema(schema.DecoderSpec()))
+	if content == nil {
+		return false
+	}
+	for name, attr := range content.Attributes {
+		if before.GetAttr(name).RawEquals(after.GetAttr(name)) {
+			continue
+		}
+		if refersToAny(attr.Expr, inputs) {
+			return true
+		}
+	}
+	return false
+}
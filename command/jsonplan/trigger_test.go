@@ -0,0 +1,96 @@
+package jsonplan
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshall_triggeredByModuleInput(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+variable "ami" {
+}
+
+resource "test_thing" "root" {
+  ami = var.ami
+}
+
+module "net" {
+  source = "./net"
+  ami    = var.ami
+}
+`,
+		"net": `
+variable "ami" {
+}
+
+variable "unset" {
+  default = "ami-default"
+}
+
+locals {
+  image = var.ami
+}
+
+resource "test_thing" "input" {
+  ami = local.image
+}
+
+resource "test_thing" "edited" {
+  ami = "ami-edited"
+}
+
+resource "test_thing" "default" {
+  ami = var.unset
+}
+
+resource "test_thing" "computed" {
+  ami = var.ami
+}
+`,
+	})
+
+	thing := func(id, ami string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":  cty.StringVal(id),
+			"ami": cty.StringVal(ami),
+		})
+	}
+	net := addrs.RootModuleInstance.Child("net", addrs.NoKey)
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "root", addrs.NoKey, plans.Update, thing("i-a", "ami-1"), thing("i-a", "ami-2")),
+				testModuleResourceChange(t, net, "input", addrs.NoKey, plans.Update, thing("i-b", "ami-1"), thing("i-b", "ami-2")),
+				testModuleResourceChange(t, net, "edited", addrs.NoKey, plans.Update, thing("i-c", "ami-1"), thing("i-c", "ami-edited")),
+				testModuleResourceChange(t, net, "default", addrs.NoKey, plans.Update, thing("i-d", "ami-1"), thing("i-d", "ami-default")),
+				testModuleResourceChange(t, net, "computed", addrs.NoKey, plans.Update, thing("i-e", "ami-2"), cty.ObjectVal(map[string]cty.Value{
+					"id":  cty.UnknownVal(cty.String),
+					"ami": cty.StringVal("ami-2"),
+				})),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"test_thing.root":                false,
+		"module.net.test_thing.input":    true,
+		"module.net.test_thing.edited":   false,
+		"module.net.test_thing.default":  false,
+		"module.net.test_thing.computed": false,
+	}
+	for _, rc := range got.ResourceChanges {
+		if rc.TriggeredByModuleInput != want[rc.Address] {
+			t.Errorf("wrong TriggeredByModuleInput for %s: got %t, want %t", rc.Address, rc.TriggeredByModuleInput, want[rc.Address])
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package jsonplan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// TruncatedValue is the object that replaces a value larger than the limit
+// given in MarshallOptions.MaxValueBytes. Bytes and SHA256 are the length
+// and hex-encoded SHA-256 hash of the original value: the UTF-8 encoding of
+// a string, or the json encoding of any other value.
+type TruncatedValue struct {
+	Truncated bool   `json:"truncated"`
+	Bytes     int    `json:"bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+// truncateChangeValues truncates the primitive values larger than max bytes
+// within the before and after values of the plan's resource and output
+// changes.
+func (p *Plan) truncateChangeValues(max int) error {
+	for i := range p.ResourceChanges {
+		if err := truncateChange(&p.ResourceChanges[i].Change, max); err != nil {
+			return err
+		}
+	}
+	for name, oc := range p.OutputChanges {
+		if err := truncateChange(&oc.Change, max); err != nil {
+			return err
+		}
+		p.OutputChanges[name] = oc
+	}
+	return nil
+}
+
+func truncateChange(c *Change, max int) error {
+	var err error
+	c.Before, err = truncateValue(c.Before, max)
+	if err != nil {
+		return err
+	}
+	c.After, err = truncateValue(c.After, max)
+	if err != nil {
+		return err
+	}
+	c.BeforeDiff, err = truncateValue(c.BeforeDiff, max)
+	if err != nil {
+		return err
+	}
+	c.AfterDiff, err = truncateValue(c.AfterDiff, max)
+	return err
+}
+
+// truncateValue returns the given json value with each primitive value larger
+// than max bytes replaced by a TruncatedValue. The value is returned as it was
+// if nothing needs truncating.
+func truncateValue(raw json.RawMessage, max int) (json.RawMessage, error) {
+	// No primitive value within the value can be larger than the value
+	// itself.
+	if len(raw) <= max {
+		return raw, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	v, truncated, err := truncate(v, max)
+	if err != nil || !truncated {
+		return raw, err
+	}
+	return json.Marshal(v)
+}
+
+func truncate(v interface{}, max int) (interface{}, bool, error) {
+	switch tv := v.(type) {
+	case []interface{}:
+		changed := false
+		for i, elem := range tv {
+			var truncated bool
+			var err error
+			tv[i], truncated, err = truncate(elem, max)
+			if err != nil {
+				return nil, false, err
+			}
+			changed = changed || truncated
+		}
+		return tv, changed, nil
+	case map[string]interface{}:
+		changed := false
+		for name, attr := range tv {
+			var truncated bool
+			var err error
+			tv[name], truncated, err = truncate(attr, max)
+			if err != nil {
+				return nil, false, err
+			}
+			changed = changed || truncated
+		}
+		return tv, changed, nil
+	case string:
+		if len(tv) <= max {
+			return tv, false, nil
+		}
+		return truncatedValue([]byte(tv)), true, nil
+	case nil:
+		return nil, false, nil
+	default:
+		src, err := json.Marshal(tv)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(src) <= max {
+			return tv, false, nil
+		}
+		return truncatedValue(src), true, nil
+	}
+}
+
+func truncatedValue(src []byte) TruncatedValue {
+	sum := sha256.Sum256(src)
+	return TruncatedValue{
+		Truncated: true,
+		Bytes:     len(src),
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+}
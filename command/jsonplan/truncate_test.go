@@ -0,0 +1,103 @@
+package jsonplan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestMarshallWithOptions_maxValueBytes(t *testing.T) {
+	huge := strings.Repeat("#!/bin/sh\n", 100)
+	sum := sha256.Sum256([]byte(huge))
+	hash := hex.EncodeToString(sum[:])
+
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal(huge),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Update, before, after),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "script", plans.Create, cty.NilVal, cty.StringVal(huge)),
+				testOutputChange(t, "ip", plans.Create, cty.NilVal, cty.StringVal("10.0.0.1")),
+			},
+		},
+	}
+
+	src, err := MarshallWithOptions(nil, plan, nil, testSchemas(), MarshallOptions{MaxValueBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marker := `{"truncated":true,"bytes":1000,"sha256":"` + hash + `"}`
+	change := got.ResourceChanges[0].Change
+	assertJSONEqual(t, change.Before, []byte(`{"id":"i-abc","ami":"ami-123"}`))
+	assertJSONEqual(t, change.After, []byte(`{"id":"i-abc","ami":`+marker+`}`))
+	assertJSONEqual(t, got.OutputChanges["script"].After, []byte(marker))
+	assertJSONEqual(t, got.OutputChanges["ip"].After, []byte(`"10.0.0.1"`))
+
+	// The planned values are left complete.
+	r, ok := got.Resource("test_thing.web")
+	if !ok {
+		t.Fatal("no planned values for test_thing.web")
+	}
+	if v, _ := lookupValuePath(r.Values, []string{"ami"}); v != huge {
+		t.Errorf("planned value was truncated to %#v", v)
+	}
+}
+
+func TestTruncateValue(t *testing.T) {
+	tests := map[string]struct {
+		src  string
+		want string
+	}{
+		"small": {
+			`{"a":"short","b":[1,2]}`,
+			`{"a":"short","b":[1,2]}`,
+		},
+		"large but small leaves": {
+			`{"a":"0123456789","b":"0123456789","c":[12345678901234567890]}`,
+			`{"a":"0123456789","b":"0123456789","c":[12345678901234567890]}`,
+		},
+		"nested string": {
+			`{"a":[{"b":"0123456789abcdefghijklmn"}],"c":true}`,
+			`{"a":[{"b":{"truncated":true,"bytes":24,"sha256":"` + testSHA256("0123456789abcdefghijklmn") + `"}}],"c":true}`,
+		},
+		"number": {
+			`[123456789012345678901234567890]`,
+			`[{"truncated":true,"bytes":30,"sha256":"` + testSHA256("123456789012345678901234567890") + `"}]`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := truncateValue([]byte(test.src), 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, got, []byte(test.want))
+		})
+	}
+}
+
+func testSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
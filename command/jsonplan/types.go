@@ -0,0 +1,99 @@
+package jsonplan
+
+import (
+	"encoding/json"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// annotateValueTypes sets the BeforeType and AfterType of each of the plan's
+// resource changes and output changes from the corresponding changes in the
+// given plan, as described for MarshallOptions.IncludeTypes. Resource changes
+// whose schemas are not available are left without types.
+func (p *Plan) annotateValueTypes(changes *plans.Changes, schemas *terraform.Schemas) error {
+	type key struct {
+		addr    string
+		deposed states.DeposedKey
+	}
+	index := make(map[key]*Change, len(p.ResourceChanges))
+	for i, rc := range p.ResourceChanges {
+		index[key{rc.Address, states.DeposedKey(rc.DeposedKey)}] = &p.ResourceChanges[i].Change
+	}
+
+	for _, rc := range changes.Resources {
+		c, ok := index[key{rc.Addr.String(), rc.DeposedKey}]
+		if !ok {
+			continue
+		}
+		schema := schemaForResource(schemas, rc.ProviderAddr.ProviderConfig.Type, rc.Addr.Resource.Resource)
+		if schema == nil {
+			continue
+		}
+		changeV, err := rc.Decode(schema.ImpliedType())
+		if err != nil {
+			return err
+		}
+		if err := c.setValueTypes(changeV.Before, changeV.After); err != nil {
+			return err
+		}
+	}
+
+	for _, oc := range changes.Outputs {
+		if !oc.Addr.Module.IsRoot() {
+			continue
+		}
+		name := oc.Addr.OutputValue.Name
+		o, ok := p.OutputChanges[name]
+		if !ok {
+			continue
+		}
+		changeV, err := oc.Decode()
+		if err != nil {
+			return err
+		}
+		if err := o.setValueTypes(changeV.Before, changeV.After); err != nil {
+			return err
+		}
+		p.OutputChanges[name] = o
+	}
+
+	return nil
+}
+
+func (c *Change) setValueTypes(before, after cty.Value) error {
+	var err error
+	c.BeforeType, err = marshalValueType(before)
+	if err != nil {
+		return err
+	}
+	c.AfterType, err = marshalValueType(after)
+	return err
+}
+
+// marshalValueType returns the type of the given value, as described for
+// Change.BeforeType, or nil if the value is absent or null.
+func marshalValueType(val cty.Value) (json.RawMessage, error) {
+	if val == cty.NilVal || val.IsNull() {
+		return nil, nil
+	}
+
+	ty := val.Type()
+	if !ty.IsObjectType() {
+		return ctyjson.MarshalType(ty)
+	}
+
+	ret := make(map[string]json.RawMessage, len(ty.AttributeTypes()))
+	for name, aty := range ty.AttributeTypes() {
+		raw, err := ctyjson.MarshalType(aty)
+		if err != nil {
+			return nil, err
+		}
+		ret[name] = raw
+	}
+	return json.Marshal(ret)
+}
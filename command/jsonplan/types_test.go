@@ -0,0 +1,92 @@
+package jsonplan
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMarshallWithOptions_includeTypes(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"size":  {Type: cty.Number, Optional: true},
+			"zones": {Type: cty.List(cty.String), Optional: true},
+		},
+	}
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"test": {
+				ResourceTypes: map[string]*configschema.Block{
+					"test_disk": schema,
+				},
+			},
+		},
+	}
+
+	after := cty.ObjectVal(map[string]cty.Value{
+		"size":  cty.NumberIntVal(10),
+		"zones": cty.ListVal([]cty.Value{cty.StringVal("a")}),
+	})
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_disk",
+			Name: "data",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Create,
+			Before: cty.NullVal(schema.ImpliedType()),
+			After:  after,
+		},
+	}
+	rcs, err := rc.Encode(schema.ImpliedType())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{rcs},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "count", plans.Update, cty.NumberIntVal(1), cty.NumberIntVal(2)),
+			},
+		},
+	}
+
+	for name, include := range map[string]bool{"included": true, "omitted": false} {
+		t.Run(name, func(t *testing.T) {
+			src, err := MarshallWithOptions(nil, plan, nil, schemas, MarshallOptions{IncludeTypes: include})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := got.ResourceChanges[0].Change
+			oc := got.OutputChanges["count"]
+			if !include {
+				if c.BeforeType != nil || c.AfterType != nil || oc.BeforeType != nil || oc.AfterType != nil {
+					t.Errorf("unexpected types in %s", src)
+				}
+				return
+			}
+
+			if c.BeforeType != nil {
+				t.Errorf("unexpected before type %s", c.BeforeType)
+			}
+			assertJSONEqual(t, c.AfterType, []byte(`{"size":"number","zones":["list","string"]}`))
+			assertJSONEqual(t, oc.BeforeType, []byte(`"number"`))
+			assertJSONEqual(t, oc.AfterType, []byte(`"number"`))
+		})
+	}
+}
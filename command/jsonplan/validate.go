@@ -0,0 +1,87 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Validate checks that the resource changes in the plan are consistent with
+// the configuration, returning an error for each inconsistency found.
+//
+// Every change in the root module must correspond to a resource in the
+// configuration, unless it deletes the object, as it does when a resource is
+// removed from the configuration. The instance key of each such change must
+// also be of the kind produced by the resource's configuration: a number for
+// a resource using count, a string for one using for_each, and no key
+// otherwise. The changes in child modules are not checked, since the plan
+// describes the configuration of the root module only.
+//
+// Nothing is checked if the plan does not include the configuration.
+func (p *Plan) Validate() []error {
+	root := p.Config.RootModule
+	if len(root.Resources) == 0 && len(root.ModuleCalls) == 0 {
+		return nil
+	}
+
+	resources := make(map[string]ConfigResource, len(root.Resources))
+	for _, r := range root.Resources {
+		resources[r.Address] = r
+	}
+
+	var errs []error
+	for _, rc := range p.ResourceChanges {
+		if rc.ModuleAddress != "" {
+			continue
+		}
+		if a := rc.Change.Actions; len(a) == 1 && a[0] == "delete" {
+			continue
+		}
+
+		addr := rc.Type + "." + rc.Name
+		if rc.Mode == DataResourceMode {
+			addr = "data." + addr
+		}
+		r, ok := resources[addr]
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"%s: resource change has no corresponding resource %s in the configuration",
+				rc.Address, addr,
+			))
+			continue
+		}
+
+		var key interface{}
+		if len(rc.Index) != 0 {
+			if err := json.Unmarshal(rc.Index, &key); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid instance key: %s", rc.Address, err))
+				continue
+			}
+		}
+		switch key.(type) {
+		case float64:
+			if r.CountExpression == nil {
+				errs = append(errs, fmt.Errorf(
+					"%s: instance has a numeric key, but %s does not use count",
+					rc.Address, addr,
+				))
+			}
+		case string:
+			if r.ForEachExpression == nil {
+				errs = append(errs, fmt.Errorf(
+					"%s: instance has a string key, but %s does not use for_each",
+					rc.Address, addr,
+				))
+			}
+		case nil:
+			if r.CountExpression != nil || r.ForEachExpression != nil {
+				errs = append(errs, fmt.Errorf(
+					"%s: instance has no key, but %s uses count or for_each",
+					rc.Address, addr,
+				))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: instance key must be a number or a string", rc.Address))
+		}
+	}
+	return errs
+}
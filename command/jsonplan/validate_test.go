@@ -0,0 +1,124 @@
+package jsonplan
+
+import (
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/plans"
+)
+
+func TestPlanValidate(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+resource "test_thing" "single" {
+}
+
+resource "test_thing" "counted" {
+  count = 2
+}
+
+resource "test_thing" "each" {
+  for_each = {}
+}
+
+module "net" {
+  source = "./net"
+}
+`,
+		"net": `
+resource "test_thing" "subnet" {
+}
+`,
+	})
+
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	create := func(name string, key addrs.InstanceKey) *plans.ResourceInstanceChangeSrc {
+		return testResourceChange(t, name, key, plans.Create, cty.NullVal(testThingType), after)
+	}
+
+	tests := map[string]struct {
+		changes []*plans.ResourceInstanceChangeSrc
+		want    []string
+	}{
+		"consistent": {
+			[]*plans.ResourceInstanceChangeSrc{
+				create("single", addrs.NoKey),
+				create("counted", addrs.IntKey(1)),
+				create("each", addrs.StringKey("a")),
+				testModuleResourceChange(t, addrs.RootModuleInstance.Child("net", addrs.NoKey), "subnet", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+			nil,
+		},
+		"orphaned objects are deleted": {
+			[]*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "removed", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType)),
+				testResourceChange(t, "single", addrs.IntKey(0), plans.Delete, before, cty.NullVal(testThingType)),
+			},
+			nil,
+		},
+		"inconsistent": {
+			[]*plans.ResourceInstanceChangeSrc{
+				create("dangling", addrs.NoKey),
+				testResourceChange(t, "removed", addrs.NoKey, plans.Update, before, after),
+				create("single", addrs.IntKey(0)),
+				create("counted", addrs.NoKey),
+				create("counted", addrs.StringKey("a")),
+				create("each", addrs.IntKey(0)),
+			},
+			[]string{
+				"test_thing.counted: instance has no key, but test_thing.counted uses count or for_each",
+				`test_thing.counted["a"]: instance has a string key, but test_thing.counted does not use for_each`,
+				"test_thing.dangling: resource change has no corresponding resource test_thing.dangling in the configuration",
+				"test_thing.each[0]: instance has a numeric key, but test_thing.each does not use count",
+				"test_thing.removed: resource change has no corresponding resource test_thing.removed in the configuration",
+				"test_thing.single[0]: instance has a numeric key, but test_thing.single does not use count",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := &plans.Plan{
+				Changes: &plans.Changes{Resources: test.changes},
+			}
+			p, err := MarshallToPlan(snap, plan, nil, testSchemas())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errs := p.Validate()
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("wrong errors\ngot:  %#v\nwant: %#v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("wrong error %d\ngot:  %s\nwant: %s", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPlanValidate_noConfig(t *testing.T) {
+	p := &Plan{
+		ResourceChanges: []ResourceChange{
+			{Address: "test_thing.a", Mode: ManagedResourceMode, Type: "test_thing", Name: "a", Change: Change{Actions: []string{"create"}}},
+		},
+	}
+	if errs := p.Validate(); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
@@ -0,0 +1,385 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Values is the common representation of resolved values for both the prior
+// state (which is always complete) and the planned new state.
+type Values struct {
+	Outputs    map[string]Output `json:"outputs,omitempty"`
+	RootModule Module            `json:"root_module,omitempty"`
+}
+
+// marshalPlannedValues populates the planned values of the plan, describing
+// the expected state of the world once the given changes have been applied,
+// and the proposed unknown values, describing which of those values won't be
+// known until after apply. The given prior state, which may be nil, is used
+// to report which resource instances are currently tainted and which deposed
+// objects will remain. The given configuration, which may also be nil, is
+// used to find the attributes that are sensitive because of the input
+// variables they refer to, and the references through which unknown
+// attributes will be resolved.
+//
+// Both trees contain the same modules and resources, so that callers can
+// correlate them by address.
+func (p *Plan) marshalPlannedValues(changes *plans.Changes, config *configs.Config, s *states.State, schemas *terraform.Schemas) error {
+	var err error
+
+	p.PlannedValues.Outputs, err = marshalPlannedOutputs(changes, false)
+	if err != nil {
+		return err
+	}
+	p.PlannedValues.RootModule, err = marshalPlannedModules(changes, config, s, schemas, false)
+	if err != nil {
+		return err
+	}
+
+	p.ProposedUnknown.Outputs, err = marshalPlannedOutputs(changes, true)
+	if err != nil {
+		return err
+	}
+	p.ProposedUnknown.RootModule, err = marshalPlannedModules(changes, config, s, schemas, true)
+	return err
+}
+
+// marshalPlannedOutputs returns the planned values of the root module
+// outputs. Outputs that will be removed, or whose values are not yet known,
+// are omitted.
+//
+// If unknowns is set then the result instead includes only the outputs whose
+// values are not yet known, with values as described for unknownAsBool.
+func marshalPlannedOutputs(changes *plans.Changes, unknowns bool) (map[string]Output, error) {
+	if len(changes.Outputs) == 0 {
+		return nil, nil
+	}
+
+	ret := make(map[string]Output)
+	for _, oc := range changes.Outputs {
+		if !oc.Addr.Module.IsRoot() || oc.Action == plans.Delete {
+			continue
+		}
+
+		changeV, err := oc.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if changeV.After.IsWhollyKnown() == unknowns {
+			continue
+		}
+
+		var value json.RawMessage
+		switch {
+		case unknowns:
+			value, err = marshalUnknownValues(changeV.After)
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling unknown values for %s: %s", oc.Addr, err)
+			}
+		case !oc.Sensitive:
+			value, err = marshalValue(changeV.After)
+			if err != nil {
+				return nil, fmt.Errorf("error marshaling planned value for %s: %s", oc.Addr, err)
+			}
+		}
+
+		ret[oc.Addr.OutputValue.Name] = Output{
+			Sensitive: oc.Sensitive,
+			Value:     value,
+		}
+	}
+
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return ret, nil
+}
+
+// marshalPlannedModules returns the module tree describing the resource
+// instances that are expected to exist after the given changes are applied,
+// along with their planned attribute values. Unknown values are omitted.
+//
+// If unknowns is set then the values of each resource instead describe which
+// of its attributes are not yet known, as for unknownAsBool.
+func marshalPlannedModules(changes *plans.Changes, config *configs.Config, s *states.State, schemas *terraform.Schemas, unknowns bool) (Module, error) {
+	var ret Module
+
+	// resources maps each module address to the resources planned within it,
+	// while modules maps each module address to the addresses of its direct
+	// children, so that we can build the tree recursively below.
+	resources := make(map[string][]Resource)
+	modules := make(map[string][]addrs.ModuleInstance)
+	seen := make(map[string]bool)
+
+	// Each instance of a module called with count or for_each is a separate
+	// module instance with its own instance key, and so gets its own entry
+	// in the tree. addModule makes sure that each of the module's ancestors
+	// knows about its child, so that the module is reachable from the root.
+	addModule := func(mod addrs.ModuleInstance) {
+		for ; !mod.IsRoot(); mod = mod.Parent() {
+			if seen[mod.String()] {
+				break
+			}
+			seen[mod.String()] = true
+			parent := mod.Parent().String()
+			modules[parent] = append(modules[parent], mod)
+		}
+	}
+
+	for _, rc := range sortedResourceChanges(changes.Resources) {
+		// Deposed objects and the subjects of delete actions will not exist
+		// once the plan is applied.
+		if rc.Action == plans.Delete || rc.DeposedKey != states.NotDeposed {
+			continue
+		}
+
+		addModule(rc.Addr.Module)
+
+		// Resources whose schemas are not available are left out, since
+		// their values can't be decoded. They are reported in the plan's
+		// errors along with their changes. Their modules are still
+		// included, since those will exist after apply.
+		addr := rc.Addr.Resource.Resource
+		if schemaForResource(schemas, rc.ProviderAddr.ProviderConfig.Type, addr) == nil {
+			continue
+		}
+
+		r, err := marshalPlannedResource(rc, config, s, schemas, unknowns)
+		if err != nil {
+			return ret, err
+		}
+
+		key := rc.Addr.Module.String()
+		resources[key] = append(resources[key], r)
+	}
+
+	deposed, err := marshalRemainingDeposed(changes, s, schemas, unknowns)
+	if err != nil {
+		return ret, err
+	}
+	if s != nil {
+		for _, ms := range s.Modules {
+			if len(deposed[ms.Addr.String()]) != 0 {
+				addModule(ms.Addr)
+			}
+		}
+	}
+
+	return buildPlannedModule(addrs.RootModuleInstance, resources, deposed, modules), nil
+}
+
+// marshalRemainingDeposed returns the deposed objects in the given prior state
+// that the given changes don't destroy, and so will still exist after they
+// are applied, keyed by module address. Objects whose schemas are not
+// available are left out, as for the planned resources. The objects of each
+// module are sorted by address and then by deposed key.
+func marshalRemainingDeposed(changes *plans.Changes, s *states.State, schemas *terraform.Schemas, unknowns bool) (map[string][]Resource, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	destroyed := make(map[string]bool)
+	for _, rc := range changes.Resources {
+		if rc.DeposedKey != states.NotDeposed {
+			destroyed[rc.Addr.String()+"\x00"+rc.DeposedKey.String()] = true
+		}
+	}
+
+	ret := make(map[string][]Resource)
+	for _, ms := range s.Modules {
+		var objs []Resource
+		for _, rs := range ms.Resources {
+			schema := schemaForResource(schemas, rs.ProviderConfig.ProviderConfig.Type, rs.Addr)
+			if schema == nil {
+				continue
+			}
+			for key, is := range rs.Instances {
+				addr := rs.Addr.Instance(key).Absolute(ms.Addr)
+				for dk, obj := range is.Deposed {
+					if destroyed[addr.String()+"\x00"+dk.String()] {
+						continue
+					}
+					r, err := marshalDeposedResource(addr, dk, rs.ProviderConfig, obj, schema, unknowns)
+					if err != nil {
+						return nil, err
+					}
+					objs = append(objs, r)
+				}
+			}
+		}
+		if len(objs) == 0 {
+			continue
+		}
+		sort.Slice(objs, func(i, j int) bool {
+			if objs[i].Address != objs[j].Address {
+				return objs[i].Address < objs[j].Address
+			}
+			return objs[i].DeposedKey < objs[j].DeposedKey
+		})
+		ret[ms.Addr.String()] = objs
+	}
+	return ret, nil
+}
+
+func marshalDeposedResource(addr addrs.AbsResourceInstance, dk states.DeposedKey, provider addrs.AbsProviderConfig, obj *states.ResourceInstanceObjectSrc, schema *configschema.Block, unknowns bool) (Resource, error) {
+	ret := Resource{
+		Address:       addr.String(),
+		Mode:          marshalResourceMode(addr.Resource.Resource.Mode),
+		Type:          addr.Resource.Resource.Type,
+		Name:          addr.Resource.Resource.Name,
+		Index:         marshalInstanceKey(addr.Resource.Key),
+		ProviderName:  provider.ProviderConfig.Type,
+		DeposedKey:    dk.String(),
+		SchemaVersion: obj.SchemaVersion,
+	}
+	ret.ProviderConfigKey = marshalProviderConfigKey(provider)
+
+	v, err := obj.Decode(schema.ImpliedType())
+	if err != nil {
+		return ret, fmt.Errorf("error decoding deposed object %s of %s: %s", ret.DeposedKey, ret.Address, err)
+	}
+	if unknowns {
+		ret.Values, err = marshalUnknownValues(v.Value)
+	} else {
+		ret.Values, err = marshalValue(v.Value)
+	}
+	if err != nil {
+		return ret, fmt.Errorf("error marshaling deposed object %s of %s: %s", ret.DeposedKey, ret.Address, err)
+	}
+	if !unknowns {
+		ret.SensitiveValues, err = marshalSensitiveValues(v.Value, schema, nil)
+		if err != nil {
+			return ret, fmt.Errorf("error marshaling sensitive values for deposed object %s of %s: %s", ret.DeposedKey, ret.Address, err)
+		}
+	}
+	return ret, nil
+}
+
+func buildPlannedModule(addr addrs.ModuleInstance, resources, deposed map[string][]Resource, modules map[string][]addrs.ModuleInstance) Module {
+	key := addr.String()
+	// The resources of each module are already in the order of the changes
+	// they came from, as described for Plan.ResourceChanges.
+	ret := Module{
+		Address:   key,
+		Resources: resources[key],
+		Deposed:   deposed[key],
+	}
+
+	children := modules[key]
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Less(children[j])
+	})
+	for _, child := range children {
+		ret.ChildModules = append(ret.ChildModules, buildPlannedModule(child, resources, deposed, modules))
+	}
+
+	return ret
+}
+
+func marshalPlannedResource(rc *plans.ResourceInstanceChangeSrc, config *configs.Config, s *states.State, schemas *terraform.Schemas, unknowns bool) (Resource, error) {
+	addr := rc.Addr
+	ret := Resource{
+		Address:      addr.String(),
+		Mode:         marshalResourceMode(addr.Resource.Resource.Mode),
+		Type:         addr.Resource.Resource.Type,
+		Name:         addr.Resource.Resource.Name,
+		ProviderName: rc.ProviderAddr.ProviderConfig.Type,
+	}
+	ret.Index = marshalInstanceKey(addr.Resource.Key)
+	ret.ProviderConfigKey = marshalProviderConfigKey(rc.ProviderAddr)
+	ret.Tainted = currentObjectTainted(addr, s)
+
+	schema := schemaForResource(schemas, ret.ProviderName, addr.Resource.Resource)
+	if schema == nil {
+		return ret, fmt.Errorf("no schema found for %s", ret.Address)
+	}
+	ret.SchemaVersion = schemaVersionForResource(schemas, ret.ProviderName, addr.Resource.Resource)
+
+	changeV, err := rc.Decode(schema.ImpliedType())
+	if err != nil {
+		return ret, err
+	}
+
+	if unknowns {
+		ret.Values, err = marshalUnknownValues(changeV.After)
+	} else {
+		ret.Values, err = marshalValue(omitUnknowns(changeV.After))
+	}
+	if err != nil {
+		return ret, fmt.Errorf("error marshaling planned values for %s: %s", ret.Address, err)
+	}
+
+	if !unknowns {
+		ret.SensitiveValues, err = marshalSensitiveValues(changeV.After, schema, configSensitiveAttrs(addr, config, schema))
+		if err != nil {
+			return ret, fmt.Errorf("error marshaling sensitive values for %s: %s", ret.Address, err)
+		}
+		ret.UnknownReferences = unknownReferences(addr, changeV.After, config, schema)
+	}
+
+	return ret, nil
+}
+
+// marshalProviderConfigKey returns the key identifying the given provider
+// configuration, as described for ProviderConfig.Key. Provider configurations
+// belong to modules rather than to module instances, so any instance keys in
+// the address are ignored.
+func marshalProviderConfigKey(addr addrs.AbsProviderConfig) string {
+	var path addrs.Module
+	for _, step := range addr.Module {
+		path = append(path, step.Name)
+	}
+	return providerConfigKey(moduleAddressString(path), addr.ProviderConfig.Type, addr.ProviderConfig.Alias)
+}
+
+// marshalUnknownValues returns the json encoding of the result of
+// unknownAsBool for the given value, except that a wholly-known object is
+// represented as an empty object rather than as false, so that its shape is
+// preserved.
+func marshalUnknownValues(val cty.Value) (json.RawMessage, error) {
+	unknown := unknownAsBool(val)
+	if unknown.RawEquals(cty.False) && val.Type().IsObjectType() {
+		unknown = cty.EmptyObjectVal
+	}
+
+	ret, err := ctyjson.Marshal(unknown, unknown.Type())
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(ret), nil
+}
+
+// ValidateSchemaVersions checks that the planned values of each managed
+// resource conform to the expected version of the schema for its resource
+// type, given as a map from resource type names to versions. An error is
+// returned for each resource that conforms to a different version. Resources
+// of types not in the map are not checked.
+func (p *Plan) ValidateSchemaVersions(expected map[string]int) []error {
+	var errs []error
+	p.WalkResources(func(r *Resource) error {
+		if r.Mode != ManagedResourceMode {
+			return nil
+		}
+		want, ok := expected[r.Type]
+		if !ok || uint64(want) == r.SchemaVersion {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf(
+			"%s: values conform to version %d of the %s schema, but version %d was expected",
+			r.Address, r.SchemaVersion, r.Type, want,
+		))
+		return nil
+	})
+	return errs
+}
@@ -0,0 +1,811 @@
+package jsonplan
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/configs/configschema"
+	"github.com/hashicorp/terraform/plans"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestMarshallPlannedValues(t *testing.T) {
+	modA := addrs.RootModuleInstance.Child("a", addrs.NoKey)
+	modAB := modA.Child("b", addrs.NoKey)
+	modCD := addrs.RootModuleInstance.Child("c", addrs.NoKey).Child("d", addrs.NoKey)
+
+	thing := func(id string) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":  cty.StringVal(id),
+			"ami": cty.StringVal("ami-123"),
+		})
+	}
+	newThing := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	noThing := cty.NullVal(testThingType)
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "root", addrs.NoKey, plans.NoOp, thing("i-root"), thing("i-root")),
+				testResourceChange(t, "gone", addrs.NoKey, plans.Delete, thing("i-gone"), noThing),
+				testModuleResourceChange(t, modAB, "deep", addrs.NoKey, plans.Create, noThing, newThing),
+				testModuleResourceChange(t, modA, "shallow", addrs.NoKey, plans.Update, thing("i-a"), thing("i-a")),
+				testModuleResourceChange(t, modCD, "only", addrs.NoKey, plans.Create, noThing, newThing),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := json.Marshal(p.PlannedValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+		"root_module": {
+			"resources": [
+				{
+					"address": "test_thing.root",
+					"mode": "managed",
+					"type": "test_thing",
+					"name": "root",
+					"provider_name": "test",
+					"provider_config_key": "test",
+					"values": {"id": "i-root", "ami": "ami-123"},
+					"sensitive_values": {}
+				}
+			],
+			"child_modules": [
+				{
+					"address": "module.a",
+					"resources": [
+						{
+							"address": "module.a.test_thing.shallow",
+							"mode": "managed",
+							"type": "test_thing",
+							"name": "shallow",
+							"provider_name": "test",
+							"provider_config_key": "module.a:test",
+							"values": {"id": "i-a", "ami": "ami-123"},
+							"sensitive_values": {}
+						}
+					],
+					"child_modules": [
+						{
+							"address": "module.a.module.b",
+							"resources": [
+								{
+									"address": "module.a.module.b.test_thing.deep",
+									"mode": "managed",
+									"type": "test_thing",
+									"name": "deep",
+									"provider_name": "test",
+									"provider_config_key": "module.a.module.b:test",
+									"values": {"ami": "ami-123"},
+									"sensitive_values": {}
+								}
+							]
+						}
+					]
+				},
+				{
+					"address": "module.c",
+					"child_modules": [
+						{
+							"address": "module.c.module.d",
+							"resources": [
+								{
+									"address": "module.c.module.d.test_thing.only",
+									"mode": "managed",
+									"type": "test_thing",
+									"name": "only",
+									"provider_name": "test",
+									"provider_config_key": "module.c.module.d:test",
+									"values": {"ami": "ami-123"},
+									"sensitive_values": {}
+								}
+							]
+						}
+					]
+				}
+			]
+		}
+	}`
+	assertJSONEqual(t, got, []byte(want))
+}
+
+func TestMarshallPlannedValues_sensitive(t *testing.T) {
+	schema := &configschema.Block{
+		Attributes: map[string]*configschema.Attribute{
+			"id": {Type: cty.String, Computed: true},
+		},
+		BlockTypes: map[string]*configschema.NestedBlock{
+			"login": {
+				Nesting: configschema.NestingList,
+				Block: configschema.Block{
+					Attributes: map[string]*configschema.Attribute{
+						"user":     {Type: cty.String, Optional: true},
+						"password": {Type: cty.String, Optional: true, Sensitive: true},
+					},
+				},
+			},
+		},
+	}
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypes["test_db"] = schema
+	ty := schema.ImpliedType()
+
+	rc := &plans.ResourceInstanceChange{
+		Addr: addrs.Resource{
+			Mode: addrs.ManagedResourceMode,
+			Type: "test_db",
+			Name: "main",
+		}.Instance(addrs.NoKey).Absolute(addrs.RootModuleInstance),
+		ProviderAddr: addrs.ProviderConfig{
+			Type: "test",
+		}.Absolute(addrs.RootModuleInstance),
+		Change: plans.Change{
+			Action: plans.Create,
+			Before: cty.NullVal(ty),
+			After: cty.ObjectVal(map[string]cty.Value{
+				"id": cty.UnknownVal(cty.String),
+				"login": cty.ListVal([]cty.Value{
+					cty.ObjectVal(map[string]cty.Value{
+						"user":     cty.StringVal("admin"),
+						"password": cty.StringVal("hunter2"),
+					}),
+				}),
+			}),
+		},
+	}
+	create, err := rc.Encode(ty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{create},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	r, ok := p.Resource("test_db.main")
+	if !ok {
+		t.Fatal("no planned values for test_db.main")
+	}
+	assertJSONEqual(t, r.SensitiveValues, []byte(`{"login":[{"password":true}]}`))
+	assertJSONEqual(t, r.SensitiveValues, p.ResourceChanges[0].Change.AfterSensitive)
+
+	if unknown := p.ProposedUnknown.RootModule.Resources[0]; unknown.SensitiveValues != nil {
+		t.Errorf("proposed unknown values have sensitive values %s", unknown.SensitiveValues)
+	}
+}
+
+func TestMarshallProposedUnknown(t *testing.T) {
+	modA := addrs.RootModuleInstance.Child("a", addrs.NoKey)
+
+	thing := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	newThing := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	noThing := cty.NullVal(testThingType)
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "known", addrs.NoKey, plans.NoOp, thing, thing),
+				testModuleResourceChange(t, modA, "new", addrs.IntKey(0), plans.Create, noThing, newThing),
+			},
+			Outputs: []*plans.OutputChangeSrc{
+				testOutputChange(t, "id", plans.Create, cty.NilVal, cty.UnknownVal(cty.String)),
+				testOutputChange(t, "ami", plans.Create, cty.NilVal, cty.StringVal("ami-123")),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := json.Marshal(p.ProposedUnknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{
+		"outputs": {
+			"id": {"value": true}
+		},
+		"root_module": {
+			"resources": [
+				{
+					"address": "test_thing.known",
+					"mode": "managed",
+					"type": "test_thing",
+					"name": "known",
+					"provider_name": "test",
+					"provider_config_key": "test",
+					"values": {}
+				}
+			],
+			"child_modules": [
+				{
+					"address": "module.a",
+					"resources": [
+						{
+							"address": "module.a.test_thing.new[0]",
+							"index": 0,
+							"mode": "managed",
+							"type": "test_thing",
+							"name": "new",
+							"provider_name": "test",
+							"provider_config_key": "module.a:test",
+							"values": {"id": true}
+						}
+					]
+				}
+			]
+		}
+	}`
+	assertJSONEqual(t, got, []byte(want))
+
+	// The two trees must have the same structure, so that they can be
+	// correlated by address.
+	var plannedAddrs, unknownAddrs []string
+	var collect func(m Module, addrs *[]string)
+	collect = func(m Module, addrs *[]string) {
+		*addrs = append(*addrs, m.Address)
+		for _, r := range m.Resources {
+			*addrs = append(*addrs, r.Address)
+		}
+		for _, c := range m.ChildModules {
+			collect(c, addrs)
+		}
+	}
+	collect(p.PlannedValues.RootModule, &plannedAddrs)
+	collect(p.ProposedUnknown.RootModule, &unknownAddrs)
+	if !reflect.DeepEqual(plannedAddrs, unknownAddrs) {
+		t.Errorf("trees do not match\nplanned_values:   %#v\nproposed_unknown: %#v", plannedAddrs, unknownAddrs)
+	}
+}
+
+func TestMarshall_instanceIndex(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "counted", addrs.IntKey(0), plans.Create, cty.NullVal(testThingType), after),
+				testResourceChange(t, "each", addrs.StringKey("primary"), plans.Create, cty.NullVal(testThingType), after),
+				testResourceChange(t, "single", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+		},
+	}
+
+	src, err := Marshall(nil, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		PlannedValues struct {
+			RootModule struct {
+				Resources []map[string]interface{} `json:"resources"`
+			} `json:"root_module"`
+		} `json:"planned_values"`
+		ResourceChanges []map[string]interface{} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"test_thing.counted[0]":      float64(0),
+		`test_thing.each["primary"]`: "primary",
+		"test_thing.single":          nil,
+	}
+	for _, objs := range [][]map[string]interface{}{got.PlannedValues.RootModule.Resources, got.ResourceChanges} {
+		if len(objs) != len(want) {
+			t.Fatalf("wrong number of objects %d; want %d", len(objs), len(want))
+		}
+		for _, obj := range objs {
+			addr := obj["address"].(string)
+			index, ok := obj["index"]
+			if want[addr] == nil {
+				if ok {
+					t.Errorf("%s has unexpected index %#v", addr, index)
+				}
+				continue
+			}
+			if index != want[addr] {
+				t.Errorf("%s has wrong index %#v; want %#v", addr, index, want[addr])
+			}
+		}
+	}
+}
+
+func TestValidateSchemaVersions(t *testing.T) {
+	schemas := testSchemas()
+	schemas.Providers["test"].ResourceTypeSchemaVersions = map[string]uint64{
+		"test_thing": 2,
+	}
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "web", addrs.NoKey, plans.Create,
+					cty.NullVal(testThingType),
+					cty.ObjectVal(map[string]cty.Value{
+						"id":  cty.StringVal("i-abc"),
+						"ami": cty.StringVal("ami-123"),
+					}),
+				),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.PlannedValues.RootModule.Resources[0].SchemaVersion, uint64(2); got != want {
+		t.Fatalf("wrong schema version %d; want %d", got, want)
+	}
+
+	t.Run("matching", func(t *testing.T) {
+		if errs := got.ValidateSchemaVersions(map[string]int{"test_thing": 2}); len(errs) != 0 {
+			t.Errorf("unexpected errors: %s", errs)
+		}
+	})
+	t.Run("mismatching", func(t *testing.T) {
+		errs := got.ValidateSchemaVersions(map[string]int{"test_thing": 1})
+		if len(errs) != 1 {
+			t.Fatalf("wrong number of errors %d; want 1", len(errs))
+		}
+		want := "test_thing.web: values conform to version 2 of the test_thing schema, but version 1 was expected"
+		if got := errs[0].Error(); got != want {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("unchecked type", func(t *testing.T) {
+		if errs := got.ValidateSchemaVersions(map[string]int{"test_other": 1}); len(errs) != 0 {
+			t.Errorf("unexpected errors: %s", errs)
+		}
+	})
+}
+
+func TestMarshall_moduleInstances(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+module "x" {
+  source = "./x"
+  count  = 2
+}
+`,
+		"x": `
+resource "test_thing" "a" {
+}
+`,
+	})
+
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	x0 := addrs.RootModuleInstance.Child("x", addrs.IntKey(0))
+	x1 := addrs.RootModuleInstance.Child("x", addrs.IntKey(1))
+	nested := x1.Child("y", addrs.StringKey("b"))
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testModuleResourceChange(t, nested, "a", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, x1, "a", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+				testModuleResourceChange(t, x0, "a", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, values := range []Values{got.PlannedValues, got.ProposedUnknown} {
+		children := values.RootModule.ChildModules
+		if len(children) != 2 {
+			t.Fatalf("wrong number of child modules %d; want 2", len(children))
+		}
+		for i, want := range []string{"module.x[0]", "module.x[1]"} {
+			if got := children[i].Address; got != want {
+				t.Errorf("wrong address for child module %d %q; want %q", i, got, want)
+			}
+			if got := len(children[i].Resources); got != 1 {
+				t.Errorf("wrong number of resources in %s %d; want 1", want, got)
+			}
+		}
+		if got := len(children[0].ChildModules); got != 0 {
+			t.Errorf("wrong number of child modules of module.x[0] %d; want 0", got)
+		}
+		if got := len(children[1].ChildModules); got != 1 {
+			t.Fatalf("wrong number of child modules of module.x[1] %d; want 1", got)
+		}
+		if got, want := children[1].ChildModules[0].Address, `module.x[1].module.y["b"]`; got != want {
+			t.Errorf("wrong address for nested module %q; want %q", got, want)
+		}
+		if got, want := children[1].Resources[0].Address, "module.x[1].test_thing.a"; got != want {
+			t.Errorf("wrong resource address %q; want %q", got, want)
+		}
+	}
+}
+
+func TestMarshall_moduleInstancesMissingSchema(t *testing.T) {
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testModuleResourceChange(t, addrs.RootModuleInstance.Child("x", addrs.IntKey(0)), "a", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The module instance will still exist after apply, even though its
+	// resource can't be rendered.
+	want := Module{
+		ChildModules: []Module{
+			{Address: "module.x[0]"},
+		},
+	}
+	if !reflect.DeepEqual(got.PlannedValues.RootModule, want) {
+		t.Errorf("wrong planned values\ngot:  %#v\nwant: %#v", got.PlannedValues.RootModule, want)
+	}
+}
+
+func TestMarshall_providerConfigKey(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+provider "aws" {
+  alias = "us_west"
+}
+
+provider "aws" {
+  alias = "us_east"
+}
+
+resource "aws_instance" "west" {
+  provider = aws.us_west
+}
+
+resource "aws_instance" "east" {
+  provider = aws.us_east
+}
+
+module "net" {
+  source = "./net"
+}
+`,
+		"net": `
+provider "aws" {
+}
+
+resource "aws_instance" "subnet" {
+}
+`,
+	})
+
+	schemas := &terraform.Schemas{
+		Providers: map[string]*terraform.ProviderSchema{
+			"aws": {
+				ResourceTypes: map[string]*configschema.Block{
+					"aws_instance": testThingSchema,
+				},
+			},
+		},
+	}
+
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	change := func(module addrs.ModuleInstance, name, alias string) *plans.ResourceInstanceChangeSrc {
+		rc := &plans.ResourceInstanceChange{
+			Addr: addrs.Resource{
+				Mode: addrs.ManagedResourceMode,
+				Type: "aws_instance",
+				Name: name,
+			}.Instance(addrs.NoKey).Absolute(module),
+			ProviderAddr: addrs.ProviderConfig{
+				Type:  "aws",
+				Alias: alias,
+			}.Absolute(module),
+			Change: plans.Change{
+				Action: plans.Create,
+				Before: cty.NullVal(testThingType),
+				After:  after,
+			},
+		}
+		ret, err := rc.Encode(testThingType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ret
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				change(addrs.RootModuleInstance, "west", "us_west"),
+				change(addrs.RootModuleInstance, "east", "us_east"),
+				change(addrs.RootModuleInstance.Child("net", addrs.NoKey), "subnet", ""),
+			},
+		},
+	}
+
+	got, err := MarshallToPlan(snap, plan, nil, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providerKeys := make(map[string]bool)
+	for _, pc := range got.Config.ProviderConfigs {
+		providerKeys[pc.Key()] = true
+	}
+
+	want := map[string]string{
+		"aws_instance.east":              "aws.us_east",
+		"aws_instance.west":              "aws.us_west",
+		"module.net.aws_instance.subnet": "module.net:aws",
+	}
+	resources := append([]Resource(nil), got.PlannedValues.RootModule.Resources...)
+	for _, child := range got.PlannedValues.RootModule.ChildModules {
+		resources = append(resources, child.Resources...)
+	}
+	if len(resources) != len(want) {
+		t.Fatalf("wrong number of resources %d; want %d", len(resources), len(want))
+	}
+	for _, r := range resources {
+		if r.ProviderConfigKey != want[r.Address] {
+			t.Errorf("wrong provider config key for %s %q; want %q", r.Address, r.ProviderConfigKey, want[r.Address])
+		}
+		if !providerKeys[r.ProviderConfigKey] {
+			t.Errorf("no provider configuration for key %q", r.ProviderConfigKey)
+		}
+	}
+}
+
+func TestMarshall_taintedPlannedValues(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.UnknownVal(cty.String),
+		"ami": cty.StringVal("ami-123"),
+	})
+	tainted := testResourceChange(t, "tainted", addrs.NoKey, plans.DeleteThenCreate, before, after)
+	ready := testResourceChange(t, "ready", addrs.NoKey, plans.NoOp, before, before)
+
+	state := states.BuildState(func(s *states.SyncState) {
+		for _, obj := range []struct {
+			rc     *plans.ResourceInstanceChangeSrc
+			status states.ObjectStatus
+		}{
+			{tainted, states.ObjectTainted},
+			{ready, states.ObjectReady},
+		} {
+			s.SetResourceInstanceCurrent(
+				obj.rc.Addr,
+				&states.ResourceInstanceObjectSrc{
+					Status:    obj.status,
+					AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+				},
+				obj.rc.ProviderAddr,
+			)
+		}
+	})
+
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{tainted, ready},
+		},
+	}
+
+	got, err := MarshallToPlan(nil, plan, state, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{
+		"test_thing.ready":   false,
+		"test_thing.tainted": true,
+	}
+	for _, values := range []Values{got.PlannedValues, got.ProposedUnknown} {
+		if len(values.RootModule.Resources) != len(want) {
+			t.Fatalf("wrong number of resources %d; want %d", len(values.RootModule.Resources), len(want))
+		}
+		for _, r := range values.RootModule.Resources {
+			if r.Tainted != want[r.Address] {
+				t.Errorf("wrong tainted flag for %s %t; want %t", r.Address, r.Tainted, want[r.Address])
+			}
+		}
+	}
+}
+
+func TestMarshallPlannedValues_unknownReferences(t *testing.T) {
+	snap := testSnapshot(map[string]string{
+		"": `
+locals {
+  subnet_id = test_thing.subnet.id
+}
+
+resource "test_thing" "subnet" {
+  ami = "ami-123"
+}
+
+resource "test_thing" "web" {
+  ami = test_thing.subnet.id
+}
+
+resource "test_thing" "lb" {
+  ami = "${local.subnet_id}-lb"
+}
+`,
+	})
+	after := func(ami cty.Value) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"id":  cty.UnknownVal(cty.String),
+			"ami": ami,
+		})
+	}
+	plan := &plans.Plan{
+		Changes: &plans.Changes{
+			Resources: []*plans.ResourceInstanceChangeSrc{
+				testResourceChange(t, "subnet", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after(cty.StringVal("ami-123"))),
+				testResourceChange(t, "web", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after(cty.UnknownVal(cty.String))),
+				testResourceChange(t, "lb", addrs.NoKey, plans.Create, cty.NullVal(testThingType), after(cty.UnknownVal(cty.String))),
+			},
+		},
+	}
+
+	p, err := MarshallToPlan(snap, plan, nil, testSchemas())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]map[string][]string)
+	p.WalkResources(func(r *Resource) error {
+		got[r.Address] = r.UnknownReferences
+		return nil
+	})
+	want := map[string]map[string][]string{
+		// The id is computed by the provider, so is resolved by no reference.
+		"test_thing.subnet": nil,
+		"test_thing.web": {
+			"ami": {"test_thing.subnet.id"},
+		},
+		"test_thing.lb": {
+			"ami": {"test_thing.subnet.id"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong unknown references\ngot:  %#v\nwant: %#v", got, want)
+	}
+
+	if unknown := p.ProposedUnknown.RootModule.Resources[0]; unknown.UnknownReferences != nil {
+		t.Errorf("proposed unknown values have unknown references %#v", unknown.UnknownReferences)
+	}
+}
+
+func TestMarshall_deposedPlannedValues(t *testing.T) {
+	before := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-123"),
+	})
+	after := cty.ObjectVal(map[string]cty.Value{
+		"id":  cty.StringVal("i-abc"),
+		"ami": cty.StringVal("ami-456"),
+	})
+	current := testResourceChange(t, "web", addrs.NoKey, plans.Update, before, after)
+	deposed := testResourceChange(t, "web", addrs.NoKey, plans.Delete, before, cty.NullVal(testThingType))
+	deposed.DeposedKey = states.DeposedKey("00000001")
+
+	state := states.BuildState(func(s *states.SyncState) {
+		s.SetResourceInstanceCurrent(
+			current.Addr,
+			&states.ResourceInstanceObjectSrc{
+				Status:    states.ObjectReady,
+				AttrsJSON: []byte(`{"id":"i-abc","ami":"ami-123"}`),
+			},
+			current.ProviderAddr,
+		)
+		s.SetResourceInstanceDeposed(
+			current.Addr,
+			deposed.DeposedKey,
+			&states.ResourceInstanceObjectSrc{
+				Status:    states.ObjectReady,
+				AttrsJSON: []byte(`{"id":"i-old","ami":"ami-000"}`),
+			},
+			current.ProviderAddr,
+		)
+	})
+
+	tests := map[string]struct {
+		changes []*plans.ResourceInstanceChangeSrc
+		want    int
+	}{
+		"remaining": {
+			[]*plans.ResourceInstanceChangeSrc{current},
+			1,
+		},
+		"destroyed": {
+			[]*plans.ResourceInstanceChangeSrc{current, deposed},
+			0,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plan := &plans.Plan{
+				Changes: &plans.Changes{
+					Resources: test.changes,
+				},
+			}
+
+			got, err := MarshallToPlan(nil, plan, state, testSchemas())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, values := range []Values{got.PlannedValues, got.ProposedUnknown} {
+				if len(values.RootModule.Resources) != 1 {
+					t.Fatalf("wrong number of resources %d; want 1", len(values.RootModule.Resources))
+				}
+				if len(values.RootModule.Deposed) != test.want {
+					t.Fatalf("wrong number of deposed objects %d; want %d", len(values.RootModule.Deposed), test.want)
+				}
+				if test.want == 0 {
+					continue
+				}
+
+				r := values.RootModule.Deposed[0]
+				if r.Address != "test_thing.web" {
+					t.Errorf("wrong address %q", r.Address)
+				}
+				if r.DeposedKey != "00000001" {
+					t.Errorf("wrong deposed key %q", r.DeposedKey)
+				}
+			}
+			if test.want > 0 {
+				assertJSONEqual(t, got.PlannedValues.RootModule.Deposed[0].Values, []byte(`{"id":"i-old","ami":"ami-000"}`))
+				assertJSONEqual(t, got.ProposedUnknown.RootModule.Deposed[0].Values, []byte(`{}`))
+			}
+		})
+	}
+}
@@ -63,6 +63,33 @@ func TestModuleOverrideVariable(t *testing.T) {
 	assertResultDeepEqual(t, got, want)
 }
 
+func TestModuleOverrideVariableSensitive(t *testing.T) {
+	mod, diags := testModuleFromDir("test-fixtures/valid-modules/override-variable-sensitive")
+	assertNoDiagnostics(t, diags)
+	if mod == nil {
+		t.Fatalf("module is nil")
+	}
+
+	want := map[string]bool{
+		"kept":    true,
+		"set":     true,
+		"cleared": false,
+	}
+	for name, wantSensitive := range want {
+		v, exists := mod.Variables[name]
+		if !exists {
+			t.Errorf("no variable %q", name)
+			continue
+		}
+		if v.Sensitive != wantSensitive {
+			t.Errorf("wrong sensitive for %q %#v; want %#v", name, v.Sensitive, wantSensitive)
+		}
+		if !v.SensitiveSet {
+			t.Errorf("SensitiveSet not set for %q", name)
+		}
+	}
+}
+
 func TestModuleOverrideModule(t *testing.T) {
 	mod, diags := testModuleFromDir("test-fixtures/valid-modules/override-module")
 	assertNoDiagnostics(t, diags)
@@ -114,6 +114,11 @@ func TestParserLoadConfigFileFailureMessages(t *testing.T) {
 			hcl.DiagError,
 			"Unsuitable value type",
 		},
+		{
+			"invalid-files/variable-sensitive-badbool.tf",
+			hcl.DiagError,
+			"Unsuitable value type",
+		},
 		{
 			"valid-files/resources-ignorechanges-all-legacy.tf",
 			hcl.DiagWarning,
@@ -110,7 +110,7 @@ func decodeResourceBlock(block *hcl.Block) (*Resource, hcl.Diagnostics) {
 	}
 
 	if attr, exists := content.Attributes["for_each"]; exists {
-		r.Count = attr.Expr
+		r.ForEach = attr.Expr
 	}
 
 	if attr, exists := content.Attributes["provider"]; exists {
@@ -287,7 +287,7 @@ func decodeDataBlock(block *hcl.Block) (*Resource, hcl.Diagnostics) {
 	}
 
 	if attr, exists := content.Attributes["for_each"]; exists {
-		r.Count = attr.Expr
+		r.ForEach = attr.Expr
 	}
 
 	if attr, exists := content.Attributes["provider"]; exists {
@@ -22,3 +22,7 @@ variable "cheeze_pizza" {
 variable "π" {
   default = 3.14159265359
 }
+
+variable "password" {
+  sensitive = true
+}
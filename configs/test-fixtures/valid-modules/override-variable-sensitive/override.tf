@@ -0,0 +1,7 @@
+variable "set" {
+  sensitive = true
+}
+
+variable "cleared" {
+  sensitive = false
+}
@@ -0,0 +1,10 @@
+variable "kept" {
+  sensitive = true
+}
+
+variable "set" {
+}
+
+variable "cleared" {
+  sensitive = true
+}